@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// aliasFile returns where the user's directory aliases are kept
+func aliasFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "aliases"), nil
+}
+
+// loadAliases reads an alias file: one "label = path" per line, with ~, ~user
+// and $VAR expanded in the path. Blank lines and # comments are skipped, and
+// a later line for the same path replaces an earlier one. A missing file
+// holds no aliases.
+func loadAliases(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	aliases := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, dir, ok := strings.Cut(line, "=")
+		label, dir = strings.TrimSpace(label), strings.TrimSpace(dir)
+		if !ok || label == "" || dir == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"label = path\"", path, lineNo)
+		}
+		expanded, err := expandPath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		aliases[expanded] = label
+	}
+	return aliases, scanner.Err()
+}
+
+// aliasedDisplay shows the label aliasing a directory ahead of its path
+func aliasedDisplay(label, display string) string {
+	return label + " (" + display + ")"
+}
\ No newline at end of file
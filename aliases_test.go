@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAliases(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("HOME", tempDir)
+
+	path := filepath.Join(tempDir, "aliases")
+	content := "# services\nbilling-service = /srv/app-x7f2\n\n  notes=~/z-archive/  \nold = /srv/app-x7f2/../legacy\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write alias file: %v", err)
+	}
+
+	aliases, err := loadAliases(path)
+	if err != nil {
+		t.Fatalf("loadAliases failed: %v", err)
+	}
+	expected := map[string]string{
+		"/srv/app-x7f2":                     "billing-service",
+		filepath.Join(tempDir, "z-archive"): "notes",
+		"/srv/legacy":                       "old",
+	}
+	if len(aliases) != len(expected) {
+		t.Errorf("Expected %d aliases, got %v", len(expected), aliases)
+	}
+	for dir, label := range expected {
+		if aliases[dir] != label {
+			t.Errorf("Alias for %s = %q, expected %q", dir, aliases[dir], label)
+		}
+	}
+
+	if aliases, err := loadAliases(filepath.Join(tempDir, "missing")); err != nil || aliases != nil {
+		t.Errorf("Expected a missing file to hold no aliases, got %v, %v", aliases, err)
+	}
+	if err := os.WriteFile(path, []byte("billing-service /srv/app-x7f2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write alias file: %v", err)
+	}
+	if _, err := loadAliases(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("Expected a line-numbered error for a line without =, got %v", err)
+	}
+}
+
+func TestAliasMatchedAndDisplayed(t *testing.T) {
+	state := &uiState{config: TUIConfig{Aliases: map[string]string{"/srv/app-x7f2": "billing-service"}}}
+	state.consume(DirBatch{Directories: []string{"/srv/app-x7f2", "/srv/web", "/srv/bin"}, Done: true})
+
+	for _, query := range []string{"billing", "x7f2"} {
+		state.query = query
+		state.rematch()
+		if len(state.matches) == 0 || state.matches[0].Str != "/srv/app-x7f2" {
+			t.Errorf("Query %q: expected /srv/app-x7f2 first, got %v", query, state.matches)
+		}
+	}
+
+	state.query = "billing"
+	state.rematch()
+	screen := newTestScreen(t, 100, 24)
+	updateDisplayAsync(screen, state.view())
+	row := screenRow(screen, computeLayout(24, state.config).ResultRow(0))
+	if !strings.Contains(row, "billing-service (/srv/app-x7f2)") {
+		t.Errorf("Expected the alias shown with its path, got %q", row)
+	}
+}
\ No newline at end of file
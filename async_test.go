@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -93,7 +94,7 @@ func TestAsyncScanningWithContext(t *testing.T) {
 			cancel() // Cancel scanning
 		}
 		
-		if batch.Done && batch.Err == context.Canceled {
+		if batch.Done && errors.Is(batch.Err, context.Canceled) {
 			t.Log("Scanning was properly cancelled")
 			return
 		}
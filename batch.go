@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// readQueries reads a --query-file: one query per line, blank lines skipped.
+// A file without any query is an errNoValidInput error.
+func readQueries(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	var queries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if query := strings.TrimSpace(scanner.Text()); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("%w: %s has no queries", errNoValidInput, path)
+	}
+	return queries, nil
+}
+
+// collectDirectories drains a scan, returning everything it found
+func collectDirectories(dirChan <-chan DirBatch) ([]string, error) {
+	var directories []string
+	for batch := range dirChan {
+		if batch.Err != nil {
+			return directories, batch.Err
+		}
+		directories = append(directories, batch.Directories...)
+		if batch.Done {
+			break
+		}
+	}
+	return directories, nil
+}
+
+// streamDirectories writes every scanned directory on its own line as soon
+// as its batch arrives, flushing per batch, so a downstream finder such as
+// fzf gets candidates while the scan is still running. Nothing is ranked or
+// sorted. format turns a path into its printed form.
+func streamDirectories(w io.Writer, dirChan <-chan DirBatch, format func(string) string) error {
+	bw := bufio.NewWriter(w)
+	for batch := range dirChan {
+		if batch.Err != nil {
+			bw.Flush()
+			return batch.Err
+		}
+		for _, dir := range batch.Directories {
+			fmt.Fprintln(bw, format(dir))
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if batch.Done {
+			break
+		}
+	}
+	return nil
+}
+
+// queryIndex answers queries against a fixed directory list, ranking matches
+// the way the finder does
+type queryIndex struct {
+	state *uiState
+}
+
+func newQueryIndex(directories []string, config TUIConfig) *queryIndex {
+	// Every query sees the full list, never a sample
+	config.SampleThreshold = 0
+	state := &uiState{config: config}
+	state.addDirectories(directories)
+	return &queryIndex{state: state}
+}
+
+// queryErr reports why the last query could not be matched, e.g. an invalid
+// regexp with --regex
+func (q *queryIndex) queryErr() error {
+	return q.state.regexErr
+}
+
+// size returns the number of indexed directories
+func (q *queryIndex) size() int {
+	return len(q.state.directories)
+}
+
+// topMatches returns the best n matches for query, or all of them when n <= 0
+func (q *queryIndex) topMatches(query string, n int) []fuzzy.Match {
+	q.state.query = query
+	q.state.rematch()
+	
+	matches := q.state.matches
+	if n > 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// top returns the paths of the best n matches for query
+func (q *queryIndex) top(query string, n int) []string {
+	matches := q.topMatches(query, n)
+	paths := make([]string, len(matches))
+	for i, match := range matches {
+		paths[i] = match.Str
+	}
+	return paths
+}
+
+// runQueries matches each query against directories the way the finder
+// ranks them, and writes its best top results as "query\tpath" lines. A
+// query without matches still gets a line, with an empty path, so every
+// query is accounted for. format turns a path into its printed form. With
+// explain each line gains a third field breaking the match's rank down.
+func runQueries(w io.Writer, queries, directories []string, config TUIConfig, top int, format func(string) string, explain bool) error {
+	index := newQueryIndex(directories, config)
+	
+	bw := bufio.NewWriter(w)
+	for _, query := range queries {
+		matches := index.topMatches(query, top)
+		if err := index.queryErr(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: query %q: %v\n", query, err)
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(bw, "%s\t\n", query)
+		}
+		for _, match := range matches {
+			if explain {
+				fmt.Fprintf(bw, "%s\t%s\t%s\n", query, format(match.Str), index.state.explain(match))
+			} else {
+				fmt.Fprintf(bw, "%s\t%s\n", query, format(match.Str))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// countMatches writes how many of directories match query the way the finder
+// ranks them, and returns that count. Unlike runQueries every match counts,
+// whatever MaxResults caps the list at.
+func countMatches(w io.Writer, query string, directories []string, config TUIConfig) (int, error) {
+	config.MaxResults = 0
+	index := newQueryIndex(directories, config)
+	count := len(index.topMatches(query, 0))
+	if err := index.queryErr(); err != nil {
+		return 0, err
+	}
+	_, err := fmt.Fprintln(w, count)
+	return count, err
+}
\ No newline at end of file
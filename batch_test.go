@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunQueryFile(t *testing.T) {
+	tempDir := t.TempDir()
+	queryFile := filepath.Join(tempDir, "queries.txt")
+	if err := os.WriteFile(queryFile, []byte("api\n\n  webapp  \nnomatchxyz\nlogs\n"), 0644); err != nil {
+		t.Fatalf("Failed to write query file: %v", err)
+	}
+
+	queries, err := readQueries(queryFile)
+	if err != nil {
+		t.Fatalf("readQueries failed: %v", err)
+	}
+	if strings.Join(queries, "|") != "api|webapp|nomatchxyz|logs" {
+		t.Fatalf("Unexpected queries: %q", queries)
+	}
+
+	directories := []string{
+		"/home/user/projects/webapp",
+		"/home/user/projects/webapp/src",
+		"/srv/api",
+		"/srv/api/v2",
+		"/var/log/logs",
+	}
+	var out bytes.Buffer
+	format := func(path string) string { return path }
+	if err := runQueries(&out, queries, directories, TUIConfig{}, 1, format, false); err != nil {
+		t.Fatalf("runQueries failed: %v", err)
+	}
+
+	expected := "api\t/srv/api\n" +
+		"webapp\t/home/user/projects/webapp\n" +
+		"nomatchxyz\t\n" +
+		"logs\t/var/log/logs\n"
+	if out.String() != expected {
+		t.Errorf("Output =\n%s\nexpected\n%s", out.String(), expected)
+	}
+
+	// With a higher top each query lists several matches in rank order
+	out.Reset()
+	if err := runQueries(&out, []string{"api"}, directories, TUIConfig{}, 2, format, false); err != nil {
+		t.Fatalf("runQueries failed: %v", err)
+	}
+	if out.String() != "api\t/srv/api\napi\t/srv/api/v2\n" {
+		t.Errorf("Unexpected top-2 output:\n%s", out.String())
+	}
+}
+
+func TestCollectDirectories(t *testing.T) {
+	ch := make(chan DirBatch, 3)
+	ch <- DirBatch{Directories: []string{"/a", "/b"}}
+	ch <- DirBatch{Directories: []string{"/c"}, Done: true}
+	close(ch)
+
+	directories, err := collectDirectories(ch)
+	if err != nil || strings.Join(directories, " ") != "/a /b /c" {
+		t.Errorf("collectDirectories = %v, %v", directories, err)
+	}
+}
+// signalWriter reports each write on a channel
+type signalWriter struct {
+	writes chan string
+}
+
+func (w signalWriter) Write(p []byte) (int, error) {
+	w.writes <- string(p)
+	return len(p), nil
+}
+
+func TestStreamDirectoriesBeforeScanCompletes(t *testing.T) {
+	// A slow scan: the second batch only comes once the first was written
+	ch := make(chan DirBatch)
+	w := signalWriter{writes: make(chan string, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- streamDirectories(w, ch, func(path string) string { return path })
+	}()
+
+	ch <- DirBatch{Directories: []string{"/srv/b", "/srv/a"}}
+	select {
+	case out := <-w.writes:
+		// Discovery order, not sorted
+		if out != "/srv/b\n/srv/a\n" {
+			t.Errorf("First write = %q", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Nothing written before the scan completed")
+	}
+
+	ch <- DirBatch{Directories: []string{"/srv/c"}, Done: true}
+	if err := <-done; err != nil {
+		t.Fatalf("streamDirectories failed: %v", err)
+	}
+	if out := <-w.writes; out != "/srv/c\n" {
+		t.Errorf("Second write = %q", out)
+	}
+}
+
+func TestReadQueriesRejectsEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.txt")
+	if err := os.WriteFile(path, []byte("\n   \n\n"), 0644); err != nil {
+		t.Fatalf("Failed to write query file: %v", err)
+	}
+
+	queries, err := readQueries(path)
+	if !errors.Is(err, errNoValidInput) || queries != nil {
+		t.Errorf("Expected errNoValidInput for a blank file, got %v, %v", queries, err)
+	}
+	if exitCode(err) != exitNoInput {
+		t.Errorf("Expected exit code %d, got %d", exitNoInput, exitCode(err))
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	directories := []string{
+		"/home/user/projects/webapp",
+		"/home/user/projects/webapp/src",
+		"/srv/api",
+		"/srv/api/v2",
+		"/var/log/logs",
+	}
+	for _, tc := range []struct {
+		query    string
+		expected int
+	}{
+		{"webapp", 2},
+		{"srv/api", 2},
+		{"logs", 1},
+		{"", 5},
+		{"nomatchxyz", 0},
+	} {
+		var out bytes.Buffer
+		// A cap on the finder's list doesn't cap the count
+		n, err := countMatches(&out, tc.query, directories, TUIConfig{MaxResults: 1})
+		if err != nil {
+			t.Fatalf("countMatches(%q) failed: %v", tc.query, err)
+		}
+		if n != tc.expected || out.String() != fmt.Sprintf("%d\n", tc.expected) {
+			t.Errorf("countMatches(%q) = %d, printed %q; expected %d", tc.query, n, out.String(), tc.expected)
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := countMatches(&out, "(", directories, TUIConfig{Regex: true}); err == nil || out.Len() != 0 {
+		t.Errorf("Expected an invalid regex to fail without output, got %v and %q", err, out.String())
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/sahilm/fuzzy"
 )
 
@@ -84,6 +87,58 @@ func BenchmarkScanDirectoriesLarge(b *testing.B) {
 	}
 }
 
+// createDeepNarrowTree builds a chain of depth directories, each holding one
+// sibling leaf next to the next link of the chain.
+func createDeepNarrowTree(b *testing.B, depth int) string {
+	tempDir := b.TempDir()
+
+	dir := tempDir
+	for i := 0; i < depth; i++ {
+		if err := os.MkdirAll(filepath.Join(dir, "leaf"), 0755); err != nil {
+			b.Fatalf("Failed to create test dir: %v", err)
+		}
+		dir = filepath.Join(dir, "d")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		b.Fatalf("Failed to create test dir: %v", err)
+	}
+	return tempDir
+}
+
+// BenchmarkScanDeepNarrow measures the depth-tracking walker used by the async
+// scanner on a 60-level chain.
+func BenchmarkScanDeepNarrow(b *testing.B) {
+	tempDir := createDeepNarrowTree(b, 60)
+	config := ScanConfig{
+		Root:              tempDir,
+		MaxDepth:          100,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  50,
+		MaxBatchSize:      200,
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for range scanWithConfig(config) {
+		}
+	}
+}
+
+// BenchmarkScanDeepNarrowWalkDir is the filepath.WalkDir + isWithinDepth
+// baseline for BenchmarkScanDeepNarrow.
+func BenchmarkScanDeepNarrowWalkDir(b *testing.B) {
+	tempDir := createDeepNarrowTree(b, 60)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := scanDirectories(tempDir, 100, true); err != nil {
+			b.Fatalf("scanDirectories failed: %v", err)
+		}
+	}
+}
+
 func BenchmarkFuzzyMatch(b *testing.B) {
 	// Create a realistic set of directories
 	directories := make([]string, 1000)
@@ -165,6 +220,32 @@ func BenchmarkIsWithinDepth(b *testing.B) {
 	}
 }
 
+// BenchmarkKeystrokeMatch compares the per-keystroke match cost on a 300k
+// directory list with and without sampling.
+func BenchmarkKeystrokeMatch(b *testing.B) {
+	directories := make([]string, 300000)
+	for i := range directories {
+		directories[i] = fmt.Sprintf("/home/user/projects/p%06d/src/components", i)
+	}
+
+	for _, threshold := range []int{0, 20000} {
+		b.Run(fmt.Sprintf("threshold-%d", threshold), func(b *testing.B) {
+			state := &uiState{directories: directories, config: TUIConfig{SampleThreshold: threshold}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				state.mu.Lock()
+				state.query = "comp"
+				state.rematch()
+				state.mu.Unlock()
+			}
+			b.StopTimer()
+			if state.fullMatch != nil {
+				state.fullMatch.Stop()
+			}
+		})
+	}
+}
+
 func BenchmarkFormatMatch(b *testing.B) {
 	matches := []string{
 		"/home/user/projects/webapp",
@@ -173,11 +254,122 @@ func BenchmarkFormatMatch(b *testing.B) {
 		"/home/user/documents/work",
 	}
 
+	b.Run("Cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, match := range matches {
+				formatMatch(fuzzy.Match{Str: match})
+			}
+		}
+	})
+
+	b.Run("Uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, match := range matches {
+				formatPath(match, homeDir())
+			}
+		}
+	})
+
+	// A screenful of distinct rows redrawn repeatedly, as while scrolling
+	rows := make([]string, 50)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("/home/user/projects/service-%02d/src", i)
+	}
+	b.Run("CachedRows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, row := range rows {
+				formatMatch(fuzzy.Match{Str: row})
+			}
+		}
+	})
+	b.Run("UncachedRows", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, row := range rows {
+				formatPath(row, homeDir())
+			}
+		}
+	})
+}
+
+// BenchmarkEndToEndFirstMatch measures the integrated path the TUI drives:
+// from starting a two-phase scan to the first non-empty match set for a query,
+// with batches fed through uiState.consume as they arrive. The fixture holds
+// 20 projects x 10 modules x 5 packages (1,220 directories) plus one target
+// that sorts last, so the number covers batching and incremental matching of
+// the whole local phase. The global phase is cancelled once a match appears.
+func BenchmarkEndToEndFirstMatch(b *testing.B) {
+	tempDir, err := os.MkdirTemp("", "cdf_benchmark_e2e")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 10; j++ {
+			for k := 0; k < 5; k++ {
+				dir := filepath.Join(tempDir, fmt.Sprintf("project%02d", i), fmt.Sprintf("module%d", j), fmt.Sprintf("pkg%d", k))
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					b.Fatalf("Failed to create test dir %s: %v", dir, err)
+				}
+			}
+		}
+	}
+	target := filepath.Join(tempDir, "zz-services", "deploy-service")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		b.Fatalf("Failed to create test dir %s: %v", target, err)
+	}
+
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		for _, match := range matches {
-			formatMatch(fuzzy.Match{Str: match})
+		ctx, cancel := context.WithCancel(context.Background())
+		state := &uiState{
+			query:     "deploysvc",
+			prevCount: -1,
+			config:    TUIConfig{SampleThreshold: 100000},
+		}
+		for batch := range scanTwoPhasesAsyncCtx(ctx, tempDir, 5, true, 50) {
+			state.consume(batch)
+			if len(state.matches) > 0 {
+				break
+			}
+		}
+		cancel()
+
+		if len(state.matches) == 0 || state.matches[0].Str != target {
+			b.Fatalf("Expected %s as the first match, got %v", target, state.matches)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// BenchmarkRenderSelectionChange measures moving the selection one row, as a
+// held arrow key does, with a full clear and redraw against the renderer's
+// targeted repaint of the two affected rows.
+func BenchmarkRenderSelectionChange(b *testing.B) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		b.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(200, 60)
+
+	matches := make([]fuzzy.Match, 1000)
+	for i := range matches {
+		matches[i] = fuzzy.Match{Str: fmt.Sprintf("/home/user/projects/dir%04d/src", i), Index: i}
+	}
+	view := displayView{Matches: matches, TotalDirs: len(matches), ScanComplete: true, PrevCount: -1}
+
+	b.Run("FullClear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			view.Selected = i % 2
+			updateDisplayAsync(screen, view)
+		}
+	})
+	b.Run("Targeted", func(b *testing.B) {
+		var frames renderer
+		for i := 0; i < b.N; i++ {
+			view.Selected = i % 2
+			frames.render(screen, view)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Limits for the clipboard commands, which can hang on a dead display or a
+// clipboard owner that never answers
+const (
+	clipboardTimeout  = time.Second            // A command is killed after this long
+	clipboardWaitGone = 100 * time.Millisecond // After a kill, how long children may keep stdin open
+)
+
+// clipboardCommands are tried in order when a local display is available
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip"},
+}
+
+// screenTerminal returns the terminal behind screen for OSC 52 sequences, or
+// nil when it has none; tests replace it to capture what is written
+var screenTerminal = func(screen tcell.Screen) io.Writer {
+	if tty, ok := screen.Tty(); ok && tty != nil {
+		return tty
+	}
+	return nil
+}
+
+// osc52Sequence builds the escape sequence asking the terminal to put text on
+// the system clipboard. Terminals without OSC 52 support simply ignore it.
+func osc52Sequence(text string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+// localDisplay reports whether cdf runs on the machine whose clipboard the
+// user sees, so a clipboard command reaches it
+func localDisplay() bool {
+	if os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// copyToClipboard puts text on the clipboard. With a local display the
+// clipboard commands come first, as their exit status says whether the copy
+// worked. Otherwise, or when none works, an OSC 52 sequence is written to
+// tty, which reaches the clipboard over SSH on terminals that support it;
+// viaTerminal reports that route, whose success can't be confirmed. tty must
+// be the screen's own terminal, written between frames.
+func copyToClipboard(text string, tty io.Writer) (viaTerminal bool, err error) {
+	local := localDisplay()
+	if local && runClipboardCommand(text) == nil {
+		return false, nil
+	}
+	if tty != nil {
+		if _, err := io.WriteString(tty, osc52Sequence(text)); err == nil {
+			return true, nil
+		}
+	}
+	if !local && runClipboardCommand(text) == nil {
+		return false, nil
+	}
+	return false, errors.New("no clipboard available")
+}
+
+// runClipboardCommand pipes text into the first clipboard command that is
+// installed and succeeds within clipboardTimeout
+func runClipboardCommand(text string) error {
+	for _, args := range clipboardCommands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		// xclip forks a child that keeps serving the selection
+		cmd.WaitDelay = clipboardWaitGone
+		err := cmd.Run()
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.New("no clipboard command worked")
+}
\ No newline at end of file
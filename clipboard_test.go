@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/sahilm/fuzzy"
+)
+
+func TestOSC52Sequence(t *testing.T) {
+	seq := osc52Sequence("/home/user/projects")
+
+	if !strings.HasPrefix(seq, "\x1b]52;c;") {
+		t.Errorf("Sequence has wrong prefix: %q", seq)
+	}
+	if !strings.HasSuffix(seq, "\a") {
+		t.Errorf("Sequence is not BEL terminated: %q", seq)
+	}
+
+	payload := strings.TrimSuffix(strings.TrimPrefix(seq, "\x1b]52;c;"), "\a")
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatalf("Payload is not valid base64: %v", err)
+	}
+	if string(decoded) != "/home/user/projects" {
+		t.Errorf("Decoded payload = %q, expected %q", decoded, "/home/user/projects")
+	}
+}
+
+// useFakeTTY captures what is written to the screen's terminal, as over SSH
+// where OSC 52 is the only route to the clipboard
+func useFakeTTY(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	t.Setenv("SSH_TTY", "/dev/pts/0")
+	tty := &bytes.Buffer{}
+	original := screenTerminal
+	screenTerminal = func(tcell.Screen) io.Writer { return tty }
+	t.Cleanup(func() { screenTerminal = original })
+	return tty
+}
+
+func TestCopySelectedPathKey(t *testing.T) {
+	tty := useFakeTTY(t)
+
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	defer screen.Fini()
+
+	state := &uiState{
+		matches:  []fuzzy.Match{{Str: "/srv/one"}, {Str: "/srv/two"}},
+		selected: 1,
+	}
+
+	result := handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlY, 0, tcell.ModCtrl), state, screen)
+	if result != 0 {
+		t.Errorf("Copy should not exit the TUI, got result %d", result)
+	}
+
+	if written := tty.String(); written != osc52Sequence("/srv/two") {
+		t.Errorf("Wrote %q to the terminal, expected the OSC 52 sequence for /srv/two", written)
+	}
+	if msg := state.view().StatusMsg; !strings.Contains(msg, "Sent to terminal clipboard: /srv/two") {
+		t.Errorf("Expected a confirmation naming the terminal route, got %q", msg)
+	}
+}
+
+func TestCopyQueryKey(t *testing.T) {
+	tty := useFakeTTY(t)
+
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	defer screen.Fini()
+
+	// An empty query copies nothing
+	state := &uiState{matches: []fuzzy.Match{{Str: "/srv/one"}}}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModAlt), state, screen)
+	if tty.Len() != 0 || state.view().StatusMsg != "" {
+		t.Errorf("Expected no copy for an empty query, wrote %q", tty.String())
+	}
+
+	state.query = "srv api"
+	result := handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, 'y', tcell.ModAlt), state, screen)
+	if result != 0 || state.query != "srv api" {
+		t.Errorf("Copy should neither exit nor edit the query, got result %d, query %q", result, state.query)
+	}
+
+	if written := tty.String(); written != osc52Sequence("srv api") {
+		t.Errorf("Wrote %q to the terminal, expected the OSC 52 sequence for the query", written)
+	}
+	if msg := state.view().StatusMsg; !strings.Contains(msg, "Sent query to terminal clipboard") {
+		t.Errorf("Expected a copy confirmation, got %q", msg)
+	}
+}
+
+func TestCopyPrefersLocalClipboardCommand(t *testing.T) {
+	tty := useFakeTTY(t)
+	t.Setenv("SSH_TTY", "")
+	t.Setenv("DISPLAY", ":0")
+
+	copied := filepath.Join(t.TempDir(), "clipboard")
+	original := clipboardCommands
+	clipboardCommands = [][]string{{"sh", "-c", "cat > " + copied}}
+	t.Cleanup(func() { clipboardCommands = original })
+
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	defer screen.Fini()
+
+	state := &uiState{matches: []fuzzy.Match{{Str: "/srv/one"}}}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlY, 0, tcell.ModCtrl), state, screen)
+
+	if written, err := os.ReadFile(copied); err != nil || string(written) != "/srv/one" {
+		t.Errorf("Expected the clipboard command to receive /srv/one, got %q (%v)", written, err)
+	}
+	if tty.Len() != 0 {
+		t.Errorf("Expected no OSC 52 sequence once the command worked, wrote %q", tty.String())
+	}
+	if msg := state.view().StatusMsg; !strings.Contains(msg, "Copied /srv/one") {
+		t.Errorf("Expected a copy confirmation, got %q", msg)
+	}
+
+	// Without a working command the terminal is the fallback
+	clipboardCommands = [][]string{{"false"}}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlY, 0, tcell.ModCtrl), state, screen)
+	if written := tty.String(); written != osc52Sequence("/srv/one") {
+		t.Errorf("Wrote %q to the terminal, expected the OSC 52 fallback", written)
+	}
+}
+
+func TestHungClipboardCommandTimesOutUnlocked(t *testing.T) {
+	tty := useFakeTTY(t)
+	t.Setenv("SSH_TTY", "")
+	t.Setenv("DISPLAY", ":0")
+
+	original := clipboardCommands
+	clipboardCommands = [][]string{{"sh", "-c", "sleep 10"}}
+	t.Cleanup(func() { clipboardCommands = original })
+
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	defer screen.Fini()
+
+	state := &uiState{matches: []fuzzy.Match{{Str: "/srv/one"}}}
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlY, 0, tcell.ModCtrl), state, screen)
+		close(done)
+	}()
+
+	// Scan batches can take the lock while the command hangs
+	locked := false
+	for deadline := time.Now().Add(clipboardTimeout / 2); !locked && time.Now().Before(deadline); {
+		if locked = state.mu.TryLock(); !locked {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if !locked {
+		t.Fatal("The state stayed locked while the clipboard command ran")
+	}
+	state.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(3 * clipboardTimeout):
+		t.Fatal("A hung clipboard command was never killed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*clipboardTimeout {
+		t.Errorf("Copy took %v with a %v timeout", elapsed, clipboardTimeout)
+	}
+	if written := tty.String(); written != osc52Sequence("/srv/one") {
+		t.Errorf("Wrote %q to the terminal, expected the OSC 52 fallback", written)
+	}
+}
\ No newline at end of file
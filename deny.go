@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// denylist holds the directories a deny file says never to show. Unlike the
+// ignore rules it is not tunable: --no-ignore and the palette leave it alone.
+type denylist struct {
+	Exact    map[string]bool // Left out on their own; their subdirectories still show
+	Subtrees []string        // Left out along with everything below them
+}
+
+// denyFile returns the default deny file, ~/.config/cdf/deny
+func denyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "deny"), nil
+}
+
+// loadDenylist reads a deny file: one absolute directory per line, with ~,
+// ~user and $VAR expanded; a trailing /** denies its whole subtree. Blank
+// lines and # comments are skipped. A missing file denies nothing.
+func loadDenylist(path string) (denylist, error) {
+	var deny denylist
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return deny, nil
+	}
+	if err != nil {
+		return deny, err
+	}
+	defer f.Close()
+	
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dir, subtree := strings.CutSuffix(line, "/**")
+		if !filepath.IsAbs(dir) && !strings.HasPrefix(dir, "~") && !strings.HasPrefix(dir, "$") {
+			return denylist{}, fmt.Errorf("%s:%d: %s is not an absolute path", path, lineNo, dir)
+		}
+		expanded, err := expandPath(dir)
+		if err != nil {
+			return denylist{}, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if subtree {
+			deny.Subtrees = append(deny.Subtrees, expanded)
+			continue
+		}
+		if deny.Exact == nil {
+			deny.Exact = make(map[string]bool)
+		}
+		deny.Exact[expanded] = true
+	}
+	return deny, scanner.Err()
+}
+
+// covers reports whether path is in a denied subtree, so the scan need not
+// descend into it
+func (d denylist) covers(path string) bool {
+	for _, dir := range d.Subtrees {
+		if isWithinPath(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// denies reports whether path must never be shown
+func (d denylist) denies(path string) bool {
+	return d.Exact[path] || d.covers(path)
+}
+
+// withoutDenied drops the denied directories from dirs, keeping modTimes in
+// step with them
+func (d denylist) withoutDenied(dirs []string, modTimes []time.Time) ([]string, []time.Time) {
+	if len(d.Exact) == 0 && len(d.Subtrees) == 0 {
+		return dirs, modTimes
+	}
+	keptDirs := make([]string, 0, len(dirs))
+	keptTimes := make([]time.Time, 0, len(modTimes))
+	for i, dir := range dirs {
+		if d.denies(dir) {
+			continue
+		}
+		keptDirs = append(keptDirs, dir)
+		if i < len(modTimes) {
+			keptTimes = append(keptTimes, modTimes[i])
+		}
+	}
+	return keptDirs, keptTimes
+}
\ No newline at end of file
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLoadDenylist(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("HOME", tempDir)
+
+	path := filepath.Join(tempDir, "deny")
+	content := "# private\n~/.password-store/**\n\n  /srv/backups  \n/srv/old/../tmp\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write deny file: %v", err)
+	}
+
+	deny, err := loadDenylist(path)
+	if err != nil {
+		t.Fatalf("loadDenylist failed: %v", err)
+	}
+	store := filepath.Join(tempDir, ".password-store")
+	for path, expected := range map[string]bool{
+		store:                       true,
+		filepath.Join(store, "web"): true,
+		"/srv/backups":              true,
+		"/srv/backups/daily":        false,
+		"/srv/tmp":                  true,
+		"/srv":                      false,
+		store + "-old":              false,
+	} {
+		if got := deny.denies(path); got != expected {
+			t.Errorf("denies(%s) = %v, expected %v", path, got, expected)
+		}
+	}
+
+	if deny, err := loadDenylist(filepath.Join(tempDir, "missing")); err != nil || deny.denies("/srv") {
+		t.Errorf("Expected a missing file to deny nothing, got %v, %v", deny, err)
+	}
+
+	// Relative entries would depend on where cdf starts
+	if err := os.WriteFile(path, []byte("/srv/backups\nsrc/secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write deny file: %v", err)
+	}
+	if _, err := loadDenylist(path); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("Expected an error for the relative entry on line 2, got %v", err)
+	}
+}
+
+func TestDenylistAppliesWithoutIgnores(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"keys/ssh", "project/.git", "project/secret/nested", "project/src"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	deny := denylist{
+		Exact:    map[string]bool{filepath.Join(root, "project/secret"): true},
+		Subtrees: []string{filepath.Join(root, "keys")},
+	}
+
+	for _, useIgnore := range []bool{true, false} {
+		for _, breadthFirst := range []bool{false, true} {
+			var found []string
+			for batch := range scanWithConfig(ScanConfig{
+				Root:              root,
+				MaxDepth:          5,
+				UseIgnorePatterns: useIgnore,
+				InitialBatchSize:  10,
+				MaxBatchSize:      10,
+				BreadthFirst:      breadthFirst,
+				Workers:           2,
+				Deny:              deny,
+			}) {
+				for _, dir := range batch.Directories {
+					found = append(found, strings.TrimPrefix(dir, root))
+				}
+			}
+			sort.Strings(found)
+
+			expected := "/project /project/secret/nested /project/src"
+			if !useIgnore {
+				expected = "/project /project/.git /project/secret/nested /project/src"
+			}
+			if got := strings.Join(found, " "); got != expected {
+				t.Errorf("UseIgnorePatterns %v, BreadthFirst %v: found %q, expected %q", useIgnore, breadthFirst, got, expected)
+			}
+		}
+	}
+
+	// A resumed session saved before the entries were added drops them too
+	saved := session{Directories: []string{filepath.Join(root, "keys"), filepath.Join(root, "project"), filepath.Join(root, "project/secret")}}
+	var resumed []string
+	for batch := range resumeSession(context.Background(), saved, root, ScanConfig{MaxDepth: 5, Deny: deny}) {
+		resumed = append(resumed, batch.Directories...)
+	}
+	if len(resumed) != 1 || resumed[0] != filepath.Join(root, "project") {
+		t.Errorf("Expected only the project from the resumed session, got %q", resumed)
+	}
+}
\ No newline at end of file
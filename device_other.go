@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// deviceID reports no device on platforms without stat device IDs, which
+// makes --one-filesystem a no-op there
+func deviceID(path string) (uint64, bool) {
+	return 0, false
+}
\ No newline at end of file
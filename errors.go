@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCancelled is returned by the finder when it is left without a
+// selection, e.g. with Escape or Ctrl+Q
+var ErrCancelled = errors.New("cancelled")
+
+// ErrScanRoot classifies the errors for a starting path that can't be
+// scanned: one that doesn't exist or can't be expanded, or / without
+// --allow-root
+var ErrScanRoot = errors.New("unusable scan root")
+
+// rootError is an ErrScanRoot with its own explanation
+type rootError struct {
+	msg string
+}
+
+func (e *rootError) Error() string        { return e.msg }
+func (e *rootError) Is(target error) bool { return target == ErrScanRoot }
+
+// scanRootError returns an ErrScanRoot explained by the formatted message
+func scanRootError(format string, args ...interface{}) error {
+	return &rootError{msg: fmt.Sprintf(format, args...)}
+}
+
+// scanError reports a scan that stopped before covering its tree, as carried
+// by the final DirBatch's Err. Path is the last directory visited and Op the
+// step that failed; Err is the cause, so errors.Is(err, context.Canceled)
+// tells a cancelled scan from a failed one.
+type scanError struct {
+	Path string
+	Op   string
+	Err  error
+}
+
+func (e *scanError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *scanError) Unwrap() error {
+	return e.Err
+}
\ No newline at end of file
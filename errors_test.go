@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestCancelledScanError(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		if err := os.MkdirAll(filepath.Join(tempDir, "dir", string(rune('a'+i)), "sub"), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	// A cancelled scan may drop its final batch rather than block on it,
+	// so scan until one delivers the error
+	var last DirBatch
+	for attempt := 0; attempt < 50 && last.Err == nil; attempt++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for batch := range scanWithConfigCtx(ctx, ScanConfig{Root: tempDir, MaxDepth: 5, InitialBatchSize: 1, MaxBatchSize: 1}) {
+			last = batch
+		}
+	}
+	if last.Err == nil {
+		t.Fatal("No cancelled scan reported its error")
+	}
+
+	if !errors.Is(last.Err, context.Canceled) {
+		t.Errorf("Expected the error to unwrap to context.Canceled, got %v", last.Err)
+	}
+	var scanErr *scanError
+	if !errors.As(last.Err, &scanErr) || scanErr.Op != "walk" || !strings.HasPrefix(scanErr.Path, tempDir) {
+		t.Errorf("Expected a walk scanError under %s, got %#v", tempDir, last.Err)
+	}
+	if errors.Is(last.Err, ErrCancelled) || errors.Is(last.Err, ErrScanRoot) {
+		t.Errorf("A cancelled scan was misclassified: %v", last.Err)
+	}
+}
+
+func TestScanErrorFormat(t *testing.T) {
+	cause := errors.New("boom")
+	err := error(&scanError{Path: "/srv", Op: "walk", Err: cause})
+	if err.Error() != "walk /srv: boom" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Expected scanError to unwrap to its cause")
+	}
+}
+
+func TestFinderCancelledError(t *testing.T) {
+	state := &uiState{}
+	if _, err := state.commitSelection(); !errors.Is(err, ErrCancelled) {
+		t.Errorf("Expected ErrCancelled without a selection, got %v", err)
+	}
+	if errors.Is(ErrCancelled, ErrScanRoot) || errors.Is(ErrCancelled, context.Canceled) {
+		t.Error("ErrCancelled should be distinct from the other errors")
+	}
+}
+
+func TestScanRootErrors(t *testing.T) {
+	err := checkScanRoot("/", false)
+	if !errors.Is(err, ErrScanRoot) {
+		t.Errorf("Expected ErrScanRoot refusing /, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "refusing to scan from /") {
+		t.Errorf("Expected the explanation kept as the message, got %q", err.Error())
+	}
+	if err := checkScanRoot("/", true); err != nil {
+		t.Errorf("Expected --allow-root to accept /, got %v", err)
+	}
+	if errors.Is(scanRootError("path does not exist: %s", "/nope"), ErrCancelled) {
+		t.Error("A root error was classified as a cancellation")
+	}
+}
+
+func TestEscapeExitsAsCancelled(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	dirChan := make(chan DirBatch, 1)
+	dirChan <- DirBatch{Directories: []string{"/srv/app"}, Done: true}
+	close(dirChan)
+	screen.InjectKey(tcell.KeyEscape, 0, tcell.ModNone)
+
+	_, err := runTUIOnScreen(context.Background(), screen, dirChan, TUIConfig{})
+	if !errors.Is(err, ErrCancelled) {
+		t.Fatalf("Expected Escape to end with ErrCancelled, got %v", err)
+	}
+	if code := finderExitCode(err); code != exitCancelled {
+		t.Errorf("Expected exit code %d for a cancellation, got %d", exitCancelled, code)
+	}
+
+	// Detected by identity, not by message, so wrapping keeps it and a
+	// look-alike message does not pass for it
+	if code := finderExitCode(fmt.Errorf("finder: %w", ErrCancelled)); code != exitCancelled {
+		t.Errorf("Expected a wrapped ErrCancelled to exit %d, got %d", exitCancelled, code)
+	}
+	if code := finderExitCode(errors.New("cancelled")); code != 1 {
+		t.Errorf("Expected an unrelated error to exit 1, got %d", code)
+	}
+	if code := finderExitCode(context.DeadlineExceeded); code != exitCancelled {
+		t.Errorf("Expected --max-runtime running out to exit %d, got %d", exitCancelled, code)
+	}
+}
\ No newline at end of file
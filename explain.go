@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// matchExplanation breaks a match's rank down into the contributions of the
+// ranking steps, for --explain
+type matchExplanation struct {
+	Fuzzy    int     // Raw fuzzy score
+	Tail     int     // Points for matching in the last TailWeight segments
+	Frecency float64 // Frecency boost blended into the score, if any
+	Blended  bool    // Frecency took part in the ranking
+	Initials int     // Initials alignment score, with --algo initials
+	Aligned  bool    // The query spells the path's component initials
+	Repo     bool    // Ranked ahead of equal scores as a repository root
+	Pinned   bool    // Pinned to the top of the list
+	Score    float64 // Final composite score the matches are sorted by
+}
+
+// explain reconstructs how postProcess ranked match, from the same inputs;
+// the caller must hold a lock
+func (s *uiState) explain(match fuzzy.Match) matchExplanation {
+	e := matchExplanation{Fuzzy: match.Score, Score: float64(match.Score)}
+	browsing := s.query == "" && s.locked == ""
+	if !browsing && s.config.TailWeight > 0 {
+		// Already part of the score postProcess left on match
+		key := match.Str
+		if s.keys != nil {
+			key = s.keys[match.Index]
+		}
+		e.Tail = tailBoost(key, match.MatchedIndexes, s.config.TailWeight)
+		e.Fuzzy -= e.Tail
+	}
+	if !browsing && s.config.FrecencyWeight != 0 && len(s.config.Frecency) > 0 {
+		e.Blended = true
+		e.Frecency = frecencyBoost(match.Str, s.config.Frecency, s.config.FrecencyWeight)
+		e.Score += e.Frecency
+	}
+	if !browsing && s.config.Algo == algoInitials {
+		query := s.query
+		if query == "" {
+			query = s.locked
+		}
+		e.Initials, e.Aligned = initialsScore(s.config.searchQuery(query), match.Str)
+	}
+	e.Repo = s.config.PreferRepos && s.repos[match.Str]
+	for _, pin := range s.pins {
+		if pin == match.Str {
+			e.Pinned = true
+			break
+		}
+	}
+	return e
+}
+
+// String lists the contributions that applied, ending with the final score,
+// e.g. "fuzzy=42 frecency=+5.00 repo score=47.00"
+func (e matchExplanation) String() string {
+	parts := []string{fmt.Sprintf("fuzzy=%d", e.Fuzzy)}
+	if e.Tail != 0 {
+		parts = append(parts, fmt.Sprintf("tail=%+d", e.Tail))
+	}
+	if e.Blended {
+		parts = append(parts, fmt.Sprintf("frecency=%+.2f", e.Frecency))
+	}
+	if e.Aligned {
+		parts = append(parts, fmt.Sprintf("initials=%d", e.Initials))
+	}
+	if e.Repo {
+		parts = append(parts, "repo")
+	}
+	if e.Pinned {
+		parts = append(parts, "pinned")
+	}
+	parts = append(parts, fmt.Sprintf("score=%.2f", e.Score))
+	return strings.Join(parts, " ")
+}
\ No newline at end of file
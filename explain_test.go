@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplainComponents(t *testing.T) {
+	directories := []string{"/work/api-server", "/srv/alpha/server", "/work/apis"}
+	config := TUIConfig{
+		Frecency:       map[string]float64{"/work/apis": 1, "/work/api-server": 0.5},
+		FrecencyWeight: 10,
+		Algo:           algoInitials,
+		PreferRepos:    true,
+	}
+	state := &uiState{config: config, repos: map[string]bool{"/work/apis": true}, pins: []string{"/srv/alpha/server"}}
+	state.addDirectories(directories)
+	state.query = "as"
+	state.rematch()
+
+	explanations := make(map[string]matchExplanation)
+	for _, match := range state.matches {
+		explanations[match.Str] = state.explain(match)
+	}
+
+	apis := explanations["/work/apis"]
+	if !apis.Blended || apis.Frecency != 10 || !apis.Repo || apis.Pinned {
+		t.Errorf("Unexpected breakdown for /work/apis: %+v", apis)
+	}
+	if apis.Score != float64(apis.Fuzzy)+10 {
+		t.Errorf("Composite score %.2f, expected fuzzy %d plus the frecency boost", apis.Score, apis.Fuzzy)
+	}
+	alpha := explanations["/srv/alpha/server"]
+	if !alpha.Aligned || !alpha.Pinned || alpha.Frecency != 0 {
+		t.Errorf("Unexpected breakdown for /srv/alpha/server: %+v", alpha)
+	}
+
+	text := apis.String()
+	for _, part := range []string{"fuzzy=", "frecency=+10.00", "repo", "score="} {
+		if !strings.Contains(text, part) {
+			t.Errorf("Explanation %q lacks %q", text, part)
+		}
+	}
+	if strings.Contains(text, "pinned") || strings.Contains(text, "initials=") {
+		t.Errorf("Explanation %q lists contributions that did not apply", text)
+	}
+	if text := alpha.String(); !strings.Contains(text, "initials=") || !strings.Contains(text, "pinned") {
+		t.Errorf("Explanation %q lacks the initials and pinned contributions", text)
+	}
+}
+
+func TestRunQueriesExplain(t *testing.T) {
+	directories := []string{"/srv/api", "/home/user/api"}
+	config := TUIConfig{Frecency: map[string]float64{"/home/user/api": 1}, FrecencyWeight: 10}
+	var out bytes.Buffer
+	format := func(path string) string { return path }
+	if err := runQueries(&out, []string{"api"}, directories, config, 2, format, true); err != nil {
+		t.Fatalf("runQueries failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", out.String())
+	}
+	// The frecency boost lifts the home directory first despite its longer path
+	fields := strings.Split(lines[0], "\t")
+	if len(fields) != 3 || fields[1] != "/home/user/api" {
+		t.Fatalf("Unexpected first line %q", lines[0])
+	}
+	if !strings.Contains(fields[2], "frecency=+10.00") || !strings.HasPrefix(fields[2], "fuzzy=") {
+		t.Errorf("Unexpected explanation %q", fields[2])
+	}
+	if fields := strings.Split(lines[1], "\t"); len(fields) != 3 || !strings.Contains(fields[2], "frecency=+0.00") {
+		t.Errorf("Unexpected second line %q", lines[1])
+	}
+}
\ No newline at end of file
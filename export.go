@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// exportFile returns the default file Ctrl+E writes the results to,
+// ~/.cache/cdf/last-results
+func exportFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "last-results"), nil
+}
+
+// exportResults writes the absolute path of every match to path, one per
+// line in list order, replacing any earlier export atomically
+func exportResults(path string, matches []fuzzy.Match) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".last-results-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	
+	w := bufio.NewWriter(tmp)
+	for _, match := range matches {
+		dir := match.Str
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		fmt.Fprintln(w, dir)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
\ No newline at end of file
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/sahilm/fuzzy"
+)
+
+func TestExportResults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "cdf", "last-results")
+	matches := []fuzzy.Match{{Str: "/srv/app/src"}, {Str: "/home/me/notes"}, {Str: "/srv/app"}}
+
+	if err := exportResults(path, matches); err != nil {
+		t.Fatalf("exportResults failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the export: %v", err)
+	}
+	if expected := "/srv/app/src\n/home/me/notes\n/srv/app\n"; string(data) != expected {
+		t.Errorf("Export holds %q, expected %q", data, expected)
+	}
+
+	// A later export replaces the earlier one, and an empty list empties it
+	if err := exportResults(path, nil); err != nil {
+		t.Fatalf("exportResults failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("Expected an empty export, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left behind, got %v", entries)
+	}
+}
+
+func TestCtrlEExportsCurrentMatches(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	path := filepath.Join(t.TempDir(), "results")
+	state := &uiState{
+		directories: []string{"/srv/api", "/srv/web", "/home/me/api-notes"},
+		config:      TUIConfig{ExportPath: path},
+	}
+	state.query = "api"
+	state.rematch()
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlE, 0, tcell.ModNone), state, screen)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected Ctrl+E to write %s: %v", path, err)
+	}
+	var expected []string
+	for _, match := range state.matches {
+		expected = append(expected, match.Str)
+	}
+	if got := strings.TrimSuffix(string(data), "\n"); got != strings.Join(expected, "\n") || len(expected) != 2 {
+		t.Errorf("Expected the 2 current matches %q, got %q", expected, got)
+	}
+	if !strings.Contains(state.statusMsg, "Exported 2") {
+		t.Errorf("Expected a confirmation in the status bar, got %q", state.statusMsg)
+	}
+}
\ No newline at end of file
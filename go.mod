@@ -5,6 +5,7 @@ go 1.24.5
 require (
 	github.com/codinganovel/autocd-go v0.1.7
 	github.com/gdamore/tcell/v2 v2.7.0
+	github.com/mattn/go-runewidth v0.0.15
 	github.com/sahilm/fuzzy v0.1.1
 )
 
@@ -12,7 +13,6 @@ require (
 	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
-	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.4.3 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/term v0.15.0 // indirect
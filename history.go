@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyHeader identifies the history file format
+const historyHeader = "cdf-history 1"
+
+// historyEntry records how often and how recently a directory was selected
+type historyEntry struct {
+	Visits int
+	Last   time.Time
+}
+
+// historyFile returns where selections are recorded
+func historyFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "history"), nil
+}
+
+// loadHistory reads the history at path. A missing file is an empty history;
+// malformed lines are skipped.
+func loadHistory(path string) (map[string]historyEntry, error) {
+	entries := make(map[string]historyEntry)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != historyHeader {
+		return entries, scanner.Err()
+	}
+	for scanner.Scan() {
+		// visits \t last-unix \t path
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		visits, err1 := strconv.Atoi(fields[0])
+		last, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || visits <= 0 {
+			continue
+		}
+		entries[fields[2]] = historyEntry{Visits: visits, Last: time.Unix(last, 0)}
+	}
+	return entries, scanner.Err()
+}
+
+// saveHistory writes entries to path, replacing the old file atomically
+func saveHistory(path string, entries map[string]historyEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintln(w, historyHeader)
+	for dir, entry := range entries {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", entry.Visits, entry.Last.Unix(), dir)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// recordVisit adds a selection of dir at now to the history at path
+func recordVisit(path, dir string, now time.Time) error {
+	entries, err := loadHistory(path)
+	if err != nil {
+		return err
+	}
+	entry := entries[dir]
+	entry.Visits++
+	entry.Last = now
+	entries[dir] = entry
+	return saveHistory(path, entries)
+}
+
+// frecency scores each entry by visits weighted for recency, the way z and
+// zoxide do, scaled so the top entry scores 1
+func frecency(entries map[string]historyEntry, now time.Time) map[string]float64 {
+	scores := make(map[string]float64, len(entries))
+	best := 0.0
+	for dir, entry := range entries {
+		var factor float64
+		switch age := now.Sub(entry.Last); {
+		case age < time.Hour:
+			factor = 4
+		case age < 24*time.Hour:
+			factor = 2
+		case age < 7*24*time.Hour:
+			factor = 0.5
+		default:
+			factor = 0.25
+		}
+		score := float64(entry.Visits) * factor
+		scores[dir] = score
+		if score > best {
+			best = score
+		}
+	}
+	for dir := range scores {
+		scores[dir] /= best
+	}
+	return scores
+}
\ No newline at end of file
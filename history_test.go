@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sahilm/fuzzy"
+)
+
+func TestRecordVisitRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "history")
+	now := time.Now().Truncate(time.Second)
+
+	// A missing history is simply empty
+	entries, err := loadHistory(path)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected an empty history, got %v, %v", entries, err)
+	}
+
+	for _, dir := range []string{"/work/api", "/work/web", "/work/api"} {
+		if err := recordVisit(path, dir, now); err != nil {
+			t.Fatalf("recordVisit failed: %v", err)
+		}
+	}
+	entries, err = loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory failed: %v", err)
+	}
+	if got := entries["/work/api"]; got.Visits != 2 || !got.Last.Equal(now) {
+		t.Errorf("Unexpected entry for /work/api: %+v", got)
+	}
+	if got := entries["/work/web"]; got.Visits != 1 {
+		t.Errorf("Unexpected entry for /work/web: %+v", got)
+	}
+}
+
+func TestLoadHistorySkipsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	content := historyHeader + "\n3\t100\t/ok\nnot a line\nx\t100\t/bad\n2\t100\t/with\ttab\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+
+	entries, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory failed: %v", err)
+	}
+	if len(entries) != 2 || entries["/ok"].Visits != 3 || entries["/with\ttab"].Visits != 2 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestFrecency(t *testing.T) {
+	now := time.Now()
+	scores := frecency(map[string]historyEntry{
+		"/recent": {Visits: 2, Last: now.Add(-time.Minute)},         // 8
+		"/often":  {Visits: 10, Last: now.Add(-48 * time.Hour)},     // 5
+		"/old":    {Visits: 8, Last: now.Add(-30 * 24 * time.Hour)}, // 2
+	}, now)
+
+	if scores["/recent"] != 1 || scores["/often"] != 5.0/8 || scores["/old"] != 2.0/8 {
+		t.Errorf("Unexpected frecency scores: %v", scores)
+	}
+}
+
+func TestBlendFrecencyReranks(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "history")
+	for i := 0; i < 5; i++ {
+		if err := recordVisit(path, "/work/apps/api-server", now); err != nil {
+			t.Fatalf("recordVisit failed: %v", err)
+		}
+	}
+	if err := recordVisit(path, "/work/apx", now); err != nil {
+		t.Fatalf("recordVisit failed: %v", err)
+	}
+	entries, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("loadHistory failed: %v", err)
+	}
+	scores := frecency(entries, now)
+
+	matches := []fuzzy.Match{
+		{Str: "/srv/api", Score: 40},
+		{Str: "/work/apx", Score: 35},
+		{Str: "/work/apps/api-server", Score: 32},
+		{Str: "/tmp/api", Score: 10},
+	}
+	order := func(matches []fuzzy.Match) []string {
+		var paths []string
+		for _, m := range matches {
+			paths = append(paths, m.Str)
+		}
+		return paths
+	}
+
+	// Zero weight keeps the fuzzy order exactly
+	if got := blendFrecency(matches, scores, 0); &got[0] != &matches[0] {
+		t.Error("Expected a zero weight to leave the matches untouched")
+	}
+
+	// The often visited directory gains 10 points, the once visited one 2
+	got := order(blendFrecency(matches, scores, 10))
+	expected := []string{"/work/apps/api-server", "/srv/api", "/work/apx", "/tmp/api"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Blended order = %v, expected %v", got, expected)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// projectMarkers maps directory types to the files that identify them, in
+// order of precedence: a Go module that is also a git repository shows as Go
+var projectMarkers = []struct {
+	Type  string
+	Files []string
+}{
+	{"go", []string{"go.mod"}},
+	{"rust", []string{"Cargo.toml"}},
+	{"node", []string{"package.json"}},
+	{"python", []string{"pyproject.toml", "setup.py", "requirements.txt"}},
+	{"ruby", []string{"Gemfile"}},
+	{"java", []string{"pom.xml", "build.gradle", "build.gradle.kts"}},
+	{"git", []string{".git"}},
+}
+
+// defaultIcons are the icons for each directory type; "dir" is the fallback
+var defaultIcons = map[string]string{
+	"dir":    "📁",
+	"git":    "🌱",
+	"go":     "🐹",
+	"rust":   "🦀",
+	"node":   "📦",
+	"python": "🐍",
+	"ruby":   "💎",
+	"java":   "☕",
+}
+
+// detectProjectType returns the type of the first marker found in dir, or ""
+// for a plain directory
+func detectProjectType(dir string) string {
+	for _, marker := range projectMarkers {
+		for _, file := range marker.Files {
+			if _, err := os.Lstat(filepath.Join(dir, file)); err == nil {
+				return marker.Type
+			}
+		}
+	}
+	return ""
+}
+
+// iconCache remembers detected directory types so each directory is only
+// probed the first time it is drawn
+type iconCache struct {
+	mu    sync.Mutex
+	types map[string]string
+}
+
+// typeOf returns the cached type of dir, detecting it on first use
+func (c *iconCache) typeOf(dir string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if kind, ok := c.types[dir]; ok {
+		return kind
+	}
+	if c.types == nil {
+		c.types = make(map[string]string)
+	}
+	kind := detectProjectType(dir)
+	c.types[dir] = kind
+	return kind
+}
+
+// parseIconSpecs overlays type=icon specs on the default icon map
+func parseIconSpecs(specs []string) (map[string]string, error) {
+	icons := make(map[string]string, len(defaultIcons))
+	for kind, icon := range defaultIcons {
+		icons[kind] = icon
+	}
+	for _, spec := range specs {
+		kind, icon, ok := strings.Cut(spec, "=")
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("invalid icon %q, expected type=icon", spec)
+		}
+		icons[kind] = icon
+	}
+	return icons, nil
+}
+
+// iconFor returns the icon for a directory type, falling back to "dir"
+func iconFor(icons map[string]string, kind string) string {
+	if icon, ok := icons[kind]; ok && kind != "" {
+		return icon
+	}
+	return icons["dir"]
+}
\ No newline at end of file
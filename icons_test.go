@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectProjectType(t *testing.T) {
+	tempDir := t.TempDir()
+
+	fixtures := map[string][]string{
+		"goproj":   {"go.mod", ".git/"},
+		"rustproj": {"Cargo.toml"},
+		"webapp":   {"package.json", "src/"},
+		"pyproj":   {"requirements.txt"},
+		"repo":     {".git/", "README.md"},
+		"plain":    {"notes.txt"},
+		"empty":    nil,
+	}
+	for dir, entries := range fixtures {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create fixture %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(tempDir, dir, entry)
+			var err error
+			if entry[len(entry)-1] == '/' {
+				err = os.MkdirAll(path, 0755)
+			} else {
+				err = os.WriteFile(path, nil, 0644)
+			}
+			if err != nil {
+				t.Fatalf("Failed to create %s: %v", path, err)
+			}
+		}
+	}
+
+	expected := map[string]string{
+		"goproj":   "go", // The language wins over the repository
+		"rustproj": "rust",
+		"webapp":   "node",
+		"pyproj":   "python",
+		"repo":     "git",
+		"plain":    "",
+		"empty":    "",
+	}
+	for dir, kind := range expected {
+		if got := detectProjectType(filepath.Join(tempDir, dir)); got != kind {
+			t.Errorf("detectProjectType(%s) = %q, expected %q", dir, got, kind)
+		}
+	}
+
+	// The cache answers from memory once a directory has been probed
+	var cache iconCache
+	dir := filepath.Join(tempDir, "rustproj")
+	if cache.typeOf(dir) != "rust" {
+		t.Fatal("Expected rust from the cache's first lookup")
+	}
+	os.Remove(filepath.Join(dir, "Cargo.toml"))
+	if cache.typeOf(dir) != "rust" {
+		t.Error("Expected the cached type on the second lookup")
+	}
+}
+
+func TestParseIconSpecs(t *testing.T) {
+	icons, err := parseIconSpecs([]string{"go=G", "dir=-", "zig=Z"})
+	if err != nil {
+		t.Fatalf("parseIconSpecs failed: %v", err)
+	}
+	if icons["go"] != "G" || icons["dir"] != "-" || icons["zig"] != "Z" || icons["rust"] != defaultIcons["rust"] {
+		t.Errorf("Unexpected icon map: %v", icons)
+	}
+	if iconFor(icons, "") != "-" || iconFor(icons, "unknown") != "-" {
+		t.Error("Plain and unknown types should fall back to the dir icon")
+	}
+
+	if _, err := parseIconSpecs([]string{"go"}); err == nil {
+		t.Error("Expected an error for a spec without =")
+	}
+}
\ No newline at end of file
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRules holds every rule that decides whether a directory is skipped
+// during a scan
+type ignoreRules struct {
+	// Builtin applies the built-in list (.git, node_modules, ...)
+	Builtin bool
+	// Patterns are user rules evaluated after the built-in list, gitignore
+	// style: a bare name matches a directory at any level, a pattern with "/"
+	// matches the path relative to the scan root ("**" spans any number of
+	// segments), and a leading "!" re-includes what earlier rules ignored.
+	// The last matching rule wins.
+	Patterns []string
+	// SkipHidden skips every directory whose name starts with a dot. It is
+	// independent of Builtin and Patterns: turning those off keeps dot
+	// directories out, and no "!" rule brings one back.
+	SkipHidden bool
+}
+
+// isIgnored reports whether the directory at relPath, relative to the scan
+// root, is skipped under cfg. It is the single ignore decision used by the
+// scanner.
+func isIgnored(relPath string, cfg ignoreRules) bool {
+	relPath = strings.Trim(filepath.ToSlash(relPath), "/")
+	if relPath == "" || relPath == "." {
+		return false
+	}
+	name := path.Base(relPath)
+	if cfg.SkipHidden && isHidden(name) {
+		return true
+	}
+	
+	ignored := cfg.Builtin && shouldIgnore(name)
+	for _, pattern := range cfg.Patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if negate == ignored && matchIgnorePattern(strings.TrimPrefix(pattern, "!"), relPath, name) {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
+
+// isHidden reports whether a directory name marks it hidden, as dot
+// directories are by convention
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// ignoreFileName is the per-directory ignore file read from the starting path
+const ignoreFileName = ".cdfignore"
+
+// globalIgnoreFile returns where the user's ignore patterns for every scan
+// are kept
+func globalIgnoreFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "ignore"), nil
+}
+
+// readIgnoreFile reads patterns one per line, skipping blank lines and #
+// comments. A missing file holds no patterns.
+func readIgnoreFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// loadIgnorePatterns collects the user patterns for a scan from root: the
+// global ignore file, then root's .cdfignore, then extra (--ignore flags).
+// Later patterns win, so a flag can re-include what a file ignores.
+func loadIgnorePatterns(root string, extra []string) ([]string, error) {
+	var files []string
+	if global, err := globalIgnoreFile(); err == nil {
+		files = append(files, global)
+	}
+	files = append(files, filepath.Join(root, ignoreFileName))
+	
+	var patterns []string
+	for _, file := range files {
+		filePatterns, err := readIgnoreFile(file)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	return append(patterns, extra...), nil
+}
+
+// relativeTo returns path relative to root without the allocation-heavy
+// filepath.Rel; path must be root or lie beneath it, as walk paths do
+func relativeTo(root, path string) string {
+	rel := strings.TrimPrefix(path, root)
+	return strings.TrimPrefix(rel, string(filepath.Separator))
+}
+
+func matchIgnorePattern(pattern, relPath, name string) bool {
+	pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+	if pattern == "" {
+		return false
+	}
+	
+	if !strings.Contains(pattern, "/") {
+		matched, err := path.Match(pattern, name)
+		return err == nil && matched
+	}
+	
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	
+	if len(segments) == 0 {
+		return false
+	}
+	
+	matched, err := path.Match(pattern[0], segments[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
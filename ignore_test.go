@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIsIgnored(t *testing.T) {
+	builtin := ignoreRules{Builtin: true}
+
+	testCases := []struct {
+		name     string
+		relPath  string
+		cfg      ignoreRules
+		expected bool
+	}{
+		// Built-in list
+		{"BuiltinTopLevel", "node_modules", builtin, true},
+		{"BuiltinNested", "web/node_modules", builtin, true},
+		{"BuiltinDisabled", "node_modules", ignoreRules{}, false},
+		{"RegularDir", "src", builtin, false},
+		{"EmptyPath", "", builtin, false},
+
+		// Custom bare names match at any level
+		{"CustomName", "lib/generated", ignoreRules{Patterns: []string{"generated"}}, true},
+		{"CustomNameNoMatch", "lib/generator", ignoreRules{Patterns: []string{"generated"}}, false},
+
+		// Globs
+		{"GlobName", "tmp-build", ignoreRules{Patterns: []string{"tmp-*"}}, true},
+		{"GlobChildren", "test/fixtures/one", ignoreRules{Patterns: []string{"test/fixtures/*"}}, true},
+		{"GlobChildrenNotParent", "test/fixtures", ignoreRules{Patterns: []string{"test/fixtures/*"}}, false},
+		{"DoubleStarAnyLevel", "a/b/src/generated", ignoreRules{Patterns: []string{"**/src/generated"}}, true},
+		{"DoubleStarZeroLevels", "src/generated", ignoreRules{Patterns: []string{"**/src/generated"}}, true},
+
+		// Path-scoped patterns are anchored at the scan root
+		{"PathScoped", "src/generated", ignoreRules{Patterns: []string{"src/generated"}}, true},
+		{"PathScopedLeadingSlash", "src/generated", ignoreRules{Patterns: []string{"/src/generated"}}, true},
+		{"PathScopedTrailingSlash", "src/generated", ignoreRules{Patterns: []string{"src/generated/"}}, true},
+		{"PathScopedOtherParent", "lib/generated", ignoreRules{Patterns: []string{"src/generated"}}, false},
+		{"PathScopedNotAnchoredDeeper", "a/src/generated", ignoreRules{Patterns: []string{"src/generated"}}, false},
+
+		// Unignore rules
+		{"UnignoreBuiltin", "build", ignoreRules{Builtin: true, Patterns: []string{"!build"}}, false},
+		{"UnignoreBuiltinOthersStay", "dist", ignoreRules{Builtin: true, Patterns: []string{"!build"}}, true},
+		{"UnignoreCustom", "keep/generated", ignoreRules{Patterns: []string{"generated", "!keep/generated"}}, false},
+		{"UnignoreCustomOthersStay", "lib/generated", ignoreRules{Patterns: []string{"generated", "!keep/generated"}}, true},
+		{"LastRuleWins", "lib/generated", ignoreRules{Patterns: []string{"!generated", "generated"}}, true},
+		{"UnignoreWithoutIgnore", "src", ignoreRules{Patterns: []string{"!src"}}, false},
+
+		// Hidden directories are a separate axis
+		{"HiddenKeptByDefault", "home/.config", builtin, false},
+		{"HiddenSkipped", "home/.config", ignoreRules{SkipHidden: true}, true},
+		{"HiddenSkippedNotUnignored", ".config", ignoreRules{SkipHidden: true, Patterns: []string{"!.config"}}, true},
+		{"HiddenAloneKeepsBuiltin", "node_modules", ignoreRules{SkipHidden: true}, false},
+		{"HiddenIncludedBuiltinStays", ".git", builtin, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := isIgnored(tc.relPath, tc.cfg)
+			if result != tc.expected {
+				t.Errorf("isIgnored(%q, %+v) = %v, expected %v", tc.relPath, tc.cfg, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	testCases := []struct {
+		root, path, expected string
+	}{
+		{"/home/user", "/home/user/src", "src"},
+		{"/home/user", "/home/user/src/api", "src/api"},
+		{"/", "/etc", "etc"},
+		{"/home/user", "/home/user", ""},
+	}
+
+	for _, tc := range testCases {
+		if got := relativeTo(tc.root, tc.path); got != tc.expected {
+			t.Errorf("relativeTo(%q, %q) = %q, expected %q", tc.root, tc.path, got, tc.expected)
+		}
+	}
+}
+
+func TestLoadIgnorePatterns(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	root := t.TempDir()
+
+	// No files: just the flags
+	patterns, err := loadIgnorePatterns(root, []string{"!build"})
+	if err != nil || strings.Join(patterns, " ") != "!build" {
+		t.Fatalf("Expected only the flag pattern, got %v, %v", patterns, err)
+	}
+
+	global, err := globalIgnoreFile()
+	if err != nil {
+		t.Fatalf("globalIgnoreFile failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(global), 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(global, []byte("# everywhere\ntmp-*\n\n"), 0644); err != nil {
+		t.Fatalf("Failed to write global ignore: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ignoreFileName), []byte("src/gen\n  build  \n"), 0644); err != nil {
+		t.Fatalf("Failed to write .cdfignore: %v", err)
+	}
+
+	patterns, err = loadIgnorePatterns(root, []string{"!build"})
+	if err != nil {
+		t.Fatalf("loadIgnorePatterns failed: %v", err)
+	}
+	if got := strings.Join(patterns, " "); got != "tmp-* src/gen build !build" {
+		t.Errorf("Expected global, local, then flag patterns, got %q", got)
+	}
+}
+
+func TestHiddenIndependentOfIgnoreList(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{".config/nvim", ".git/hooks", "node_modules/pkg", "src"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+	scan := func(useIgnore, skipHidden bool) string {
+		config := ScanConfig{
+			Root:              tempDir,
+			MaxDepth:          5,
+			UseIgnorePatterns: useIgnore,
+			InitialBatchSize:  10,
+			MaxBatchSize:      10,
+			SkipHidden:        skipHidden,
+		}
+		var dirs []string
+		for batch := range scanWithConfig(config) {
+			for _, dir := range batch.Directories {
+				dirs = append(dirs, strings.TrimPrefix(dir, tempDir+"/"))
+			}
+		}
+		sort.Strings(dirs)
+		return strings.Join(dirs, " ")
+	}
+
+	// Hidden directories included, the ignore list still applied
+	if got := scan(true, false); got != ".config .config/nvim src" {
+		t.Errorf("Expected .config but neither .git nor node_modules, got %q", got)
+	}
+	// Hidden directories skipped, with the ignore list off
+	if got := scan(false, true); got != "node_modules node_modules/pkg src" {
+		t.Errorf("Expected node_modules but no dot directories, got %q", got)
+	}
+}
\ No newline at end of file
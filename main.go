@@ -2,26 +2,128 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/codinganovel/autocd-go"
 )
 
 const version = "1.0.0"
 
+// stringList is a flag.Value that collects every occurrence of a repeatable flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
 	var (
-		depth     = flag.Int("depth", 5, "Maximum scan depth")
+		depth     = flag.Int("depth", 6, "Maximum scan depth: how many levels below the starting directory to list (see --depth-base)")
+		depthBase = flag.Int("depth-base", 1, "The level --depth counts the starting directory's children as: 1 (--depth 1 lists just them) or 0")
 		noIgnore  = flag.Bool("no-ignore", false, "Disable ignore patterns")
+		writable  = flag.Bool("writable-only", false, "Leave out directories you can't write to (Unix only)")
+		dimRO     = flag.Bool("dim-readonly", false, "Grey out directories you can't write to (Unix only)")
+		hidden    = flag.Bool("hidden", true, "Include hidden (dot) directories; --hidden=false skips them whatever the ignore rules say")
 		debug     = flag.Bool("debug", false, "Enable debug output")
+		trace     = flag.Bool("trace", false, "Write the timing and directory count of each scan phase to stderr")
 		showHelp  = flag.Bool("help", false, "Show usage information")
 		showVer   = flag.Bool("version", false, "Show version information")
+		compact   = flag.Bool("compact", false, "Use a compact layout with more result rows")
+		borders   = flag.Bool("borders", false, "Separate prompt, results and status bar with rules instead of blank rows")
+		reverse   = flag.Bool("reverse", false, "Show the prompt at the bottom with results above it")
+		scanTime  = flag.Duration("max-scan-time", 0, "Soft scan budget after which results are presented as settled")
+		sampleAt  = flag.Int("sample-threshold", 100000, "Directory count above which typing matches a sample first (0 disables)")
+		waitScan  = flag.Bool("wait-for-scan", false, "Hold Enter briefly while scanning; press again to force")
+		translit  = flag.Bool("translit", false, "Match Cyrillic, Greek and accented names by their Latin spelling")
+		ignSegs   = flag.String("ignore-segments", "", "Comma-separated path components left out of matching (e.g. src,app,internal)")
+		maxResult = flag.Int("max-results", 0, "Keep only the best N matches (0 for unlimited)")
+		countHint = flag.Bool("count-hint", false, "Show the live match count next to the prompt")
+		hotWindow = flag.Duration("highlight-recent", 0, "Mark directories modified within this window (e.g. 24h)")
+		ageColors = flag.Bool("age-colors", false, "Shade results from bright to dim by modification age")
+		ageSteps  = flag.String("age-steps", defaultAgeSteps, "With --age-colors, the ascending ages where shading dims a step")
+		autoSel   = flag.Duration("auto-select", 0, "After the scan, select a lone match once idle this long (e.g. 2s)")
+		maxRun    = flag.Duration("max-runtime", 0, "Exit as cancelled if nothing is selected within this long (e.g. 5m)")
+		bfs       = flag.Bool("bfs", false, "Scan breadth-first so shallow directories appear first")
+		matchLink = flag.Bool("match-symlink-target", false, "List symlinked directories and match them by their target path too")
+		abbrev    = flag.Bool("match-abbrev", false, "Also match each directory by its abbreviated form, e.g. ~/p/w/s for ~/projects/webapp/src")
+		acceptQry = flag.Bool("accept-query", false, "Enter with no matches selects the query if it is an existing directory")
+		allowRoot = flag.Bool("allow-root", false, "Allow starting the scan at the filesystem root")
+		group     = flag.Bool("group", false, "Group results under their top-level directory")
+		perPrefix = flag.Int("max-per-prefix", 0, "Show at most n matches under each top-level directory, for a more varied list (0: no limit)")
+		prefixDep = flag.Int("prefix-depth", 1, "With --max-per-prefix, how many path components below the start make up a prefix")
+		preferRep = flag.Bool("prefer-repos", false, "Rank git repository roots above other equally good matches")
+		reposOnly = flag.Bool("repos", false, "Only show git repository roots")
+		collapse  = flag.Bool("collapse-chains", false, "Hide directories whose only subdirectory is one child, showing a/b/c/d chains by their endpoint")
+		printSel  = flag.Bool("print", false, "Print the selected directory to stdout instead of changing to it")
+		relToCwd  = flag.Bool("relative-to-cwd", false, "With --print, output the selection relative to the current directory")
+		oneFS     = flag.Bool("one-filesystem", false, "Don't descend into directories on other filesystems")
+		emptyMsg  = flag.String("empty-message", "", "Guidance shown when the scan finds no directories (\\n separates lines)")
+		focusDep  = flag.Int("focus-depth", 10, "How many levels below the selection Ctrl+F scans; 0 disables it")
+		deepKey   = flag.Bool("interactive-depth", false, "Let Ctrl+D deepen the scan one level at a time")
+		resume    = flag.Bool("resume", false, "Reuse the directory list and query of a run from the same path in the last 10 minutes")
+		escMode   = flag.String("escape", escapeCancel, "Escape behaviour: cancel or clear-then-cancel")
+		preview   = flag.String("preview-cmd", "", "Show the output of this shell command for the selection; {} is its path")
+		prevLines = flag.Int("preview-lines", 0, "With --preview-cmd, read and show at most n lines of output")
+		prevDeb   = flag.Duration("preview-debounce", previewDebounce, "With --preview-cmd, how long the selection must stay put before the preview runs")
+		recentUp  = flag.Bool("sort-recent-first", false, "Record selections and boost often and recently visited directories")
+		tailWt    = flag.Int("tail-weight", 0, "Rank query matches in the last n path segments above matches in their parents")
+		frecWt    = flag.Float64("frecency-weight", 0, "Score points the most frecent directory gains with --sort-recent-first; 0 leaves the ranking alone")
+		localOnly = flag.Bool("local", false, "Only scan the starting directory, without the global results from /")
+		aliasPath = flag.String("aliases", "", "Read \"label = path\" aliases from this file (default: ~/.config/cdf/aliases)")
+		exportTo  = flag.String("export-file", "", "Where Ctrl+E writes the current results, one path per line (default: ~/.cache/cdf/last-results)")
+		denyPath  = flag.String("deny", "", "Never show the absolute directories listed in this file, even with --no-ignore (default: ~/.config/cdf/deny)")
+		pickRt    = flag.Bool("pick-root", false, "Without a path argument, first pick the scan root from the roots used recently")
+		rootsFile = flag.String("roots-config", "", "Scan only the directories listed in this file, one per line")
+		grpCounts = flag.Bool("group-counts", false, "With --group, show how many matches each group holds")
+		queryFile = flag.String("query-file", "", "With --print, match each line of this file after one scan, without the TUI")
+		topN      = flag.Int("top", 1, "With --query-file or --server, how many matches to print per query")
+		count     = flag.Bool("count", false, "Print how many directories match --query and exit, without the TUI")
+		query     = flag.String("query", "", "With --count, the query to match (default: every directory)")
+		exitZero  = flag.Bool("exit-0", false, "With --count, exit with code 2 when nothing matches")
+		explain   = flag.Bool("explain", false, "With --query-file, add each match's score breakdown as a third field")
+		server    = flag.Bool("server", false, "Stay running and answer QUERY/RESCAN/QUIT lines on stdin from one warm scan")
+		raw       = flag.Bool("raw", false, "Stream every directory to stdout as it is found, unsorted, without the TUI")
+		fixedBat  = flag.Bool("fixed-batch", false, "Keep scan batches at a constant size instead of growing them on large scans")
+		nonEmpty  = flag.Bool("non-empty", false, "Leave out directories that contain nothing")
+		newerThan = flag.String("newer-than", "", "Only include directories modified within this duration (e.g. 48h) or since this date (2006-01-02 or RFC 3339)")
+		keepUnage = flag.Bool("keep-unknown-age", false, "With --newer-than, keep directories whose modification time can't be read")
+		retries   = flag.Int("retry", 0, "Retry a failed directory read up to n times before skipping it (for flaky network mounts)")
+		workers   = flag.Int("scan-workers", runtime.NumCPU(), "How many directories the scan reads at once (1 reads them one at a time)")
+		showRoot  = flag.Bool("show-root", false, "Print the directories the scan starts from to stderr (also with --debug)")
+		showIgn   = flag.Bool("show-ignored", false, "Show how many directories the ignore rules skipped in the status bar")
+		minEntry  = flag.Int("min-entries", 0, "Leave out directories with fewer than n entries")
+		shuffle   = flag.Bool("shuffle", false, "Shorthand for --browse-order shuffle: list directories in random order before typing")
+		seed      = flag.Int64("seed", 0, "With --shuffle, the seed fixing its order (default: a new order each run)")
+		browseOrd = flag.String("browse-order", browseWalk, "Order with an empty query: "+strings.Join(browseOrders, ", "))
+		regex     = flag.Bool("regex", false, "Match the query as a Go regular expression instead of fuzzily")
+		algo      = flag.String("algo", algoFuzzy, "Matching algorithm: fuzzy, or initials to rank path-component initials first")
+		sortMode  = flag.String("sort", sortScore, "Match order: "+strings.Join(sortModes, ", "))
+		ancestors = flag.Bool("include-ancestors", false, "Keep the starting directory's parents in the global results")
+		crumbs    = flag.Bool("breadcrumb", false, "Show the selection's path as segments below the results; ←/→ pick one for Enter and Ctrl+F")
+		numberSel = flag.Bool("number-select", false, "Number the first nine visible results; Alt+1 to Alt+9 select one at once")
+		showIcons = flag.Bool("icons", false, "Show an icon for each match's directory type (git, go, node, ...)")
+		ignores   stringList
+		iconSpecs stringList
+		xforms    stringList
 	)
+	flag.Var(&ignores, "ignore", "Additional ignore pattern (repeatable)")
+	flag.Var(&iconSpecs, "icon", "Override an icon as type=icon, e.g. go=G (repeatable)")
+	flag.Var(&xforms, "transform", "Rewrite the selected path before handing it over: resolve-symlinks, clean, strip-prefix=<dir> or add-prefix=<dir> (repeatable, applied in order)")
 	
 	flag.Parse()
 	
@@ -35,12 +137,184 @@ func main() {
 		os.Exit(0)
 	}
 	
+	if *escMode != escapeCancel && *escMode != escapeClearThenCancel {
+		fmt.Fprintf(os.Stderr, "Error: invalid --escape %q (want %s or %s)\n", *escMode, escapeCancel, escapeClearThenCancel)
+		os.Exit(1)
+	}
+	
+	if *explain && *queryFile == "" {
+		fmt.Fprintln(os.Stderr, "Error: --explain requires --query-file")
+		os.Exit(1)
+	}
+	
+	if (*query != "" || *exitZero) && !*count {
+		fmt.Fprintln(os.Stderr, "Error: --query and --exit-0 require --count")
+		os.Exit(1)
+	}
+	
+	var queries []string
+	if *queryFile != "" {
+		if !*printSel {
+			fmt.Fprintln(os.Stderr, "Error: --query-file requires --print")
+			os.Exit(1)
+		}
+		var err error
+		if queries, err = readQueries(*queryFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+	}
+	
+	if *shuffle {
+		*browseOrd = browseShuffle
+	}
+	if *seed != 0 && *browseOrd != browseShuffle {
+		fmt.Fprintln(os.Stderr, "Error: --seed requires --shuffle")
+		os.Exit(1)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	if !containsString(browseOrders, *browseOrd) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --browse-order %q (want one of: %s)\n", *browseOrd, strings.Join(browseOrders, ", "))
+		os.Exit(1)
+	}
+	if *browseOrd == browseFrecency && !*recentUp {
+		fmt.Fprintln(os.Stderr, "Error: --browse-order frecency needs the history kept by --sort-recent-first")
+		os.Exit(1)
+	}
+	
+	if *algo != algoFuzzy && *algo != algoInitials {
+		fmt.Fprintf(os.Stderr, "Error: invalid --algo %q (want %s or %s)\n", *algo, algoFuzzy, algoInitials)
+		os.Exit(1)
+	}
+	
+	var ageThresholds []time.Duration
+	if *ageColors {
+		var err error
+		if ageThresholds, err = parseAgeSteps(*ageSteps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --age-steps: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	var newerCut time.Time
+	if *newerThan != "" {
+		var err error
+		if newerCut, err = parseNewerThan(*newerThan, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --newer-than: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	if !validSortMode(*sortMode) {
+		fmt.Fprintf(os.Stderr, "Error: invalid --sort %q (want one of: %s)\n", *sortMode, strings.Join(sortModes, ", "))
+		os.Exit(1)
+	}
+	
+	if *prevDeb < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --preview-debounce %s (want 0 or more)\n", *prevDeb)
+		os.Exit(1)
+	}
+	
+	if *perPrefix < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-per-prefix %d (want 0 or more)\n", *perPrefix)
+		os.Exit(1)
+	}
+	
+	if *prefixDep < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --prefix-depth %d (want 1 or more)\n", *prefixDep)
+		os.Exit(1)
+	}
+	
+	maxDepth, err := scanMaxDepth(*depth, *depthBase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	
+	// --focus-depth counts levels below the selection the way --depth counts
+	// them below the start, with 0 keeping Ctrl+F off
+	if *focusDep < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --focus-depth %d (want 0 or more)\n", *focusDep)
+		os.Exit(1)
+	}
+	focusMax := 0
+	if *focusDep > 0 {
+		if focusMax, err = scanMaxDepth(*focusDep, *depthBase); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	if *workers < 1 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --scan-workers %d (want 1 or more)\n", *workers)
+		os.Exit(1)
+	}
+	
+	if *tailWt < 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --tail-weight %d (want 0 or more segments)\n", *tailWt)
+		os.Exit(1)
+	}
+	
+	var segments map[string]bool
+	for _, segment := range strings.Split(*ignSegs, ",") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			if segments == nil {
+				segments = make(map[string]bool)
+			}
+			segments[segment] = true
+		}
+	}
+	
+	var icons map[string]string
+	if *showIcons {
+		var err error
+		if icons, err = parseIconSpecs(iconSpecs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	transforms, err := parseTransforms(xforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	
 	startPath, err := getStartPath()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 	
+	// With --pick-root the scan root can come from a first finder over the
+	// roots used recently; every root scanned with it is remembered
+	var recentPath string
+	if *pickRt {
+		recentPath, _ = recentRootsFile()
+	}
+	interactive := *queryFile == "" && !*server && !*count && !*raw
+	if recentPath != "" && len(flag.Args()) == 0 && interactive && *rootsFile == "" {
+		if startPath, err = pickRoot(context.Background(), recentPath, startPath, runTUIWithConfigCtx); err != nil {
+			if *debug {
+				fmt.Fprintf(os.Stderr, "Root picker: %v\n", err)
+			}
+			os.Exit(finderExitCode(err))
+		}
+	}
+	
+	if err := checkScanRoot(startPath, *allowRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	
+	if recentPath != "" {
+		if err := rememberRoot(recentPath, startPath); err != nil && *debug {
+			fmt.Fprintf(os.Stderr, "Could not record root: %v\n", err)
+		}
+	}
+	
 	if *debug {
 		fmt.Fprintf(os.Stderr, "Scanning from: %s (depth: %d)\n", startPath, *depth)
 	}
@@ -48,6 +322,11 @@ func main() {
 	// Create a context for cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	if *maxRun > 0 {
+		// One deadline for scanning and the interactive session together
+		ctx, cancel = context.WithTimeout(ctx, *maxRun)
+		defer cancel()
+	}
 	
 	// Handle interrupt signals for clean shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -60,25 +339,365 @@ func main() {
 		cancel()
 	}()
 	
+	patterns, err := loadIgnorePatterns(startPath, ignores)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading ignore files: %v\n", err)
+		os.Exit(1)
+	}
+	
+	// The deny file is optional unless named
+	denied := *denyPath
+	if denied == "" {
+		denied, _ = denyFile()
+	} else if _, err := os.Stat(denied); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: deny file %s does not exist\n", denied)
+		os.Exit(1)
+	}
+	var deny denylist
+	if denied != "" {
+		if deny, err = loadDenylist(denied); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: reading deny file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
 	// Two-phase scanning for prioritized results
-	dirChan := scanTwoPhasesAsyncCtx(ctx, startPath, *depth, !*noIgnore, 50)
+	scanConfig := ScanConfig{
+		MaxDepth:          maxDepth,
+		UseIgnorePatterns: !*noIgnore,
+		InitialBatchSize:  50,
+		MaxBatchSize:      200,
+		IgnorePatterns:    patterns,
+		IncludeAncestors:  *ancestors,
+		CaptureModTimes:   *hotWindow > 0 || *ageColors || *resume,
+		BreadthFirst:      *bfs,
+		DetectRepos:       *preferRep || *reposOnly,
+		OneFilesystem:     *oneFS,
+		LocalOnly:         *localOnly,
+		FixedBatch:        *fixedBat,
+		SkipEmpty:         *nonEmpty,
+		MinEntries:        *minEntry,
+		SkipHidden:        !*hidden,
+		WritableOnly:      *writable,
+		SymlinkTargets:    *matchLink,
+		NewerThan:         newerCut,
+		KeepUnknownAge:    *keepUnage,
+		Retries:           *retries,
+		Workers:           *workers,
+		Deny:              deny,
+	}
+	if *debug {
+		scanConfig.DebugLog = os.Stderr
+	}
+	if *trace {
+		scanConfig.Trace = os.Stderr
+	}
 	
-	selectedPath, err := runTUIAsyncCtx(ctx, dirChan)
-	if err != nil {
+	// With --resume a recent session from the same root replaces the scan
+	var resumePath string
+	var resumed session
+	var dirChan <-chan DirBatch
+	var rootTime time.Time
+	if *resume {
+		// Taken before any scanning, so changes made meanwhile count as new
+		if info, err := os.Stat(startPath); err == nil {
+			rootTime = info.ModTime()
+		}
+		if path, err := resumeFile(); err == nil {
+			resumePath = path
+		}
+		if s, ok := loadSession(resumePath, startPath, resumeTTL, time.Now()); ok {
+			// Only the subtrees modified since are scanned again
+			resumed = s
+			dirChan = resumeSession(ctx, s, startPath, scanConfig)
+			if *debug {
+				fmt.Fprintf(os.Stderr, "Resumed %d directories saved at %s, rescanning %d changed\n", len(s.Directories), s.Saved.Format(time.Kitchen), len(s.Stale))
+			}
+		}
+	}
+	// With --roots-config the configured roots replace the two-phase scan
+	scan := func(ctx context.Context, config ScanConfig) <-chan DirBatch {
+		return scanTwoPhasesWithConfigCtx(ctx, startPath, config)
+	}
+	var configured []string
+	if *rootsFile != "" {
+		roots, skipped, err := usableRoots(*rootsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
 		if *debug {
-			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+			for _, reason := range skipped {
+				fmt.Fprintf(os.Stderr, "Skipping root %s\n", reason)
+			}
+		}
+		scan = func(ctx context.Context, config ScanConfig) <-chan DirBatch {
+			return scanRootsWithConfigCtx(ctx, roots, config)
+		}
+		configured = roots
+	}
+	if *showRoot || *debug {
+		for _, root := range scanRoots(startPath, *localOnly, configured) {
+			fmt.Fprintf(os.Stderr, "Scan root: %s\n", root)
 		}
-		// Check if it was a cancellation vs actual error
-		if err == context.Canceled || err.Error() == "cancelled" {
+	}
+	if dirChan == nil {
+		dirChan = scan(ctx, scanConfig)
+	}
+	
+	var onExit func([]string, string, map[string]time.Time)
+	if resumePath != "" {
+		onExit = func(directories []string, query string, modTimes map[string]time.Time) {
+			saved := time.Now()
+			if !resumed.Saved.IsZero() {
+				// Resuming doesn't refresh the list, so it doesn't extend its life
+				saved = resumed.Saved
+			}
+			times := make(map[string]time.Time, len(modTimes)+1)
+			for dir, modTime := range modTimes {
+				times[dir] = modTime
+			}
+			times[startPath] = rootTime
+			s := session{Root: startPath, Saved: saved, Query: query, Directories: directories, ModTimes: times}
+			if err := saveSession(resumePath, s); err != nil && *debug {
+				fmt.Fprintf(os.Stderr, "Could not save session: %v\n", err)
+			}
+		}
+	}
+	
+	// With --sort-recent-first the selection history nudges the ranking by
+	// --frecency-weight
+	var historyPath string
+	var frecencies map[string]float64
+	weight := 0.0
+	if *recentUp {
+		if path, err := historyFile(); err == nil {
+			historyPath = path
+			entries, err := loadHistory(path)
+			if err != nil && *debug {
+				fmt.Fprintf(os.Stderr, "Could not read history: %v\n", err)
+			}
+			frecencies, weight = frecency(entries, time.Now()), *frecWt
+		}
+	}
+	
+	// Aliases label cryptic directory names; the default file is optional
+	path := *aliasPath
+	if path == "" {
+		path, _ = aliasFile()
+	}
+	var aliases map[string]string
+	if path != "" {
+		var err error
+		if aliases, err = loadAliases(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: reading aliases: %v\n", err)
+			os.Exit(1)
+		}
+		if aliases == nil && *aliasPath != "" {
+			fmt.Fprintf(os.Stderr, "Error: alias file %s does not exist\n", path)
+			os.Exit(1)
+		}
+	}
+	
+	// Ctrl+E needs somewhere to write; without a cache directory it is off
+	exportPath := *exportTo
+	if exportPath == "" {
+		exportPath, _ = exportFile()
+	} else if path, err := expandPath(exportPath); err == nil {
+		exportPath = path
+	}
+	
+	var deepen func(context.Context, int) <-chan DirBatch
+	if *deepKey {
+		deepen = func(ctx context.Context, depth int) <-chan DirBatch {
+			// Only the new level: everything above it is already listed
+			config := scanConfig
+			config.MinDepth, config.MaxDepth = depth, depth
+			return scan(ctx, config)
+		}
+	}
+	
+	var focusScan func(context.Context, string) <-chan DirBatch
+	if *focusDep > 0 {
+		focusScan = func(ctx context.Context, root string) <-chan DirBatch {
+			// Just the selection's subtree, past the usual depth limit, with
+			// anchored ignore patterns still relative to where the scan started
+			config := scanConfig
+			config.Root = root
+			config.MinDepth, config.MaxDepth = 0, focusMax
+			config.IgnoreBase = startPath
+			config.OmitPaths = nil
+			return scanWithConfigCtx(ctx, config)
+		}
+	}
+	
+	reload := func(ctx context.Context, useIgnore bool) (<-chan DirBatch, int, error) {
+		patterns, err := loadIgnorePatterns(startPath, ignores)
+		if err != nil {
+			return nil, 0, err
+		}
+		config := scanConfig
+		config.IgnorePatterns = patterns
+		config.UseIgnorePatterns = useIgnore
+		return scan(ctx, config), len(patterns), nil
+	}
+	
+	tuiConfig := TUIConfig{
+		Compact:         *compact,
+		Borders:         *borders,
+		Reverse:         *reverse,
+		ScanBudget:      *scanTime,
+		SampleThreshold: *sampleAt,
+		WaitForScan:     *waitScan,
+		Translit:        *translit,
+		IgnoreSegments:  segments,
+		MaxResults:      *maxResult,
+		CountHint:       *countHint,
+		HighlightRecent: *hotWindow,
+		AgeColors:       ageThresholds,
+		AutoSelect:      *autoSel,
+		AcceptQuery:     *acceptQry,
+		MatchTargets:    *matchLink,
+		MatchAbbrev:     *abbrev,
+		ShowIgnored:     *showIgn,
+		Aliases:         aliases,
+		Group:           *group,
+		GroupCounts:     *grpCounts,
+		Root:            startPath,
+		MaxPerPrefix:    *perPrefix,
+		PrefixDepth:     *prefixDep,
+		PreferRepos:     *preferRep,
+		ReposOnly:       *reposOnly,
+		CollapseChains:  *collapse,
+		EmptyMessage:    strings.ReplaceAll(*emptyMsg, `\n`, "\n"),
+		Deepen:          deepen,
+		FocusScan:       focusScan,
+		Reload:          reload,
+		ExportPath:      exportPath,
+		NoIgnore:        *noIgnore,
+		Depth:           maxDepth,
+		DepthBase:       *depthBase,
+		InitialQuery:    resumed.Query,
+		OnExit:          onExit,
+		EscapeMode:      *escMode,
+		Icons:           icons,
+		DimReadOnly:     *dimRO,
+		Breadcrumb:      *crumbs,
+		NumberSelect:    *numberSel,
+		SortMode:        *sortMode,
+		BrowseOrder:     *browseOrd,
+		ShuffleSeed:     *seed,
+		Algo:            *algo,
+		Regex:           *regex,
+		PreviewCmd:      *preview,
+		PreviewLines:    *prevLines,
+		PreviewDebounce: *prevDeb,
+		LocalOnly:       *localOnly,
+		Frecency:        frecencies,
+		FrecencyWeight:  weight,
+		TailWeight:      *tailWt,
+	}
+	
+	if *raw {
+		// Raw mode: hand directories on as they arrive, e.g. to fzf
+		cwd, _ := os.Getwd()
+		format := func(path string) string { return outputPath(path, cwd, *relToCwd) }
+		if err := streamDirectories(os.Stdout, dirChan, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: scanning failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	
+	if *count {
+		// Count mode: one scan, one query, just the number of matches
+		directories, err := collectDirectories(dirChan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: scanning failed: %v\n", err)
+			os.Exit(1)
+		}
+		n, err := countMatches(os.Stdout, *query, directories, tuiConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if n == 0 && *exitZero {
 			os.Exit(2)
 		}
-		os.Exit(1)
+		return
+	}
+	
+	if *queryFile != "" {
+		// Batch mode: one scan, then every query against it, no TUI
+		directories, err := collectDirectories(dirChan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: scanning failed: %v\n", err)
+			os.Exit(1)
+		}
+		cwd, _ := os.Getwd()
+		format := func(path string) string { return outputPath(path, cwd, *relToCwd) }
+		if err := runQueries(os.Stdout, queries, directories, tuiConfig, *topN, format, *explain); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	
+	if *server {
+		// Server mode: the first scan is already running; rescans start anew
+		cwd, _ := os.Getwd()
+		format := func(path string) string { return outputPath(path, cwd, *relToCwd) }
+		first := dirChan
+		scanOnce := func() ([]string, error) {
+			ch := first
+			if ch == nil {
+				ch = scan(ctx, scanConfig)
+			}
+			first = nil
+			return collectDirectories(ch)
+		}
+		if err := runServer(os.Stdin, os.Stdout, scanOnce, tuiConfig, *topN, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	
+	selectedPath, err := runTUIWithConfigCtx(ctx, dirChan, tuiConfig)
+	if err != nil {
+		if *debug {
+			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+		}
+		os.Exit(finderExitCode(err))
 	}
 	
 	if *debug {
 		fmt.Fprintf(os.Stderr, "Selected: %s\n", selectedPath)
 	}
 	
+	if historyPath != "" {
+		if err := recordVisit(historyPath, selectedPath, time.Now()); err != nil && *debug {
+			fmt.Fprintf(os.Stderr, "Could not record history: %v\n", err)
+		}
+	}
+	
+	// Massaged for the shell only after history saw the real selection
+	target, err := applyTransforms(selectedPath, transforms)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: transforming %s: %v\n", selectedPath, err)
+		os.Exit(1)
+	}
+	selectedPath = target
+	
+	if *printSel {
+		cwd, _ := os.Getwd()
+		if err := writeSelection(os.Stdout, outputPath(selectedPath, cwd, *relToCwd)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	
 	if err := autocd.ExitWithDirectory(selectedPath); err != nil {
 		fmt.Fprintf(os.Stderr, "autocd failed: %v\n", err)
 		os.Exit(1)
@@ -89,13 +708,13 @@ func getStartPath() (string, error) {
 	args := flag.Args()
 	if len(args) > 0 {
 		path := args[0]
-		absPath, err := filepath.Abs(path)
+		absPath, err := expandPath(path)
 		if err != nil {
-			return "", fmt.Errorf("invalid path %s: %v", path, err)
+			return "", scanRootError("invalid path %s: %v", path, err)
 		}
 		
 		if _, err := os.Stat(absPath); os.IsNotExist(err) {
-			return "", fmt.Errorf("path does not exist: %s", absPath)
+			return "", scanRootError("path does not exist: %s", absPath)
 		}
 		
 		return absPath, nil
@@ -104,20 +723,146 @@ func getStartPath() (string, error) {
 	return os.Getwd()
 }
 
+// scanRoots describes where the scan starts once the starting directory and
+// any --roots-config roots are resolved: the configured roots when there are
+// some, otherwise the starting directory followed, unless the scan is local,
+// by / without it
+func scanRoots(startPath string, localOnly bool, configured []string) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+	if localOnly || startPath == "/" {
+		return []string{startPath}
+	}
+	return []string{startPath, fmt.Sprintf("/ (excluding %s)", startPath)}
+}
+
+// scanMaxDepth converts --depth to ScanConfig.MaxDepth, which counts the
+// levels below the starting directory's immediate children. With base 1
+// the children are level 1, so --depth 1 lists just them; with base 0 they
+// are level 0, and --depth 0 lists just them.
+func scanMaxDepth(depth, base int) (int, error) {
+	if base != 0 && base != 1 {
+		return 0, fmt.Errorf("invalid --depth-base %d (want 0 or 1)", base)
+	}
+	if depth < base {
+		return 0, fmt.Errorf("invalid --depth %d (want %d or more with --depth-base %d)", depth, base, base)
+	}
+	return depth - base, nil
+}
+
+// exitNoInput is the exit code when an input file (--roots-config,
+// --query-file) leaves nothing to do
+const exitNoInput = 3
+
+// errNoValidInput marks an input file that is empty or holds only invalid
+// entries, which would otherwise end in a silently empty result
+var errNoValidInput = errors.New("no valid input")
+
+// exitCancelled is the exit code when the finder ends without a selection
+const exitCancelled = 2
+
+// finderExitCode maps an error from the finder to the process exit code:
+// leaving it, by key, --max-runtime or a signal, is a cancellation rather
+// than a failure
+func finderExitCode(err error) int {
+	if errors.Is(err, ErrCancelled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return exitCancelled
+	}
+	return 1
+}
+
+// exitCode maps a startup error to the process exit code
+func exitCode(err error) int {
+	if errors.Is(err, errNoValidInput) {
+		return exitNoInput
+	}
+	return 1
+}
+
+// defaultAgeSteps is the --age-steps default: a day, a week and a month
+const defaultAgeSteps = "24h,168h,720h"
+
+// parseAgeSteps reads --age-steps, comma-separated positive durations in
+// ascending order
+func parseAgeSteps(s string) ([]time.Duration, error) {
+	var steps []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		step, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 {
+			return nil, fmt.Errorf("%s is not a positive duration", field)
+		}
+		if len(steps) > 0 && step <= steps[len(steps)-1] {
+			return nil, fmt.Errorf("%s does not come after %s", field, steps[len(steps)-1])
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// parseNewerThan reads --newer-than: a positive duration counted back from
+// now, or a date (2006-01-02, local time) or RFC 3339 timestamp
+func parseNewerThan(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("%s is not a positive duration", s)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration nor a date", s)
+}
+
+// checkScanRoot refuses a user-requested scan of the filesystem root, which is
+// very slow and almost never intended, unless allowRoot is set. The global
+// phase of a normal two-phase scan still walks the root; this only guards the
+// starting path.
+func checkScanRoot(startPath string, allowRoot bool) error {
+	if allowRoot || filepath.Dir(startPath) != startPath {
+		return nil
+	}
+	return scanRootError("refusing to scan from %s, which walks the whole filesystem; pass --allow-root to do it anyway", startPath)
+}
+
 // scanTwoPhasesAsyncCtx implements two-phase scanning:
-// Phase 1: Current working directory (fast results)
-// Phase 2: Root directory excluding current directory (broader coverage)
+// Phase 1: Starting directory (fast results)
+// Phase 2: Root directory excluding the starting directory (broader coverage)
 func scanTwoPhasesAsyncCtx(ctx context.Context, startPath string, maxDepth int, useIgnorePatterns bool, batchSize int) <-chan DirBatch {
+	return scanTwoPhasesWithConfigCtx(ctx, startPath, ScanConfig{
+		MaxDepth:          maxDepth,
+		UseIgnorePatterns: useIgnorePatterns,
+		InitialBatchSize:  batchSize,
+		MaxBatchSize:      200,
+	})
+}
+
+// scanTwoPhasesWithConfigCtx runs the two-phase scan using config as a template;
+// Root is filled in per phase.
+func scanTwoPhasesWithConfigCtx(ctx context.Context, startPath string, config ScanConfig) <-chan DirBatch {
 	ch := make(chan DirBatch, 2)
 	
 	go func() {
 		defer close(ch)
 		
-		cwd, err := os.Getwd()
-		if err != nil {
-			// Fallback to single-phase if we can't get CWD
-			singlePhase := scanDirectoriesAsyncCtx(ctx, startPath, maxDepth, useIgnorePatterns, batchSize)
+		scanStart, total := time.Now(), 0
+		defer func() {
+			tracePhase(config.Trace, "total", scanStart, total)
+		}()
+		
+		if startPath == "/" {
+			// The first phase already covers everything
+			config.Root = startPath
+			singlePhase := scanWithConfigCtx(ctx, config)
 			for batch := range singlePhase {
+				total += len(batch.Directories)
 				select {
 				case ch <- batch:
 				case <-ctx.Done():
@@ -127,13 +872,21 @@ func scanTwoPhasesAsyncCtx(ctx context.Context, startPath string, maxDepth int,
 			return
 		}
 		
-		// Phase 1: Scan current working directory first
-		phase1Chan := scanDirectoriesAsyncCtx(ctx, cwd, maxDepth, useIgnorePatterns, batchSize)
+		// Phase 1: Scan the starting directory first
+		config.Root = startPath
+		phase1Chan := scanWithConfigCtx(ctx, config)
+		localCount, phaseStart := 0, time.Now()
 		for batch := range phase1Chan {
+			localCount += len(batch.Directories)
+			total += len(batch.Directories)
 			select {
 			case ch <- DirBatch{
 				Directories: batch.Directories,
-				Done:        false, // Not done yet, phase 2 coming
+				ModTimes:    batch.ModTimes,
+				Repos:       batch.Repos,
+				Targets:     batch.Targets,
+				Ignored:     batch.Ignored,
+				Done:        config.LocalOnly && batch.Done, // Otherwise phase 2 is coming
 				Err:         batch.Err,
 			}:
 			case <-ctx.Done():
@@ -144,21 +897,60 @@ func scanTwoPhasesAsyncCtx(ctx context.Context, startPath string, maxDepth int,
 				return
 			}
 		}
+		tracePhase(config.Trace, "local", phaseStart, localCount)
+		if config.LocalOnly {
+			return
+		}
+		
+		if localCount == 0 && config.MinDepth == 0 {
+			// Say so explicitly instead of letting global results quietly
+			// stand in for the local ones. A scan starting deeper (Ctrl+D)
+			// only adds to what is listed, so it says nothing about that.
+			select {
+			case ch <- DirBatch{LocalEmpty: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
 		
-		// Phase 2: Scan from root, excluding current directory
-		phase2Chan := scanDirectoriesAsyncCtxExcluding(ctx, "/", maxDepth, useIgnorePatterns, batchSize, cwd)
+		// Phase 2: Scan from root, excluding the starting directory and,
+		// unless asked for, the directories leading to it
+		config.Root = "/"
+		if !config.IncludeAncestors {
+			config.OmitPaths = ancestorPaths(startPath)
+		}
+		phase2Chan := scanWithConfigCtxExcluding(ctx, config, startPath)
+		globalCount, phaseStart := 0, time.Now()
 		for batch := range phase2Chan {
+			globalCount += len(batch.Directories)
+			total += len(batch.Directories)
+			batch.Global = true
 			select {
 			case ch <- batch:
 			case <-ctx.Done():
 				return
 			}
 		}
+		tracePhase(config.Trace, "global", phaseStart, globalCount)
 	}()
 	
 	return ch
 }
 
+// tracePhase writes a --trace line for a scan phase that ran from start until
+// now and found dirs directories; nothing is written when w is nil. Times
+// are RFC 3339 with nanoseconds and durations in milliseconds, so lines can
+// be grepped by phase and compared across runs.
+func tracePhase(w io.Writer, phase string, start time.Time, dirs int) {
+	if w == nil {
+		return
+	}
+	end := time.Now()
+	fmt.Fprintf(w, "cdf-trace phase=%s start=%s end=%s duration_ms=%.3f dirs=%d\n",
+		phase, start.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano),
+		float64(end.Sub(start).Microseconds())/1000, dirs)
+}
+
 func showUsage() {
 	fmt.Printf(`cdf - Directory Fuzzy Finder
 
@@ -166,12 +958,248 @@ Usage:
   cdf [options] [path]
 
 Arguments:
-  path              Starting directory for scan (default: current directory)
+  path              Starting directory for scan (default: current directory);
+                    a leading ~ or ~user and $VAR / ${VAR} are expanded
 
 Options:
-  --depth <n>       Maximum scan depth (default: 5)
+  --depth <n>       How many levels below the starting directory to list:
+                    1 is its immediate children only (default: 6)
+  --depth-base <b>  The level --depth counts the immediate children as: 1
+                    (default) or 0, where --depth 0 lists the children and
+                    --depth 5 reaches as far as --depth 6 does with base 1
   --no-ignore       Disable ignore patterns (scan all directories)
-  --debug           Enable debug output to stderr
+  --hidden          Include hidden (dot) directories (default: true);
+                    --hidden=false skips them all, with or without --no-ignore
+  --writable-only   Leave out directories you can't create entries in (their
+                    subdirectories are still scanned; Unix only)
+  --dim-readonly    Grey out directories you can't create entries in (Unix
+                    only)
+  --ignore <pat>    Extra ignore pattern, repeatable; a bare name matches at
+                    any level, a pattern with "/" matches the path relative
+                    to the scan root (e.g. src/generated, **/fixtures/*),
+                    and a leading ! re-includes (e.g. !build). Patterns are
+                    also read, one per line, from ~/.config/cdf/ignore and
+                    the starting directory's .cdfignore; Ctrl+R reloads them
+  --show-ignored    Show in the status bar how many directories the ignore
+                    rules skipped (e.g. (142 ignored)), each skipped subtree
+                    counting once
+  --aliases <file>  Read directory aliases, one "label = path" per line (e.g.
+                    billing-service = /srv/app-x7f2), from file instead of
+                    ~/.config/cdf/aliases; a label is matched along with its
+                    path and shown in front of it
+  --export-file <file>
+                    Where Ctrl+E writes the current results, one absolute
+                    path per line (default: ~/.cache/cdf/last-results)
+  --deny <file>     Never show the directories listed in file, one absolute
+                    path per line (path/** for its whole subtree), instead of
+                    ~/.config/cdf/deny; applies even with --no-ignore
+  --pick-root       Without a path argument, first pick where to scan from
+                    the roots used recently (kept in ~/.cache/cdf/roots, the
+                    current directory last); the search then starts there.
+                    Every root scanned with --pick-root is remembered
+  --roots-config <file>
+                    Scan only the directories listed in file, one per line
+                    (# comments, ~ and $VAR allowed), each to --depth;
+                    missing ones are skipped (see --debug)
+  --non-empty       Leave out empty directories (unreadable ones are kept)
+  --min-entries <n> Leave out directories with fewer than n entries, files
+                    and subdirectories alike (unreadable ones are kept)
+  --retry <n>       Retry a directory read that fails up to n times, with a
+                    short backoff, before skipping its subtree; for flaky
+                    network mounts (missing or forbidden directories are
+                    never retried)
+  --scan-workers <n>
+                    Read up to n directories at once while scanning; the
+                    order results arrive in is unchanged (default: the
+                    number of CPUs; 1 reads one directory at a time)
+  --newer-than <t>  Only include directories modified more recently than t:
+                    a duration back from now (e.g. 48h) or a date
+                    (2024-05-01, or RFC 3339 such as 2024-05-01T09:00:00Z);
+                    older directories are still searched below
+  --keep-unknown-age
+                    With --newer-than, keep directories whose modification
+                    time can't be read instead of leaving them out
+  --match-symlink-target
+                    List symlinks to directories (without descending into
+                    them) and match them by their target path as well as
+                    their own; the symlink path is what is shown and returned
+  --match-abbrev    Also match each directory by the first letter of every
+                    path component, so ~/p/w/s finds ~/projects/webapp/src
+                    while full-name queries keep working
+  --local           Only scan the starting directory; without it, results from
+                    the rest of the filesystem follow the local ones
+  --compact         Drop spacer rows to show more results
+  --borders         Rules right below the prompt and above the status bar
+                    instead of spacer rows (also more result rows than the
+                    default layout; overrides --compact)
+  --reverse         Prompt at the bottom, results listed upwards from it
+  --fixed-batch     Keep scan batches at a constant size rather than growing
+                    them after 500 directories, for reproducible timings
+  --max-scan-time <d>
+                    Soft scan budget (e.g. 2s); afterwards scanning continues
+                    in the background marked as "Background" instead of "Scanning..."
+  --sample-threshold <n>
+                    Above n directories, keystrokes match a sample and the
+                    full match runs when typing pauses (default: 100000,
+                    0 disables)
+  --wait-for-scan   When Enter is pressed on a query mid-scan, wait up to a
+                    second for the scan to finish; a second Enter forces it
+  --translit        Match Cyrillic, Greek and accented directory names by
+                    their Latin spelling (e.g. proekt finds проект)
+  --ignore-segments <list>
+                    Leave these comma-separated path components out of the
+                    matched text (e.g. src,app,internal); results still show
+                    and select the full path
+  --max-results <n> Keep only the best n matches (default: unlimited)
+  --interactive-depth
+                    Start at --depth and press Ctrl+D to scan one level
+                    deeper, merging in the new directories
+  --focus-depth <n> How many levels below the selected directory Ctrl+F
+                    scans, past --depth and counted like it (see
+                    --depth-base) (default: 10, 0 disables Ctrl+F)
+  --one-filesystem  Don't descend into mounted filesystems (network shares,
+                    external drives), like find -xdev
+  --bfs             Scan breadth-first, so shallow directories are listed
+                    before deep ones on wide trees
+  --allow-root      Allow starting the scan at the filesystem root (cdf /),
+                    which is refused by default
+  --include-ancestors
+                    Keep the parents of the starting directory (e.g. /home,
+                    /home/me) in the results of the global scan
+  --highlight-recent <d>
+                    Mark directories modified within d (e.g. 24h) with a *
+  --age-colors      Shade results by modification age, bright for recently
+                    modified directories and dimmer for older ones
+  --age-steps <list>
+                    With --age-colors, the ascending ages where the shading
+                    dims a step (default: 24h,168h,720h)
+  --auto-select <d> Once the scan has finished and the query leaves a single
+                    match, select it after d (e.g. 2s); any key cancels
+  --max-runtime <d> Exit as cancelled (code 2) if nothing is selected within
+                    d (e.g. 5m), whether or not the scan has finished
+  --accept-query    Enter with no matches selects the typed query when it is
+                    an existing directory (e.g. ~/new-checkout)
+  --group           Group results under headers for their top-level directory
+  --group-counts    With --group, show each group's match count in its header
+                    (e.g. ── /home/me/projects (14) ──)
+  --max-per-prefix <n>
+                    Show at most n matches under each top-level directory
+                    (the best ones), so one large project can't crowd out
+                    the rest; 0 means no limit
+  --prefix-depth <n>
+                    With --max-per-prefix, count n path components below
+                    the starting directory (or /) as the prefix (default 1)
+  --prefer-repos    Rank git repository roots (directories containing .git)
+                    above other directories that match equally well
+  --repos           Only show git repository roots, as a project launcher
+  --collapse-chains Hide the links of single-child chains: a directory whose
+                    only listed subdirectory is one child is left out, so
+                    a/b/c/d shows as a/b/c/d alone (branches are kept)
+  --empty-message <text>
+                    Replace the guidance shown when the scan finds no
+                    directories at all; \n separates lines
+  --escape <mode>   What Escape does: cancel (default) exits right away,
+                    clear-then-cancel first clears a non-empty query;
+                    Ctrl+Q always cancels
+  --breadcrumb      Show the selected path as segments below the results;
+                    ←/→ pick a parent segment, which Enter selects and
+                    Ctrl+F scans below instead of the selection
+  --number-select   Number the first nine visible results; Alt+1 to Alt+9
+                    select that result right away (plain digits still type
+                    into the query)
+  --icons           Prefix matches with an icon for their type: git repo,
+                    Go, Rust, Node, Python, Ruby or Java project, or plain
+  --icon <type=icon>
+                    Override one icon, repeatable (e.g. --icon go=G,
+                    --icon dir=-); types are dir, git, go, rust, node,
+                    python, ruby and java
+  --algo <name>     fuzzy (default), or initials to rank directories whose
+                    path components start with the typed letters first
+                    (psc finds projects/src/components)
+  --regex           Match the query as a Go regular expression against the
+                    path (e.g. ^/srv/.*api$); while it does not compile
+                    nothing matches and the status bar shows why
+  --sort <mode>     Order of the matches: score (best fuzzy match first, the
+                    default), length (shortest name first, to pick the
+                    most concise of near-duplicates) or interleave
+                    (everything under the starting directory first, then
+                    the rest, each by score)
+  --browse-order <order>
+                    How to list directories before anything is typed: walk
+                    (scan order, the default), alpha, depth (shallowest
+                    first), frecency (with --sort-recent-first) or
+                    shuffle (random, see --shuffle)
+  --shuffle         List directories in a random order before anything is
+                    typed, to sample across the tree (--browse-order shuffle)
+  --seed <n>        With --shuffle, repeat the same order for the same n
+                    (default: a different order every run)
+  --preview-cmd <template>
+                    Run this shell command whenever the selection settles
+                    and show its output beside the results; {} becomes the
+                    quoted path (e.g. 'ls -la {}' or 'git -C {} log')
+  --preview-lines <n>
+                    With --preview-cmd, stop the command after n lines and
+                    mark the cut with "… (more)" (default: no limit)
+  --preview-debounce <duration>
+                    With --preview-cmd, how long the selection must stay
+                    put before the preview runs; moving on cancels a pending
+                    or running one (default: 100ms, 0 for no delay)
+  --sort-recent-first
+                    Remember selections so directories you visit often and
+                    recently can rank higher (see --frecency-weight)
+  --frecency-weight <n>
+                    How much --sort-recent-first boosts every query: the
+                    most visited directory gains n score points, others
+                    proportionally; 10 is about a few consecutive matched
+                    characters (default 0, history recorded but the ranking
+                    unchanged)
+  --tail-weight <n> Rank query matches in the last n path segments above
+                    the same match in a parent (e.g. 1 favours the basename);
+                    parent matches still count
+  --count-hint      Show the match count next to the prompt and how the last
+                    keystroke changed it (e.g. cdf > api_ (312 -88))
+  --resume          Save the directory list and query on exit, and reuse them
+                    when relaunched from the same path within 10 minutes;
+                    only subtrees modified since are scanned again
+  --print           Print the selected directory to stdout instead of
+                    changing to it (e.g. vim "$(cdf --print)"); the finder
+                    draws on the terminal, so stdout holds just the path
+  --query-file <file>
+                    With --print, scan once and print the best match for
+                    each line of file as "query<TAB>path" (an empty path
+                    when nothing matches), without opening the finder
+  --top <n>         With --query-file or --server, print the best n matches
+                    per query (default: 1)
+  --explain         With --query-file, add a third field breaking each
+                    match's rank down: raw fuzzy score, frecency boost,
+                    initials alignment, repo/pinned preference and the final
+                    score (e.g. fuzzy=42 frecency=+5.00 score=47.00)
+  --count           Scan once and print only how many directories match
+                    --query, without opening the finder (e.g. in scripts)
+  --query <text>    With --count, the query to match (default: every
+                    directory)
+  --exit-0          With --count, exit with code 2 when nothing matches
+  --server          Scan once, then answer requests on stdin until QUIT or
+                    end of input: "QUERY <text>" replies "OK <n>" and n
+                    paths, "RESCAN" refreshes the index and replies
+                    "OK <dirs>", "QUIT" replies "BYE"
+  --raw             Stream every directory to stdout as soon as the scan
+                    finds it, unsorted, without opening the finder
+                    (e.g. cdf --raw | fzf)
+  --transform <t>   Rewrite the selected path before changing to it or
+                    printing it; repeat to chain, applied in order:
+                    resolve-symlinks, clean, strip-prefix=<dir> (for paths
+                    inside dir) or add-prefix=<dir>
+  --relative-to-cwd With --print, output the selection relative to the
+                    current directory (../other for paths outside it)
+  --debug           Enable debug output to stderr (e.g. broken symlinks the
+                    scan skips, and the scan roots as with --show-root)
+  --show-root       Print the directories the scan starts from to stderr,
+                    once the start path, ~ and $VAR, and --roots-config are
+                    resolved, e.g. Scan root: /home/me/src
+  --trace           Write a timing line to stderr for each scan phase (local,
+                    global) and for the whole scan (total), e.g.
+                    cdf-trace phase=local start=... end=... duration_ms=12.3 dirs=40
   --help            Show this help message
   --version         Show version information
 
@@ -179,17 +1207,37 @@ Examples:
   cdf                    # Launch from current directory
   cdf /path/to/start     # Launch from specific directory
   cdf --depth 3          # Limit scan depth to 3 levels
+  cdf --ignore src/gen   # Skip one specific subtree
   cdf --debug            # Enable debug output
 
 Keyboard shortcuts:
   ↑↓ or j/k             Navigate results
   Type                  Filter results
   Enter                 Select directory
-  Escape                Cancel
+  Ctrl+Y                Copy selected path to the clipboard
+  Alt+Y                 Copy the query to the clipboard
+  Ctrl+T                Pin/unpin selected directory at the top
+  Ctrl+D                Scan one level deeper (with --interactive-depth)
+  Ctrl+F                Scan below the selected directory past the depth
+                        limit and merge in its unlisted descendants
+  Ctrl+R                Reload ignore files and rescan
+  Ctrl+E                Write the current results to the --export-file
+  Ctrl+P                Options palette: sort order, grouping, layout, preview
+                        and ignore rules (changing ignore rules rescans)
+  Ctrl+X                Remove selected directory from the list for this session
+  ←/→                   With --breadcrumb, pick a segment of the selected path
+  Alt+1 … Alt+9         With --number-select, select the result with that number
+  Ctrl+A                Hide the parents of the selected directory (again to
+                        show them)
+  Tab                   Lock the query and search within its results
+  Escape                Cancel (or clear the query, see --escape)
+  Ctrl+Q                Cancel
 
 Exit codes:
   0                     Successful directory selection
   1                     Error in scanning or autocd failure
-  2                     User cancelled (Escape pressed)
+  2                     User cancelled (Escape pressed), --max-runtime ran out,
+                        or --count --exit-0 found no matches
+  3                     --roots-config or --query-file had no usable entries
 `)
 }
\ No newline at end of file
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -89,6 +92,42 @@ func TestGetStartPath(t *testing.T) {
 		}
 	})
 
+	t.Run("WithTildeAndVariable", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("CDF_TEST_START", filepath.Join(home, "work"))
+		if err := os.MkdirAll(filepath.Join(home, "work", "api"), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+
+		for _, arg := range []string{"~/work/api", "$CDF_TEST_START/api", "${CDF_TEST_START}/api"} {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cdf", arg}
+			flag.Parse()
+
+			path, err := getStartPath()
+			if err != nil {
+				t.Errorf("getStartPath() with %s failed: %v", arg, err)
+				continue
+			}
+			if path != filepath.Join(home, "work", "api") {
+				t.Errorf("getStartPath() with %s = %s, expected %s", arg, path, filepath.Join(home, "work", "api"))
+			}
+		}
+	})
+
+	t.Run("WithUnknownUserOrVariable", func(t *testing.T) {
+		for _, arg := range []string{"~cdf-no-such-user-xyz", "$CDF_TEST_UNDEFINED"} {
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			os.Args = []string{"cdf", arg}
+			flag.Parse()
+
+			if _, err := getStartPath(); err == nil {
+				t.Errorf("Expected an error for %s", arg)
+			}
+		}
+	})
+
 	t.Run("WithRelativePath", func(t *testing.T) {
 		// Reset flag for testing
 		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -224,7 +263,7 @@ func TestTwoPhaseScanningPriority(t *testing.T) {
 	var phaseBoundaryFound = false
 	
 	for batch := range dirChan {
-		if batch.Err != nil && batch.Err != context.Canceled {
+		if batch.Err != nil && !errors.Is(batch.Err, context.Canceled) {
 			t.Fatalf("Error in scanning: %v", batch.Err)
 		}
 		
@@ -255,4 +294,318 @@ func TestTwoPhaseScanningPriority(t *testing.T) {
 	if !foundLocal {
 		t.Error("Expected to find local directories in two-phase scan results")
 	}
-}
\ No newline at end of file
+
+	// The global phase leaves out the directories leading to the cwd
+	cwd, _ := os.Getwd()
+	ancestors := ancestorPaths(cwd)
+	for _, dir := range allDirs {
+		if ancestors[dir] {
+			t.Errorf("Ancestor %s of the current directory should be omitted", dir)
+		}
+	}
+}
+func TestCheckScanRoot(t *testing.T) {
+	if err := checkScanRoot("/", false); err == nil || !strings.Contains(err.Error(), "--allow-root") {
+		t.Errorf("Expected scanning / without --allow-root to be refused, got %v", err)
+	}
+	if err := checkScanRoot("/", true); err != nil {
+		t.Errorf("--allow-root should permit scanning /, got %v", err)
+	}
+	if err := checkScanRoot(t.TempDir(), false); err != nil {
+		t.Errorf("A regular directory should not be guarded, got %v", err)
+	}
+}
+
+func TestParseAgeSteps(t *testing.T) {
+	steps, err := parseAgeSteps(defaultAgeSteps)
+	if err != nil {
+		t.Fatalf("Default --age-steps rejected: %v", err)
+	}
+	if len(steps) != 3 || steps[0] != 24*time.Hour || steps[2] != 720*time.Hour {
+		t.Errorf("Unexpected default steps %v", steps)
+	}
+	for _, bad := range []string{"", "1h,zz", "0s", "48h,24h", "1h,1h"} {
+		if _, err := parseAgeSteps(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLocalOnlyEmptyRoot(t *testing.T) {
+	emptyRoot := t.TempDir()
+	ignoredRoot := t.TempDir()
+	for _, name := range []string{"node_modules", ".git", "build"} {
+		if err := os.Mkdir(filepath.Join(ignoredRoot, name), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	for name, root := range map[string]string{"Empty": emptyRoot, "AllIgnored": ignoredRoot} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var batches []DirBatch
+			for batch := range scanTwoPhasesWithConfigCtx(ctx, root, ScanConfig{
+				MaxDepth:          3,
+				UseIgnorePatterns: true,
+				InitialBatchSize:  10,
+				MaxBatchSize:      10,
+				LocalOnly:         true,
+			}) {
+				batches = append(batches, batch)
+			}
+
+			// A single, final, empty batch: no global results stand in
+			if len(batches) != 1 {
+				t.Fatalf("Expected exactly one batch, got %+v", batches)
+			}
+			last := batches[0]
+			if !last.Done || last.Err != nil || len(last.Directories) != 0 || last.LocalEmpty {
+				t.Errorf("Expected a clean empty completion, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestTwoPhaseScanMarksEmptyLocalPhase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Depth 0 keeps the global phase to the children of /
+	sawMarker, globalAfterMarker := false, false
+	for batch := range scanTwoPhasesWithConfigCtx(ctx, t.TempDir(), ScanConfig{
+		MaxDepth:          0,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+	}) {
+		if batch.LocalEmpty {
+			if len(batch.Directories) != 0 || batch.Done {
+				t.Errorf("The marker should carry no directories, got %+v", batch)
+			}
+			sawMarker = true
+		} else if sawMarker && len(batch.Directories) > 0 {
+			globalAfterMarker = true
+		} else if len(batch.Directories) > 0 {
+			t.Errorf("Global results arrived before the empty local phase was flagged: %v", batch.Directories)
+		}
+	}
+	if !sawMarker || !globalAfterMarker {
+		t.Errorf("Expected the marker followed by global results (marker %v, global %v)", sawMarker, globalAfterMarker)
+	}
+}
+
+func TestDeepenScanWithNoDeeperDirectoriesKeepsLocalResults(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Everything local is already listed at depth 0; depth 1 adds nothing
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "api"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	for batch := range scanTwoPhasesWithConfigCtx(ctx, root, ScanConfig{
+		MinDepth:          1,
+		MaxDepth:          1,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+	}) {
+		if batch.LocalEmpty {
+			t.Fatal("A deepen scan flagged the starting directory as empty")
+		}
+	}
+}
+
+func TestParseNewerThan(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]time.Time{
+		"48h":                  now.Add(-48 * time.Hour),
+		"90m":                  now.Add(-90 * time.Minute),
+		"2024-05-01T09:00:00Z": time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC),
+		"2024-05-01":           time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+	}
+	for input, expected := range testCases {
+		got, err := parseNewerThan(input, now)
+		if err != nil {
+			t.Errorf("parseNewerThan(%q) failed: %v", input, err)
+		} else if !got.Equal(expected) {
+			t.Errorf("parseNewerThan(%q) = %v, expected %v", input, got, expected)
+		}
+	}
+	for _, bad := range []string{"", "-1h", "0s", "yesterday", "2024-13-01"} {
+		if _, err := parseNewerThan(bad, now); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestTraceTwoPhaseScan(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	// Depth 0 keeps the global phase to the children of /
+	var trace strings.Builder
+	found := 0
+	for batch := range scanTwoPhasesWithConfigCtx(ctx, root, ScanConfig{
+		MaxDepth:          0,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+		Trace:             &trace,
+	}) {
+		found += len(batch.Directories)
+	}
+
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected local, global and total trace lines, got %q", trace.String())
+	}
+	for i, phase := range []string{"local", "global", "total"} {
+		if !strings.HasPrefix(lines[i], "cdf-trace phase="+phase+" start=") || !strings.Contains(lines[i], " duration_ms=") {
+			t.Errorf("Unexpected trace line for %s: %q", phase, lines[i])
+		}
+	}
+	if !strings.HasSuffix(lines[0], " dirs=2") {
+		t.Errorf("Expected the local phase to count 2 directories, got %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], fmt.Sprintf(" dirs=%d", found)) {
+		t.Errorf("Expected the total to count all %d directories, got %q", found, lines[2])
+	}
+}
+
+func TestScanRootsReportsResolvedRoots(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CDF_TEST_START", filepath.Join(home, "work"))
+	api := filepath.Join(home, "work", "api")
+	if err := os.MkdirAll(api, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join(home, "work")); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+
+	// Every form of the path argument reports the same resolved root
+	for _, arg := range []string{api, "api", "./api/", "~/work/api", "$CDF_TEST_START/api"} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cdf", arg}
+		flag.Parse()
+
+		start, err := getStartPath()
+		if err != nil {
+			t.Errorf("getStartPath() with %s failed: %v", arg, err)
+			continue
+		}
+		got := scanRoots(start, false, nil)
+		expected := []string{api, "/ (excluding " + api + ")"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("scanRoots for %s = %q, expected %q", arg, got, expected)
+		}
+		if got := scanRoots(start, true, nil); !reflect.DeepEqual(got, []string{api}) {
+			t.Errorf("scanRoots for %s with --local = %q, expected %q", arg, got, []string{api})
+		}
+	}
+
+	if got := scanRoots("/", false, nil); !reflect.DeepEqual(got, []string{"/"}) {
+		t.Errorf("scanRoots from / = %q, expected a single root", got)
+	}
+
+	// Configured roots replace the starting directory
+	config := filepath.Join(home, "roots")
+	if err := os.WriteFile(config, []byte("~/work\n$CDF_TEST_START/api\n/cdf-no-such-root\n"), 0644); err != nil {
+		t.Fatalf("Failed to write roots file: %v", err)
+	}
+	roots, _, err := usableRoots(config)
+	if err != nil {
+		t.Fatalf("usableRoots failed: %v", err)
+	}
+	if got := scanRoots(api, false, roots); !reflect.DeepEqual(got, []string{filepath.Join(home, "work")}) {
+		t.Errorf("scanRoots with --roots-config = %q, expected %q", got, []string{filepath.Join(home, "work")})
+	}
+}
+
+func TestDepthBaseConventions(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "l1/l2/l3/l4"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+
+	// The deepest level listed for each --depth, counting root's children as 1
+	testCases := []struct {
+		depth, base, deepest int
+	}{
+		{1, 1, 1},
+		{2, 1, 2},
+		{3, 1, 3},
+		{0, 0, 1},
+		{1, 0, 2},
+		{3, 0, 4},
+	}
+	for _, tc := range testCases {
+		maxDepth, err := scanMaxDepth(tc.depth, tc.base)
+		if err != nil {
+			t.Errorf("scanMaxDepth(%d, %d) failed: %v", tc.depth, tc.base, err)
+			continue
+		}
+		deepest := 0
+		for batch := range scanWithConfig(ScanConfig{Root: root, MaxDepth: maxDepth, InitialBatchSize: 10, MaxBatchSize: 10}) {
+			for _, dir := range batch.Directories {
+				rel, _ := filepath.Rel(root, dir)
+				if level := strings.Count(rel, string(filepath.Separator)) + 1; level > deepest {
+					deepest = level
+				}
+			}
+		}
+		if deepest != tc.deepest {
+			t.Errorf("--depth %d --depth-base %d listed down to level %d, expected %d", tc.depth, tc.base, deepest, tc.deepest)
+		}
+	}
+
+	// --focus-depth counts below the selection the same way
+	focusDepths := []struct {
+		focus, base, deepest int
+	}{
+		{1, 1, 1},
+		{2, 1, 2},
+		{1, 0, 2},
+	}
+	for _, tc := range focusDepths {
+		maxDepth, err := scanMaxDepth(tc.focus, tc.base)
+		if err != nil {
+			t.Errorf("scanMaxDepth(%d, %d) failed: %v", tc.focus, tc.base, err)
+			continue
+		}
+		selected := filepath.Join(root, "l1")
+		deepest := 0
+		for batch := range scanWithConfig(ScanConfig{Root: selected, MaxDepth: maxDepth, InitialBatchSize: 10, MaxBatchSize: 10}) {
+			for _, dir := range batch.Directories {
+				rel, _ := filepath.Rel(selected, dir)
+				if level := strings.Count(rel, string(filepath.Separator)) + 1; level > deepest {
+					deepest = level
+				}
+			}
+		}
+		if deepest != tc.deepest {
+			t.Errorf("--focus-depth %d --depth-base %d listed down to level %d below the selection, expected %d", tc.focus, tc.base, deepest, tc.deepest)
+		}
+	}
+
+	for _, tc := range [][2]int{{0, 1}, {-1, 0}, {3, 2}} {
+		if _, err := scanMaxDepth(tc[0], tc[1]); err == nil {
+			t.Errorf("Expected an error for --depth %d --depth-base %d", tc[0], tc[1])
+		}
+	}
+}
@@ -1,8 +1,18 @@
 package main
 
 import (
+	"container/heap"
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
 	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/sahilm/fuzzy"
 )
@@ -24,16 +34,730 @@ func fuzzyMatch(query string, directories []string) []fuzzy.Match {
 	return fuzzy.Find(query, directories)
 }
 
-func formatMatch(match fuzzy.Match) string {
-	dir := match.Str
+// matchKeys is fuzzyMatch over alternate search keys: keys[i] is the text
+// matched for directories[i], while the returned matches carry the original
+// path in Str. With nil keys the directories themselves are matched.
+func matchKeys(query string, directories, keys []string) []fuzzy.Match {
+	if keys == nil {
+		return fuzzyMatch(query, directories)
+	}
+	
+	matches := fuzzyMatch(query, keys)
+	for i := range matches {
+		matches[i].Str = directories[matches[i].Index]
+	}
+	return matches
+}
+
+// withoutSegments drops the components of path named in segments, so
+// ubiquitous names like src do not dilute the match
+func withoutSegments(path string, segments map[string]bool) string {
+	parts := strings.Split(path, "/")
+	kept := parts[:0]
+	for _, part := range parts {
+		if !segments[part] {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "/")
+}
+
+// sampledMatch matches query against at most n directories: the previous
+// matches in rank order first, as they are the likeliest to survive another
+// keystroke, then the most recently discovered directories. Match indexes
+// refer to directories, as with fuzzyMatch.
+func sampledMatch(query string, directories, keys []string, previous []fuzzy.Match, n int) []fuzzy.Match {
+	if keys == nil {
+		keys = directories
+	}
+	
+	indexes := sampleCandidates(len(directories), previous, n)
+	candidates := make([]string, len(indexes))
+	for i, idx := range indexes {
+		candidates[i] = keys[idx]
+	}
+	
+	matches := fuzzyMatch(query, candidates)
+	for i := range matches {
+		matches[i].Index = indexes[matches[i].Index]
+		matches[i].Str = directories[matches[i].Index]
+	}
+	return matches
+}
+
+// refineMatches narrows matches to those also matching query, ranked by how
+// well they match it. An empty query keeps matches as they are.
+func refineMatches(query string, matches []fuzzy.Match, directories, keys []string) []fuzzy.Match {
+	if query == "" {
+		return matches
+	}
+	if keys == nil {
+		keys = directories
+	}
+	
+	candidates := make([]string, len(matches))
+	for i, match := range matches {
+		candidates[i] = keys[match.Index]
+	}
+	
+	refined := fuzzyMatch(query, candidates)
+	for i := range refined {
+		refined[i].Index = matches[refined[i].Index].Index
+		refined[i].Str = directories[refined[i].Index]
+	}
+	return refined
+}
+
+// regexMatch keeps the directories whose search key (see matchKeys) matches
+// query as a Go regular expression. Matches ending nearer the end of the
+// path rank first, so a hit in the basename beats one in a parent; ties keep
+// scan order. An empty query matches everything, as with fuzzyMatch.
+func regexMatch(query string, directories, keys []string) ([]fuzzy.Match, error) {
+	if query == "" {
+		return fuzzyMatch(query, directories), nil
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = directories
+	}
+	
+	var matches []fuzzy.Match
+	for i, key := range keys {
+		if loc := re.FindStringIndex(key); loc != nil {
+			matches = append(matches, fuzzy.Match{
+				Str:            directories[i],
+				Index:          i,
+				Score:          100 - (len(key) - loc[1]),
+				MatchedIndexes: []int{},
+			})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches, nil
+}
+
+// regexRefine is refineMatches for regexMatch: it keeps the matches whose
+// search key also matches query
+func regexRefine(query string, matches []fuzzy.Match, directories, keys []string) ([]fuzzy.Match, error) {
+	if query == "" {
+		return matches, nil
+	}
+	if keys == nil {
+		keys = directories
+	}
+	
+	candidates := make([]string, len(matches))
+	for i, match := range matches {
+		candidates[i] = keys[match.Index]
+	}
+	refined, err := regexMatch(query, candidates, nil)
+	for i := range refined {
+		refined[i].Index = matches[refined[i].Index].Index
+		refined[i].Str = directories[refined[i].Index]
+	}
+	return refined, err
+}
+
+// sampleCandidates returns up to n directory indexes for sampledMatch
+func sampleCandidates(total int, previous []fuzzy.Match, n int) []int {
+	if n > total {
+		n = total
+	}
+	indexes := make([]int, 0, n)
+	seen := make(map[int]bool, n)
+	
+	for _, match := range previous {
+		if len(indexes) >= n {
+			break
+		}
+		if match.Index < total && !seen[match.Index] {
+			seen[match.Index] = true
+			indexes = append(indexes, match.Index)
+		}
+	}
+	
+	for idx := total - 1; idx >= 0 && len(indexes) < n; idx-- {
+		if !seen[idx] {
+			seen[idx] = true
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes
+}
+
+// betterMatch reports whether a ranks above b: higher score first, then
+// earlier discovery, the same order fuzzy.Find produces
+func betterMatch(a, b fuzzy.Match) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Index < b.Index
+}
+
+// matchHeap is a min-heap on match quality, so the worst retained match is
+// at the root and can be evicted cheaply
+type matchHeap []fuzzy.Match
+
+func (h matchHeap) Len() int            { return len(h) }
+func (h matchHeap) Less(i, j int) bool  { return betterMatch(h[j], h[i]) }
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(fuzzy.Match)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	match := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return match
+}
+
+// keepTopMatches merges newly matched candidates into the retained matches and
+// returns the best n of both, ranked. Feeding it batch after batch yields the
+// same top n as matching everything at once.
+func keepTopMatches(retained, candidates []fuzzy.Match, n int) []fuzzy.Match {
+	if n <= 0 {
+		return nil
+	}
+	
+	h := make(matchHeap, 0, n)
+	for _, list := range [][]fuzzy.Match{retained, candidates} {
+		for _, match := range list {
+			if len(h) < n {
+				heap.Push(&h, match)
+			} else if betterMatch(match, h[0]) {
+				h[0] = match
+				heap.Fix(&h, 0)
+			}
+		}
+	}
+	
+	top := []fuzzy.Match(h)
+	sort.Slice(top, func(i, j int) bool { return betterMatch(top[i], top[j]) })
+	return top
+}
+
+// Sort modes for the match list
+const (
+	sortScore  = "score"  // Best fuzzy score first, as ranked by the matcher
+	sortLength = "length" // Shortest basename first, then shortest path
+	// Local (phase 1) matches before global (phase 2) ones, each by score
+	sortInterleave = "interleave"
+)
+
+// sortModes lists the accepted --sort values
+var sortModes = []string{sortScore, sortLength, sortInterleave}
+
+// Orders for the empty-query browse view
+const (
+	browseWalk     = "walk"     // Discovery order, as the scan found them
+	browseAlpha    = "alpha"    // Alphabetical by path
+	browseDepth    = "depth"    // Shallowest first, in discovery order within a level
+	browseFrecency = "frecency" // Most frecent first, per the selection history
+	browseShuffle  = "shuffle"  // A random order fixed by the seed, to sample the tree
+)
+
+// browseOrders lists the accepted --browse-order values
+var browseOrders = []string{browseWalk, browseAlpha, browseDepth, browseFrecency, browseShuffle}
+
+// browseOrder arranges the matches of an empty query, which all score the
+// same, without modifying them
+func browseOrder(matches []fuzzy.Match, order string, frecency map[string]float64, seed int64) []fuzzy.Match {
+	var less func(a, b fuzzy.Match) bool
+	switch order {
+	case browseAlpha:
+		less = func(a, b fuzzy.Match) bool { return a.Str < b.Str }
+	case browseDepth:
+		less = func(a, b fuzzy.Match) bool {
+			return strings.Count(a.Str, string(filepath.Separator)) < strings.Count(b.Str, string(filepath.Separator))
+		}
+	case browseFrecency:
+		less = func(a, b fuzzy.Match) bool { return frecency[a.Str] > frecency[b.Str] }
+	case browseShuffle:
+		// Ranking by a seeded hash of the path rather than permuting keeps
+		// the order steady while the scan adds directories
+		less = func(a, b fuzzy.Match) bool { return shuffleKey(seed, a.Str) < shuffleKey(seed, b.Str) }
+	default:
+		return matches
+	}
+	
+	result := make([]fuzzy.Match, len(matches))
+	copy(result, matches)
+	sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+	return result
+}
+
+// shuffleKey places path in the browseShuffle order for seed
+func shuffleKey(seed int64, path string) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(seed))
+	h.Write(buf[:])
+	h.Write([]byte(path))
+	return h.Sum64()
+}
+
+// Matching algorithms for --algo
+const (
+	algoFuzzy    = "fuzzy"    // Plain fuzzy matching
+	algoInitials = "initials" // Component initials first, e.g. psc for projects/src/components
+)
+
+// initialsScore reports whether query spells the leading characters of
+// successive components of path, and how well: components skipped between
+// the matched ones and after the last one cost points, so the best score goes
+// to a query naming the final components exactly. Matching runs from the
+// deepest component up, as people type the tail of paths they know.
+func initialsScore(query, path string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, false
+	}
+	components := strings.Split(strings.Trim(path, string(filepath.Separator)), string(filepath.Separator))
+	
+	qi := len(q) - 1
+	last, first := -1, -1
+	for ci := len(components) - 1; ci >= 0 && qi >= 0; ci-- {
+		r := []rune(strings.ToLower(components[ci]))
+		if len(r) == 0 || r[0] != q[qi] {
+			continue
+		}
+		if last < 0 {
+			last = ci
+		}
+		first = ci
+		qi--
+	}
+	if qi >= 0 {
+		return 0, false
+	}
+	
+	skipped := (last - first + 1) - len(q)
+	trailing := len(components) - 1 - last
+	return 100 - 10*skipped - 5*trailing, true
+}
+
+// rankInitials moves the matches whose components' initials spell query to
+// the front, best aligned first; the other matches follow in their order.
+// Every initials match is also a fuzzy match, so nothing is added.
+func rankInitials(matches []fuzzy.Match, query string) []fuzzy.Match {
+	type scored struct {
+		match fuzzy.Match
+		score int
+	}
+	var hits []scored
+	var rest []fuzzy.Match
+	for _, match := range matches {
+		if score, ok := initialsScore(query, match.Str); ok {
+			hits = append(hits, scored{match, score})
+		} else {
+			rest = append(rest, match)
+		}
+	}
+	if len(hits) == 0 {
+		return matches
+	}
+	
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	result := make([]fuzzy.Match, 0, len(matches))
+	for _, hit := range hits {
+		result = append(result, hit.match)
+	}
+	return append(result, rest...)
+}
+
+// validSortMode reports whether mode is one of sortModes
+func validSortMode(mode string) bool {
+	for _, m := range sortModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMatches orders matches by mode without modifying them. Ties keep their
+// score order. local holds the directories found by the local phase, for
+// sortInterleave.
+func sortMatches(matches []fuzzy.Match, mode string, local map[string]bool) []fuzzy.Match {
+	if mode != sortLength && mode != sortInterleave {
+		return matches
+	}
+	
+	result := make([]fuzzy.Match, len(matches))
+	copy(result, matches)
+	if mode == sortInterleave {
+		sort.SliceStable(result, func(i, j int) bool {
+			return local[result[i].Str] && !local[result[j].Str]
+		})
+		return result
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		bi, bj := len(filepath.Base(result[i].Str)), len(filepath.Base(result[j].Str))
+		if bi != bj {
+			return bi < bj
+		}
+		return len(result[i].Str) < len(result[j].Str)
+	})
+	return result
+}
+
+// blendFrecency re-ranks matches by their fuzzy score plus weight times the
+// directory's frecency (0 to 1, see frecency), so often visited directories
+// float up without overriding much better matches
+func blendFrecency(matches []fuzzy.Match, scores map[string]float64, weight float64) []fuzzy.Match {
+	if weight == 0 || len(scores) == 0 {
+		return matches
+	}
+	
+	result := make([]fuzzy.Match, len(matches))
+	copy(result, matches)
+	sort.SliceStable(result, func(i, j int) bool {
+		bi := float64(result[i].Score) + frecencyBoost(result[i].Str, scores, weight)
+		bj := float64(result[j].Score) + frecencyBoost(result[j].Str, scores, weight)
+		return bi > bj
+	})
+	return result
+}
+
+// frecencyBoost is what blendFrecency adds to path's fuzzy score
+func frecencyBoost(path string, scores map[string]float64, weight float64) float64 {
+	return weight * scores[path]
+}
+
+// tailBonus is the score a matched character gains with --tail-weight when it
+// falls in the weighted tail segments
+const tailBonus = 10
+
+// tailBoost is what weightTail adds to a match against key: tailBonus for each
+// of matchedIndexes within key's last n path segments
+func tailBoost(key string, matchedIndexes []int, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	start := len(key)
+	for i := 0; i < n && start > 0; i++ {
+		start = strings.LastIndexByte(key[:start], filepath.Separator)
+		if start < 0 {
+			break
+		}
+	}
+	
+	boost := 0
+	for _, idx := range matchedIndexes {
+		if idx > start {
+			boost += tailBonus
+		}
+	}
+	return boost
+}
+
+// weightTail raises each match's score by tailBoost and re-ranks, so a query
+// landing in the last n segments of a path outranks the same query matching
+// an ancestor, which still counts at its plain fuzzy score. keys are the
+// matched texts, as with matchKeys; matches itself is left untouched.
+func weightTail(matches []fuzzy.Match, directories, keys []string, n int) []fuzzy.Match {
+	if n <= 0 {
+		return matches
+	}
+	if keys == nil {
+		keys = directories
+	}
+	
+	result := make([]fuzzy.Match, len(matches))
+	copy(result, matches)
+	for i := range result {
+		result[i].Score += tailBoost(keys[result[i].Index], result[i].MatchedIndexes, n)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Score > result[j].Score })
+	return result
+}
+
+// preferRepos moves repository roots ahead of the other matches with the same
+// score, leaving matches itself untouched
+func preferRepos(matches []fuzzy.Match, repos map[string]bool) []fuzzy.Match {
+	if len(repos) == 0 {
+		return matches
+	}
+	
+	result := make([]fuzzy.Match, len(matches))
+	copy(result, matches)
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return repos[result[i].Str] && !repos[result[j].Str]
+	})
+	return result
+}
+
+// onlyRepos keeps the matches that are repository roots, in their original
+// order
+func onlyRepos(matches []fuzzy.Match, repos map[string]bool) []fuzzy.Match {
+	result := make([]fuzzy.Match, 0, len(repos))
+	for _, match := range matches {
+		if repos[match.Str] {
+			result = append(result, match)
+		}
+	}
+	return result
+}
+
+// collapseChains leaves out the matches that are links in a single-child
+// chain: directories with exactly one listed subdirectory. Only a chain's
+// endpoint and the directories where the tree branches are kept, each under
+// its real path, in their original order.
+func collapseChains(matches []fuzzy.Match, children map[string]int) []fuzzy.Match {
+	result := make([]fuzzy.Match, 0, len(matches))
+	for _, match := range matches {
+		if children[match.Str] != 1 {
+			result = append(result, match)
+		}
+	}
+	return result
+}
+
+// groupKey returns the top-level directory path belongs to: its first
+// component below root, or below / for paths outside root
+func groupKey(path, root string) string {
+	return prefixKey(path, root, 1)
+}
+
+// prefixKey returns the first level components of path below root, or below
+// / for paths outside root; a path with fewer is its own prefix
+func prefixKey(path, root string, level int) string {
+	base := "/"
+	if root != "" && root != "/" && strings.HasPrefix(path, root+"/") {
+		base = root + "/"
+	}
+	if !strings.HasPrefix(path, base) {
+		return path
+	}
+	rest := strings.TrimPrefix(path, base)
+	end := 0
+	for i := 0; i < level; i++ {
+		next := strings.IndexByte(rest[end:], '/')
+		if next < 0 {
+			return path
+		}
+		end += next + 1
+	}
+	return base + rest[:end-1]
+}
+
+// capPerPrefix keeps at most n matches under each prefix (see prefixKey), the
+// best ones as matches are in rank order, so one large tree cannot crowd out
+// the rest. A non-positive n keeps everything.
+func capPerPrefix(matches []fuzzy.Match, root string, level, n int) []fuzzy.Match {
+	if n <= 0 {
+		return matches
+	}
+	counts := make(map[string]int)
+	result := make([]fuzzy.Match, 0, len(matches))
+	for _, match := range matches {
+		key := prefixKey(match.Str, root, level)
+		if counts[key] < n {
+			counts[key]++
+			result = append(result, match)
+		}
+	}
+	return result
+}
+
+// groupMatches reorders matches so each top-level directory's matches are
+// contiguous. Groups are ordered by their best match and keep rank order
+// within, so the list still starts with the best match.
+func groupMatches(matches []fuzzy.Match, root string) []fuzzy.Match {
+	var order []string
+	groups := make(map[string][]fuzzy.Match)
+	for _, match := range matches {
+		key := groupKey(match.Str, root)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], match)
+	}
+	
+	result := make([]fuzzy.Match, 0, len(matches))
+	for _, key := range order {
+		result = append(result, groups[key]...)
+	}
+	return result
+}
+
+// pinnedGroup is the group header pinned matches are listed under
+const pinnedGroup = "📌 Pinned"
+
+// displayGroup returns the header path is listed under in grouped mode
+func displayGroup(path, root string, pinned map[string]bool) string {
+	if pinned[path] {
+		return pinnedGroup
+	}
+	return groupKey(path, root)
+}
+
+// countGroups tallies how many matches fall under each group header
+func countGroups(matches []fuzzy.Match, root string, pinned map[string]bool) map[string]int {
+	counts := make(map[string]int)
+	for _, match := range matches {
+		counts[displayGroup(match.Str, root, pinned)]++
+	}
+	return counts
+}
+
+// pinMatches moves pinned directories to the front of matches in pin order.
+// Pins the query doesn't match are added anyway so they stay visible; pins no
+// longer among directories are dropped.
+func pinMatches(matches []fuzzy.Match, pins []string, directories []string) []fuzzy.Match {
+	if len(pins) == 0 {
+		return matches
+	}
 	
-	if strings.HasPrefix(dir, homeDir()) {
-		dir = "~" + strings.TrimPrefix(dir, homeDir())
+	position := make(map[string]int, len(pins))
+	for i, pin := range pins {
+		position[pin] = i
 	}
 	
+	pinned := make([]*fuzzy.Match, len(pins))
+	rest := make([]fuzzy.Match, 0, len(matches))
+	for i := range matches {
+		if pos, ok := position[matches[i].Str]; ok {
+			pinned[pos] = &matches[i]
+		} else {
+			rest = append(rest, matches[i])
+		}
+	}
+	
+	result := make([]fuzzy.Match, 0, len(pins)+len(rest))
+	for pos, match := range pinned {
+		if match != nil {
+			result = append(result, *match)
+			continue
+		}
+		for idx, dir := range directories {
+			if dir == pins[pos] {
+				result = append(result, fuzzy.Match{Str: dir, Index: idx, MatchedIndexes: []int{}})
+				break
+			}
+		}
+	}
+	return append(result, rest...)
+}
+
+func formatMatch(match fuzzy.Match) string {
+	return displayCache.get(match.Str, homeDir())
+}
+
+// formatPath shortens dir for display by writing home as ~. An empty home
+// leaves every path as it is, and only whole components are replaced, so
+// /home/alice is not shortened for a home of /home/al.
+func formatPath(dir, home string) string {
+	home = strings.TrimSuffix(home, string(filepath.Separator))
+	if home == "" {
+		return dir
+	}
+	if dir == home || strings.HasPrefix(dir, home+string(filepath.Separator)) {
+		dir = "~" + strings.TrimPrefix(dir, home)
+	}
 	return dir
 }
 
+// abbreviatePath shortens every component of dir to its first letter, after
+// writing home as ~ as formatPath does: ~/p/w/s for ~/projects/webapp/src.
+// Leading dots are kept, so ~/.config/nvim is ~/.c/n.
+func abbreviatePath(dir, home string) string {
+	parts := strings.Split(formatPath(dir, home), string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" || part == "~" && i == 0 {
+			continue
+		}
+		name := strings.TrimLeft(part, ".")
+		if r, _ := utf8.DecodeRuneInString(name); name != "" {
+			parts[i] = part[:len(part)-len(name)] + string(r)
+		}
+	}
+	return strings.Join(parts, string(filepath.Separator))
+}
+
+// crumb is one segment of the breadcrumb bar
+type crumb struct {
+	Label string // Component name, or ~ or / for the first segment
+	Path  string // Directory the segment stands for
+}
+
+// breadcrumb splits dir into its segments from the top down, starting at ~
+// for directories under home as formatPath does
+func breadcrumb(dir, home string) []crumb {
+	home = strings.TrimSuffix(home, string(filepath.Separator))
+	var crumbs []crumb
+	for dir = filepath.Clean(dir); ; dir = filepath.Dir(dir) {
+		parent := filepath.Dir(dir)
+		switch {
+		case home != "" && dir == home:
+			return append([]crumb{{Label: "~", Path: dir}}, crumbs...)
+		case parent == dir:
+			return append([]crumb{{Label: dir, Path: dir}}, crumbs...)
+		}
+		crumbs = append([]crumb{{Label: filepath.Base(dir), Path: dir}}, crumbs...)
+	}
+}
+
+// displayCacheSize bounds the formatted paths kept by displayCache, a few
+// screens' worth of rows
+const displayCacheSize = 1024
+
+// displayCache remembers formatted paths across redraws
+var displayCache = newFormatCache(displayCacheSize)
+
+// formatCache is a small LRU of formatPath results keyed by raw path. It is
+// cleared whenever the home directory it was filled for changes.
+type formatCache struct {
+	mu       sync.Mutex
+	capacity int
+	home     string
+	order    *list.List // Front is most recently used
+	items    map[string]*list.Element
+}
+
+// formatEntry is a formatCache list element
+type formatEntry struct {
+	path    string
+	display string
+}
+
+func newFormatCache(capacity int) *formatCache {
+	return &formatCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// get returns formatPath(path, home), computing it only on a miss
+func (c *formatCache) get(path, home string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if home != c.home {
+		c.order.Init()
+		c.items = make(map[string]*list.Element, c.capacity)
+		c.home = home
+	}
+	if elem, ok := c.items[path]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*formatEntry).display
+	}
+	
+	display := formatPath(path, home)
+	c.items[path] = c.order.PushFront(&formatEntry{path: path, display: display})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*formatEntry).path)
+	}
+	return display
+}
+
 func getMatchScore(match fuzzy.Match) int {
 	if match.Score < 0 {
 		return 0
@@ -41,10 +765,57 @@ func getMatchScore(match fuzzy.Match) int {
 	return match.Score
 }
 
+// homeDir returns the user's home directory, or "" when it can't be found.
+// The account database is the fallback, so an unset $HOME doesn't lose the
+// abbreviation.
 func homeDir() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return ""
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
 	}
-	return home
-}
\ No newline at end of file
+	if u, err := user.Current(); err == nil {
+		return u.HomeDir
+	}
+	return ""
+}
+
+// matchCacheSize bounds the queries remembered by matchCache, enough to
+// cover backspacing through a typed query and retyping it
+const matchCacheSize = 32
+
+// matchCache remembers full match results by query for one directory list.
+// It must be reset whenever that list changes; the caller must hold the
+// session's write lock.
+type matchCache struct {
+	results map[string][]fuzzy.Match
+	order   []string // Cached queries, oldest first
+}
+
+// get returns a copy of the cached matches for query
+func (c *matchCache) get(query string) ([]fuzzy.Match, bool) {
+	matches, ok := c.results[query]
+	if !ok {
+		return nil, false
+	}
+	return append([]fuzzy.Match(nil), matches...), true
+}
+
+// put remembers a copy of matches for query, evicting the oldest query once
+// matchCacheSize is reached
+func (c *matchCache) put(query string, matches []fuzzy.Match) {
+	if c.results == nil {
+		c.results = make(map[string][]fuzzy.Match, matchCacheSize)
+	}
+	if _, ok := c.results[query]; !ok {
+		if len(c.order) >= matchCacheSize {
+			delete(c.results, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, query)
+	}
+	c.results[query] = append([]fuzzy.Match(nil), matches...)
+}
+
+// reset forgets every cached query
+func (c *matchCache) reset() {
+	c.results, c.order = nil, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -86,7 +87,7 @@ func TestFormatMatch(t *testing.T) {
 	}{
 		{"/home/testuser/projects/myapp", "~/projects/myapp"},
 		{"/home/testuser/documents", "~/documents"},
-		{"/var/log/apps", "/var/log/apps"}, // Should not be modified
+		{"/var/log/apps", "/var/log/apps"},   // Should not be modified
 		{"/usr/local/bin", "/usr/local/bin"}, // Should not be modified
 	}
 
@@ -136,4 +137,629 @@ func TestHomeDir(t *testing.T) {
 	if err == nil && home != expectedHome {
 		t.Errorf("homeDir() = %s, expected %s", home, expectedHome)
 	}
+}
+
+func TestFormatWithoutHome(t *testing.T) {
+	t.Setenv("HOME", "")
+	os.Unsetenv("HOME")
+
+	// Whatever the fallbacks find, nothing outside it is abbreviated
+	home := homeDir()
+	for _, dir := range []string{"/srv/api", "/", "/opt/tools/bin"} {
+		if home != "" && (dir == home || strings.HasPrefix(dir, home+"/")) {
+			continue
+		}
+		if got := formatMatch(fuzzy.Match{Str: dir}); got != dir {
+			t.Errorf("formatMatch(%s) = %s with HOME unset", dir, got)
+		}
+	}
+
+	// An unknown home shortens nothing
+	for _, dir := range []string{"/srv/api", "/", ""} {
+		if got := formatPath(dir, ""); got != dir {
+			t.Errorf("formatPath(%q, \"\") = %q, expected it unchanged", dir, got)
+		}
+	}
+	if got := formatPath("/x/y", "/"); got != "/x/y" {
+		t.Errorf("A home of / shortened %q", got)
+	}
+	if got := formatPath("/home/alice/src", "/home/al"); got != "/home/alice/src" {
+		t.Errorf("Partial component replaced: %q", got)
+	}
+	if got := formatPath("/home/al/src", "/home/al/"); got != "~/src" {
+		t.Errorf("formatPath with a trailing slash on home = %q, expected ~/src", got)
+	}
+}
+
+func TestBreadcrumb(t *testing.T) {
+	testCases := []struct {
+		dir     string
+		home    string
+		labels  string
+		topPath string
+	}{
+		{"/home/me/projects/app/src", "/home/me", "~ projects app src", "/home/me"},
+		{"/home/me", "/home/me/", "~", "/home/me"},
+		{"/srv/data/logs", "/home/me", "/ srv data logs", "/"},
+		{"/home/mentor/notes", "/home/me", "/ home mentor notes", "/"},
+		{"/srv/data/", "", "/ srv data", "/"},
+		{"/", "/home/me", "/", "/"},
+	}
+
+	for _, tc := range testCases {
+		crumbs := breadcrumb(tc.dir, tc.home)
+		var labels []string
+		for _, c := range crumbs {
+			labels = append(labels, c.Label)
+		}
+		if got := strings.Join(labels, " "); got != tc.labels {
+			t.Errorf("breadcrumb(%q, %q) labels = %q, expected %q", tc.dir, tc.home, got, tc.labels)
+		}
+		if crumbs[0].Path != tc.topPath {
+			t.Errorf("breadcrumb(%q, %q) starts at %q, expected %q", tc.dir, tc.home, crumbs[0].Path, tc.topPath)
+		}
+	}
+
+	// Each segment stands for the directory up to it
+	crumbs := breadcrumb("/home/me/projects/app", "/home/me")
+	expected := []string{"/home/me", "/home/me/projects", "/home/me/projects/app"}
+	for i, c := range crumbs {
+		if c.Path != expected[i] {
+			t.Errorf("Segment %d (%s) stands for %q, expected %q", i, c.Label, c.Path, expected[i])
+		}
+	}
+}
+
+func TestAbbreviatePath(t *testing.T) {
+	testCases := []struct {
+		dir      string
+		home     string
+		expected string
+	}{
+		{"/home/me/projects/webapp/src", "/home/me", "~/p/w/s"},
+		{"/home/me", "/home/me", "~"},
+		{"/etc/nginx/sites-enabled", "/home/me", "/e/n/s"},
+		{"/home/me/.config/nvim", "/home/me", "~/.c/n"},
+		{"/srv/ünïcode/data", "", "/s/ü/d"},
+		{"/srv/~backup", "", "/s/~"},
+	}
+
+	for _, tc := range testCases {
+		if got := abbreviatePath(tc.dir, tc.home); got != tc.expected {
+			t.Errorf("abbreviatePath(%q, %q) = %q, expected %q", tc.dir, tc.home, got, tc.expected)
+		}
+	}
+}
+
+func TestSampleCandidates(t *testing.T) {
+	previous := []fuzzy.Match{{Index: 7}, {Index: 2}, {Index: 7}}
+
+	indexes := sampleCandidates(10, previous, 4)
+
+	// Previous matches first in rank order, then the most recent directories
+	expected := []int{7, 2, 9, 8}
+	if len(indexes) != len(expected) {
+		t.Fatalf("sampleCandidates returned %v, expected %v", indexes, expected)
+	}
+	for i := range expected {
+		if indexes[i] != expected[i] {
+			t.Fatalf("sampleCandidates returned %v, expected %v", indexes, expected)
+		}
+	}
+
+	if got := sampleCandidates(3, nil, 10); len(got) != 3 {
+		t.Errorf("Sample larger than the list should return every directory, got %v", got)
+	}
+}
+
+func TestSampledMatchIndexes(t *testing.T) {
+	directories := []string{"/srv/api", "/srv/web", "/srv/api-docs", "/srv/db"}
+
+	matches := sampledMatch("api", directories, nil, nil, 2)
+
+	// Only the two most recent directories are sampled
+	if len(matches) != 1 {
+		t.Fatalf("Expected 1 match from the sample, got %d", len(matches))
+	}
+	if directories[matches[0].Index] != matches[0].Str {
+		t.Errorf("Match index %d does not point at %s", matches[0].Index, matches[0].Str)
+	}
+}
+
+func TestPinMatches(t *testing.T) {
+	directories := []string{"/srv/api", "/srv/web", "/srv/db", "/srv/cache"}
+	matches := fuzzyMatch("srv", directories)
+
+	result := pinMatches(matches, []string{"/srv/db", "/srv/gone", "/srv/web"}, directories)
+
+	expected := []string{"/srv/db", "/srv/web", "/srv/api", "/srv/cache"}
+	if len(result) != len(expected) {
+		t.Fatalf("pinMatches returned %d matches, expected %d", len(result), len(expected))
+	}
+	for i, path := range expected {
+		if result[i].Str != path {
+			t.Errorf("result[%d] = %s, expected %s", i, result[i].Str, path)
+		}
+	}
+
+	// Pins stay visible even when the query doesn't match them
+	result = pinMatches(fuzzyMatch("api", directories), []string{"/srv/db"}, directories)
+	if len(result) == 0 || result[0].Str != "/srv/db" || directories[result[0].Index] != "/srv/db" {
+		t.Errorf("Expected non-matching pin first with a valid index, got %+v", result)
+	}
+}
+
+func TestKeepTopMatchesAcrossBatches(t *testing.T) {
+	directories := []string{
+		"/x/apiary", "/srv/api", "/home/a/p/i", "/api",
+		"/opt/rapid", "/data/api-docs", "/misc", "/var/capital",
+		"/usr/api/v2", "/tmp/aaa/ppp/iii",
+	}
+
+	// Feed the directories in three uneven batches
+	var retained []fuzzy.Match
+	for _, bounds := range [][2]int{{0, 3}, {3, 4}, {4, 10}} {
+		fresh := fuzzyMatch("api", directories[bounds[0]:bounds[1]])
+		for i := range fresh {
+			fresh[i].Index += bounds[0]
+		}
+		retained = keepTopMatches(retained, fresh, 3)
+	}
+
+	global := fuzzyMatch("api", directories)[:3]
+	if len(retained) != len(global) {
+		t.Fatalf("Retained %d matches, expected %d", len(retained), len(global))
+	}
+	for i := range global {
+		if retained[i].Str != global[i].Str {
+			t.Errorf("retained[%d] = %s, expected the global top %s", i, retained[i].Str, global[i].Str)
+		}
+	}
+
+	if got := keepTopMatches(retained, nil, 0); got != nil {
+		t.Errorf("A cap of 0 should keep nothing, got %v", got)
+	}
+}
+
+func TestRefineMatches(t *testing.T) {
+	directories := []string{"/work/api/docs", "/work/api/src", "/work/web/docs", "/home/docs"}
+
+	primary := fuzzyMatch("api", directories)
+	refined := refineMatches("docs", primary, directories, nil)
+	if len(refined) != 1 || refined[0].Str != "/work/api/docs" || refined[0].Index != 0 {
+		t.Errorf("Expected only /work/api/docs (index 0), got %+v", refined)
+	}
+
+	if got := refineMatches("", primary, directories, nil); len(got) != len(primary) {
+		t.Errorf("An empty refinement should keep all %d matches, got %d", len(primary), len(got))
+	}
+}
+
+func TestGroupMatches(t *testing.T) {
+	root := "/home/me"
+	paths := []string{
+		"/home/me/api/src",
+		"/home/me/web/src",
+		"/home/me/api/docs",
+		"/usr/share/api",
+		"/home/me/api",
+		"/home/me/web",
+	}
+	matches := make([]fuzzy.Match, len(paths))
+	for i, path := range paths {
+		matches[i] = fuzzy.Match{Str: path, Index: i}
+	}
+
+	grouped := groupMatches(matches, root)
+	var got []string
+	for _, match := range grouped {
+		got = append(got, match.Str)
+	}
+	expected := []string{
+		"/home/me/api/src", "/home/me/api/docs", "/home/me/api",
+		"/home/me/web/src", "/home/me/web",
+		"/usr/share/api",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("groupMatches order = %v, expected %v", got, expected)
+	}
+
+	keys := map[string]string{
+		"/home/me/api/src": "/home/me/api",
+		"/home/me/api":     "/home/me/api",
+		"/usr/share/api":   "/usr",
+		"/home/other":      "/home",
+	}
+	for path, key := range keys {
+		if got := groupKey(path, root); got != key {
+			t.Errorf("groupKey(%s) = %s, expected %s", path, got, key)
+		}
+	}
+}
+
+func TestCapPerPrefix(t *testing.T) {
+	root := "/home/me"
+	var matches []fuzzy.Match
+	add := func(path string) {
+		matches = append(matches, fuzzy.Match{Str: path, Index: len(matches)})
+	}
+	// One large project dominates, interleaved with a few others
+	for i := 0; i < 40; i++ {
+		add(fmt.Sprintf("/home/me/monorepo/pkg%02d/src", i))
+		if i%10 == 0 {
+			add(fmt.Sprintf("/home/me/tools/t%d", i))
+		}
+	}
+	add("/home/me/notes")
+	add("/usr/share/doc")
+	add("/usr/lib/x")
+
+	capped := capPerPrefix(matches, root, 1, 3)
+	counts := make(map[string]int)
+	var got []string
+	for _, match := range capped {
+		counts[prefixKey(match.Str, root, 1)]++
+		got = append(got, match.Str)
+	}
+	for prefix, count := range counts {
+		if count > 3 {
+			t.Errorf("Prefix %s kept %d matches, expected at most 3", prefix, count)
+		}
+	}
+	expected := []string{
+		"/home/me/monorepo/pkg00/src", "/home/me/tools/t0", "/home/me/monorepo/pkg01/src", "/home/me/monorepo/pkg02/src",
+		"/home/me/tools/t10", "/home/me/tools/t20", "/home/me/notes", "/usr/share/doc", "/usr/lib/x",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("capPerPrefix kept %v, expected %v", got, expected)
+	}
+
+	// A deeper prefix caps each package on its own instead
+	if capped := capPerPrefix(matches, root, 2, 1); len(capped) != len(matches) {
+		t.Errorf("Expected every package to keep its one match at depth 2, kept %d of %d", len(capped), len(matches))
+	}
+	if capped := capPerPrefix(matches, root, 1, 0); len(capped) != len(matches) {
+		t.Errorf("Expected no limit with n = 0, kept %d of %d", len(capped), len(matches))
+	}
+
+	keys := map[string]string{
+		"/home/me/monorepo/pkg01/src": "/home/me/monorepo/pkg01",
+		"/home/me/monorepo":           "/home/me/monorepo",
+		"/usr/share/doc":              "/usr/share",
+		"/usr":                        "/usr",
+	}
+	for path, key := range keys {
+		if got := prefixKey(path, root, 2); got != key {
+			t.Errorf("prefixKey(%s, 2) = %s, expected %s", path, got, key)
+		}
+	}
+}
+
+func TestPreferRepos(t *testing.T) {
+	directories := []string{"/work/api-docs", "/work/api-repo", "/srv/x/a/p/i"}
+	matches := fuzzyMatch("api", directories)
+	before := make([]string, len(matches))
+	for i, match := range matches {
+		before[i] = match.Str
+	}
+
+	repos := map[string]bool{"/work/api-docs": true}
+	preferred := preferRepos(matches, repos)
+
+	// /srv/x/a/p/i scores higher and stays first; of the two equal scores
+	// the repo root wins
+	expected := []string{"/srv/x/a/p/i", "/work/api-docs", "/work/api-repo"}
+	for i, path := range expected {
+		if preferred[i].Str != path {
+			t.Errorf("preferred[%d] = %s (score %d), expected %s", i, preferred[i].Str, preferred[i].Score, path)
+		}
+	}
+	for i, match := range matches {
+		if match.Str != before[i] {
+			t.Error("preferRepos modified its input")
+			break
+		}
+	}
+}
+
+func TestSortMatchesByLength(t *testing.T) {
+	directories := []string{
+		"/work/deep/nested/project-api",
+		"/srv/api",
+		"/work/api-gateway",
+		"/a/b/c/d/api",
+		"/opt/apis",
+	}
+	matches := fuzzyMatch("api", directories)
+
+	sorted := sortMatches(matches, sortLength, nil)
+	var got []string
+	for _, match := range sorted {
+		got = append(got, match.Str)
+	}
+	expected := []string{"/srv/api", "/a/b/c/d/api", "/opt/apis", "/work/api-gateway", "/work/deep/nested/project-api"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Length order = %v, expected %v", got, expected)
+	}
+
+	if scored := sortMatches(matches, sortScore, nil); &scored[0] != &matches[0] {
+		t.Error("Score mode should keep the matcher's order as is")
+	}
+	if !validSortMode("length") || validSortMode("size") {
+		t.Error("validSortMode accepted or rejected the wrong modes")
+	}
+}
+
+func TestSortMatchesInterleave(t *testing.T) {
+	matches := []fuzzy.Match{
+		{Str: "/srv/api", Score: 50},
+		{Str: "/home/me/src/api-old", Score: 30},
+		{Str: "/opt/api", Score: 45},
+		{Str: "/home/me/src/apis", Score: 20},
+	}
+	local := map[string]bool{"/home/me/src/api-old": true, "/home/me/src/apis": true}
+
+	var got []string
+	for _, match := range sortMatches(matches, sortInterleave, local) {
+		got = append(got, match.Str)
+	}
+	expected := []string{"/home/me/src/api-old", "/home/me/src/apis", "/srv/api", "/opt/api"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Interleave order = %v, expected %v", got, expected)
+	}
+}
+
+func TestFormatCache(t *testing.T) {
+	cache := newFormatCache(2)
+
+	if got := cache.get("/home/a/x", "/home/a"); got != "~/x" {
+		t.Errorf("Expected ~/x, got %q", got)
+	}
+	cache.get("/home/a/y", "/home/a")
+	cache.get("/home/a/x", "/home/a") // x is now the most recent
+	cache.get("/home/a/z", "/home/a") // evicts y
+
+	if _, ok := cache.items["/home/a/y"]; ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.items["/home/a/x"]; !ok || cache.order.Len() != 2 {
+		t.Errorf("Expected x and z to remain, got %d entries", cache.order.Len())
+	}
+
+	// A different home means every cached display string is stale
+	if got := cache.get("/home/a/x", "/home/b"); got != "/home/a/x" {
+		t.Errorf("Expected the cache to be invalidated by a home change, got %q", got)
+	}
+	if cache.order.Len() != 1 {
+		t.Errorf("Expected only the fresh entry after invalidation, got %d", cache.order.Len())
+	}
+}
+
+func TestCountGroups(t *testing.T) {
+	var matches []fuzzy.Match
+	for _, path := range []string{
+		"/home/me/projects/a", "/home/me/projects/b/c", "/home/me/projects/d",
+		"/home/me/notes/x",
+		"/srv/app", "/srv/api",
+		"/home/me/projects/pinned",
+	} {
+		matches = append(matches, fuzzy.Match{Str: path})
+	}
+
+	counts := countGroups(matches, "/home/me", map[string]bool{"/home/me/projects/pinned": true})
+	expected := map[string]int{
+		"/home/me/projects": 3,
+		"/home/me/notes":    1,
+		"/srv":              2,
+		pinnedGroup:         1,
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("countGroups = %v, expected %v", counts, expected)
+	}
+	for key, count := range expected {
+		if counts[key] != count {
+			t.Errorf("Group %s: expected %d matches, got %d", key, count, counts[key])
+		}
+	}
+}
+
+func TestInitialsScore(t *testing.T) {
+	tests := []struct {
+		query, path string
+		score       int
+		ok          bool
+	}{
+		{"psc", "/home/me/projects/src/components", 100, true},
+		{"PSC", "/home/me/projects/src/components", 100, true},
+		{"psc", "/home/me/projects/src/components/button", 95, true},
+		{"psc", "/home/me/projects/old/src/components", 90, true},
+		{"psc", "/home/me/projects/src", 0, false},
+		{"psc", "/home/me/pics", 0, false},
+		{"", "/home/me", 0, false},
+	}
+	for _, test := range tests {
+		score, ok := initialsScore(test.query, test.path)
+		if ok != test.ok || score != test.score {
+			t.Errorf("initialsScore(%q, %q) = %d, %v, expected %d, %v", test.query, test.path, score, ok, test.score, test.ok)
+		}
+	}
+}
+
+func TestInitialsRankAboveFuzzy(t *testing.T) {
+	directories := []string{
+		"/home/me/pics",
+		"/srv/psc",
+		"/home/me/projects/src/components",
+		"/opt/pascal",
+		"/home/me/projects/src/components/icons",
+	}
+	matches := fuzzyMatch("psc", directories)
+	if len(matches) < 4 {
+		t.Fatalf("Expected several incidental fuzzy matches, got %v", matches)
+	}
+	if matches[0].Str == "/home/me/projects/src/components" {
+		t.Fatalf("Fixture should rank an incidental match first with plain fuzzy, got %v", matches)
+	}
+
+	ranked := rankInitials(matches, "psc")
+	if len(ranked) != len(matches) {
+		t.Fatalf("rankInitials changed the match count: %d vs %d", len(ranked), len(matches))
+	}
+	if ranked[0].Str != "/home/me/projects/src/components" || ranked[1].Str != "/home/me/projects/src/components/icons" {
+		t.Errorf("Expected the initials matches first, best aligned first, got %v", ranked)
+	}
+}
+
+func TestIgnoreSegmentsMatching(t *testing.T) {
+	segments := map[string]bool{"src": true, "app": true, "internal": true}
+	directories := []string{"/w/app/src/internal/auth", "/w/auth-service", "/w/src/main", "/w/lib/util"}
+
+	if got := withoutSegments(directories[0], segments); got != "/w/auth" {
+		t.Errorf("withoutSegments(%s) = %s, expected /w/auth", directories[0], got)
+	}
+
+	stripped := make([]string, len(directories))
+	for i, dir := range directories {
+		stripped[i] = withoutSegments(dir, segments)
+	}
+	for _, query := range []string{"auth", "wa", "main", "wu", "internal", "src"} {
+		state := &uiState{config: TUIConfig{IgnoreSegments: segments}}
+		state.addDirectories(directories)
+		state.query = query
+		state.rematch()
+
+		// Same ranking as matching the stripped paths directly, reported
+		// with the full paths
+		expected := fuzzyMatch(query, stripped)
+		if len(state.matches) != len(expected) {
+			t.Errorf("Query %q: got %d matches, expected %d", query, len(state.matches), len(expected))
+			continue
+		}
+		for i, match := range expected {
+			if state.matches[i].Str != directories[match.Index] || state.matches[i].Score != match.Score {
+				t.Errorf("Query %q: match %d = %s (%d), expected %s (%d)", query, i,
+					state.matches[i].Str, state.matches[i].Score, directories[match.Index], match.Score)
+			}
+		}
+	}
+
+	// The ignored names themselves no longer match anything
+	state := &uiState{config: TUIConfig{IgnoreSegments: segments}}
+	state.addDirectories(directories)
+	state.query = "internal"
+	state.rematch()
+	if len(state.matches) != 0 {
+		t.Errorf("Expected no match for an ignored segment, got %v", state.matches)
+	}
+}
+
+func TestRegexQueries(t *testing.T) {
+	directories := []string{"/home/me/projects/web-api", "/srv/api/logs", "/home/me/proj-api", "/tmp/notes"}
+	newState := func() *uiState {
+		state := &uiState{config: TUIConfig{Regex: true}}
+		state.addDirectories(directories)
+		return state
+	}
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		// Basename hits rank before hits in a parent; ties keep scan order
+		{"api", []string{"/home/me/projects/web-api", "/home/me/proj-api", "/srv/api/logs"}},
+		{"proj.*api$", []string{"/home/me/projects/web-api", "/home/me/proj-api"}},
+		{"^/srv/", []string{"/srv/api/logs"}},
+		{"^notes$", nil},
+	}
+	for _, tc := range testCases {
+		state := newState()
+		state.query = tc.query
+		state.rematch()
+		var got []string
+		for _, match := range state.matches {
+			got = append(got, match.Str)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("Query %q matched %v, expected %v", tc.query, got, tc.expected)
+		}
+		if state.regexErr != nil {
+			t.Errorf("Query %q: unexpected error %v", tc.query, state.regexErr)
+		}
+	}
+
+	// An invalid expression matches nothing and says why, without panicking
+	state := newState()
+	state.query = "proj(api"
+	state.rematch()
+	if len(state.matches) != 0 || state.regexErr == nil {
+		t.Fatalf("Expected no matches and an error, got %v, %v", state.matches, state.regexErr)
+	}
+	if msg := state.view().StatusMsg; !strings.Contains(msg, "missing closing )") {
+		t.Errorf("Expected the compile error in the status bar, got %q", msg)
+	}
+
+	// Completing the expression clears the error
+	state.query = "proj(api)?"
+	state.rematch()
+	if state.regexErr != nil || len(state.matches) != 2 {
+		t.Errorf("Expected 2 matches once valid, got %v, %v", state.matches, state.regexErr)
+	}
+
+	// A locked term refines with the expression too
+	state.locked, state.query = "^/home", "api$"
+	state.rematch()
+	if len(state.matches) != 2 {
+		t.Errorf("Expected both /home api directories, got %v", state.matches)
+	}
+}
+
+func TestTailWeight(t *testing.T) {
+	directories := []string{"/srv/api/docs", "/srv/docs/api", "/api/srv/docs"}
+	rank := func(tail int) map[string]int {
+		state := &uiState{config: TUIConfig{TailWeight: tail}}
+		state.addDirectories(directories)
+		state.query = "api"
+		state.rematch()
+		positions := make(map[string]int)
+		for i, match := range state.matches {
+			positions[match.Str] = i
+		}
+		return positions
+	}
+
+	// Both hit a whole segment, so the fuzzy score alone can't tell them apart
+	matches := fuzzyMatch("api", directories[:2])
+	if len(matches) != 2 || matches[0].Score != matches[1].Score {
+		t.Fatalf("Expected equal plain scores, got %+v", matches)
+	}
+	positions := rank(1)
+	if len(positions) != len(directories) {
+		t.Fatalf("Expected ancestor matches to be kept, got %v", positions)
+	}
+	if positions["/srv/docs/api"] != 0 {
+		t.Errorf("Expected the basename match first, got %v", positions)
+	}
+	positions = rank(2)
+	if positions["/api/srv/docs"] != 2 {
+		t.Errorf("Expected matches in the last two segments before the root-level one, got %v", positions)
+	}
+
+	cases := []struct {
+		key     string
+		indexes []int
+		n       int
+		want    int
+	}{
+		{"/srv/docs/api", []int{10, 11, 12}, 1, 3 * tailBonus},
+		{"/srv/api/docs", []int{5, 6, 7}, 1, 0},
+		{"/srv/api/docs", []int{5, 6, 7}, 2, 3 * tailBonus},
+		{"/srv/api/docs", []int{1, 5}, 2, tailBonus},
+		{"api", []int{0, 1, 2}, 1, 3 * tailBonus},
+		{"/srv/api/docs", []int{5, 6, 7}, 0, 0},
+	}
+	for _, c := range cases {
+		if got := tailBoost(c.key, c.indexes, c.n); got != c.want {
+			t.Errorf("tailBoost(%q, %v, %d) = %d, expected %d", c.key, c.indexes, c.n, got, c.want)
+		}
+	}
 }
\ No newline at end of file
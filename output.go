@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+)
+
+// outputPath formats a selected directory for print mode. With relative set
+// it is expressed relative to cwd, using .. segments for selections outside
+// it; when no relative path exists (e.g. another volume) it stays absolute.
+func outputPath(selected, cwd string, relative bool) string {
+	if !relative || cwd == "" {
+		return selected
+	}
+	rel, err := filepath.Rel(cwd, selected)
+	if err != nil {
+		return selected
+	}
+	return rel
+}
+
+// writeSelection writes the --print result: the path and a newline, nothing
+// else, as the finder itself draws on the terminal and not on stdout
+func writeSelection(w io.Writer, path string) error {
+	_, err := io.WriteString(w, path+"\n")
+	return err
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// mainArgsEnv holds the arguments TestRunMainProcess runs main with, one per
+// line; when unset that test does nothing
+const mainArgsEnv = "CDF_TEST_MAIN_ARGS"
+
+// TestRunMainProcess runs main in a child process started by another test,
+// so that test sees exactly what cdf writes to stdout and the terminal
+func TestRunMainProcess(t *testing.T) {
+	args := os.Getenv(mainArgsEnv)
+	if args == "" {
+		return
+	}
+	os.Args = append([]string{"cdf"}, strings.Split(args, "\n")...)
+	main()
+	// Before the testing package can report on stdout
+	os.Exit(0)
+}
+
+// openPTY opens a pseudo-terminal pair sized 80x24
+func openPTY(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("No pseudo-terminals: %v", err)
+	}
+	var unlock int32
+	var n uint32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		t.Skipf("Unlocking the pseudo-terminal: %v", err)
+	}
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		t.Skipf("Naming the pseudo-terminal: %v", err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("Opening the pseudo-terminal: %v", err)
+	}
+	size := struct{ rows, cols, x, y uint16 }{24, 80, 0, 0}
+	if err := ioctl(slave, syscall.TIOCSWINSZ, unsafe.Pointer(&size)); err != nil {
+		t.Fatalf("Sizing the pseudo-terminal: %v", err)
+	}
+	return master, slave
+}
+
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// syncBuffer is a bytes.Buffer safe to read while another goroutine writes
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPrintModeStdoutHoldsOnlyThePath(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "zzonly")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	master, slave := openPTY(t)
+	defer master.Close()
+
+	// The child's controlling terminal is the pseudo-terminal, while its
+	// stdout is a buffer of its own
+	var stdout bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunMainProcess$")
+	cmd.Env = append(os.Environ(), mainArgsEnv+"=--print\n--local\n"+root, "TERM=xterm", "HOME="+t.TempDir())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, &stdout, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start cdf: %v", err)
+	}
+	slave.Close()
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var terminal syncBuffer
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			terminal.Write(buf[:n])
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Enter once the finder has drawn the directory on the terminal; its
+	// row may be truncated, the match count is not
+	deadline := time.After(10 * time.Second)
+	for !strings.Contains(terminal.String(), "1 matches") {
+		select {
+		case err := <-exited:
+			t.Fatalf("cdf exited before drawing the finder: %v\nterminal: %q", err, terminal.String())
+		case <-deadline:
+			cmd.Process.Kill()
+			t.Fatalf("The finder never drew the directory; terminal: %q", terminal.String())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, err := master.Write([]byte("\r")); err != nil {
+		t.Fatalf("Failed to press Enter: %v", err)
+	}
+
+	select {
+	case err := <-exited:
+		if err != nil {
+			t.Fatalf("cdf failed: %v\nterminal: %q", err, terminal.String())
+		}
+	case <-deadline:
+		cmd.Process.Kill()
+		t.Fatal("cdf kept running after Enter")
+	}
+	if got := stdout.String(); got != target+"\n" {
+		t.Errorf("Expected stdout to hold only the path, got %q", got)
+	}
+	if !strings.Contains(terminal.String(), "\x1b[") {
+		t.Errorf("Expected the finder's escape sequences on the terminal, got %q", terminal.String())
+	}
+}
\ No newline at end of file
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestOutputPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		selected string
+		relative bool
+		expected string
+	}{
+		{"Absolute", "/home/me/work/api", false, "/home/me/work/api"},
+		{"Inside", "/home/me/work/api/src", true, "api/src"},
+		{"Equal", "/home/me/work", true, "."},
+		{"Outside", "/home/me/notes", true, "../notes"},
+		{"Unrelated", "/srv/data", true, "../../../srv/data"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := outputPath(tc.selected, "/home/me/work", tc.relative)
+			if got != tc.expected {
+				t.Errorf("outputPath(%s) = %s, expected %s", tc.selected, got, tc.expected)
+			}
+		})
+	}
+
+	if got := outputPath("/srv/data", "", true); got != "/srv/data" {
+		t.Errorf("Without a cwd the path should stay absolute, got %s", got)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// paletteOption is one runtime setting offered by the Ctrl+P palette
+type paletteOption struct {
+	Name string
+	// Value describes the current setting; the caller must hold a lock
+	Value func(s *uiState) string
+	// Apply changes the setting, re-ranking or rescanning as needed, and
+	// returns a status message; the caller must hold the write lock
+	Apply func(s *uiState) (string, error)
+}
+
+// palette is the open palette: its options and the highlighted one
+type palette struct {
+	options  []paletteOption
+	selected int
+}
+
+// onOff formats a toggle's state
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// paletteOptions lists the settings the palette offers for config; options
+// whose feature was not set up at startup are left out
+func paletteOptions(config TUIConfig) []paletteOption {
+	options := []paletteOption{
+		{
+			Name:  "Sort order",
+			Value: func(s *uiState) string { return s.config.SortMode },
+			Apply: func(s *uiState) (string, error) {
+				// Cycle through the modes, treating unset as the first
+				next := sortModes[0]
+				for i, mode := range sortModes {
+					if mode == s.config.SortMode {
+						next = sortModes[(i+1)%len(sortModes)]
+					}
+				}
+				s.config.SortMode = next
+				s.rematch()
+				return "Sorting by " + next, nil
+			},
+		},
+		{
+			Name:  "Group by top-level directory",
+			Value: func(s *uiState) string { return onOff(s.config.Group) },
+			Apply: func(s *uiState) (string, error) {
+				s.config.Group = !s.config.Group
+				s.rematch()
+				return "Grouping " + onOff(s.config.Group), nil
+			},
+		},
+		{
+			Name:  "Compact layout",
+			Value: func(s *uiState) string { return onOff(s.config.Compact) },
+			Apply: func(s *uiState) (string, error) {
+				s.config.Compact = !s.config.Compact
+				return "Compact layout " + onOff(s.config.Compact), nil
+			},
+		},
+		{
+			Name:  "Borders",
+			Value: func(s *uiState) string { return onOff(s.config.Borders) },
+			Apply: func(s *uiState) (string, error) {
+				s.config.Borders = !s.config.Borders
+				return "Borders " + onOff(s.config.Borders), nil
+			},
+		},
+		{
+			Name:  "Prompt at the bottom",
+			Value: func(s *uiState) string { return onOff(s.config.Reverse) },
+			Apply: func(s *uiState) (string, error) {
+				s.config.Reverse = !s.config.Reverse
+				return "Prompt at the bottom " + onOff(s.config.Reverse), nil
+			},
+		},
+	}
+	
+	if cmd := config.PreviewCmd; cmd != "" {
+		options = append(options, paletteOption{
+			Name:  "Preview",
+			Value: func(s *uiState) string { return onOff(s.config.PreviewCmd != "") },
+			Apply: func(s *uiState) (string, error) {
+				if s.config.PreviewCmd == "" {
+					s.config.PreviewCmd = cmd
+				} else {
+					s.config.PreviewCmd = ""
+				}
+				return "Preview " + onOff(s.config.PreviewCmd != ""), nil
+			},
+		})
+	}
+	
+	if config.Reload != nil {
+		options = append(options, paletteOption{
+			Name:  "Ignore rules",
+			Value: func(s *uiState) string { return onOff(!s.config.NoIgnore) },
+			Apply: func(s *uiState) (string, error) {
+				s.config.NoIgnore = !s.config.NoIgnore
+				if _, err := s.reload(); err != nil {
+					s.config.NoIgnore = !s.config.NoIgnore
+					return "", err
+				}
+				return fmt.Sprintf("Ignore rules %s, rescanning", onOff(!s.config.NoIgnore)), nil
+			},
+		})
+	}
+	return options
+}
+
+// handlePaletteKey handles a key while the palette is open: arrows move,
+// Enter or Space applies the highlighted option and Escape or Ctrl+P closes
+// it. Like handleKeyEventState it returns -1 to cancel; the caller must hold
+// the write lock.
+func (s *uiState) handlePaletteKey(event *tcell.EventKey, height int, screen tcell.Screen) int {
+	p := s.palette
+	switch event.Key() {
+	case tcell.KeyCtrlQ:
+		return -1
+	case tcell.KeyEscape, tcell.KeyCtrlP:
+		s.palette = nil
+	case tcell.KeyUp:
+		if p.selected > 0 {
+			p.selected--
+		}
+	case tcell.KeyDown:
+		if p.selected < len(p.options)-1 {
+			p.selected++
+		}
+	case tcell.KeyEnter, tcell.KeyRune:
+		if event.Key() == tcell.KeyRune && event.Rune() != ' ' {
+			break
+		}
+		msg, err := p.applySelected(s)
+		if err != nil {
+			s.setStatus(fmt.Sprintf("  ✗ %s failed: %v", p.options[p.selected].Name, err), screen)
+		} else if msg != "" {
+			s.setStatus("  ⚙ "+msg, screen)
+		}
+		// The layout may have changed under the selection
+		s.fitToHeight(height)
+	}
+	return 0
+}
+
+// lines renders the palette as "name: value" entries; the caller must hold
+// a lock
+func (p *palette) lines(s *uiState) []string {
+	lines := make([]string, len(p.options))
+	for i, option := range p.options {
+		lines[i] = fmt.Sprintf("%s: %s", option.Name, option.Value(s))
+	}
+	return lines
+}
+
+// applySelected applies the highlighted option; the caller must hold the
+// write lock
+func (p *palette) applySelected(s *uiState) (string, error) {
+	if p.selected < 0 || p.selected >= len(p.options) {
+		return "", nil
+	}
+	return p.options[p.selected].Apply(s)
+}
\ No newline at end of file
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// paletteIndex finds the palette option called name
+func paletteIndex(t *testing.T, p *palette, name string) int {
+	t.Helper()
+	for i, option := range p.options {
+		if option.Name == name {
+			return i
+		}
+	}
+	t.Fatalf("Palette has no %q option", name)
+	return -1
+}
+
+func TestPaletteOptionsOffered(t *testing.T) {
+	names := func(config TUIConfig) string {
+		var list []string
+		for _, option := range paletteOptions(config) {
+			list = append(list, option.Name)
+		}
+		return strings.Join(list, "|")
+	}
+
+	plain := names(TUIConfig{})
+	if strings.Contains(plain, "Preview") || strings.Contains(plain, "Ignore rules") {
+		t.Errorf("Options for features not set up were offered: %s", plain)
+	}
+	full := names(TUIConfig{PreviewCmd: "ls {}", Reload: func(context.Context, bool) (<-chan DirBatch, int, error) {
+		return nil, 0, nil
+	}})
+	if !strings.Contains(full, "Preview") || !strings.Contains(full, "Ignore rules") {
+		t.Errorf("Expected preview and ignore options, got %s", full)
+	}
+}
+
+func TestPaletteToggles(t *testing.T) {
+	state := &uiState{config: TUIConfig{SortMode: sortScore, PreviewCmd: "ls {}"}}
+	state.addDirectories([]string{"/a/longer-name", "/b/x", "/a/mid"})
+	state.rematch()
+	p := &palette{options: paletteOptions(state.config)}
+
+	// Sort order cycles through every mode and back
+	p.selected = paletteIndex(t, p, "Sort order")
+	for _, expected := range append(sortModes[1:], sortModes[0]) {
+		if _, err := p.applySelected(state); err != nil {
+			t.Fatalf("Applying sort order failed: %v", err)
+		}
+		if state.config.SortMode != expected {
+			t.Errorf("SortMode = %s, expected %s", state.config.SortMode, expected)
+		}
+	}
+
+	// Grouping re-ranks right away
+	p.selected = paletteIndex(t, p, "Group by top-level directory")
+	p.applySelected(state)
+	if !state.config.Group || state.matches[0].Str != "/a/longer-name" || state.matches[1].Str != "/a/mid" {
+		t.Errorf("Expected the /a matches grouped together, got %v", state.matches)
+	}
+
+	// Layout toggles flip their flag and report it in the palette
+	p.selected = paletteIndex(t, p, "Borders")
+	if msg, _ := p.applySelected(state); !state.config.Borders || msg != "Borders on" {
+		t.Errorf("Borders not enabled, message %q", msg)
+	}
+	if line := p.lines(state)[p.selected]; line != "Borders: on" {
+		t.Errorf("Palette line = %q, expected \"Borders: on\"", line)
+	}
+
+	// Preview switches off and back on to the original command
+	p.selected = paletteIndex(t, p, "Preview")
+	p.applySelected(state)
+	if state.config.PreviewCmd != "" {
+		t.Error("Preview still enabled")
+	}
+	p.applySelected(state)
+	if state.config.PreviewCmd != "ls {}" {
+		t.Errorf("Preview command restored as %q", state.config.PreviewCmd)
+	}
+}
+
+func TestPaletteIgnoreRulesRescan(t *testing.T) {
+	var calls []bool
+	reload := func(ctx context.Context, useIgnore bool) (<-chan DirBatch, int, error) {
+		calls = append(calls, useIgnore)
+		ch := make(chan DirBatch)
+		close(ch)
+		return ch, 0, nil
+	}
+	state := &uiState{scanCtx: context.Background(), config: TUIConfig{Reload: reload}}
+	state.addDirectories([]string{"/old/scan"})
+	p := &palette{options: paletteOptions(state.config)}
+	p.selected = paletteIndex(t, p, "Ignore rules")
+
+	if msg, err := p.applySelected(state); err != nil || !strings.Contains(msg, "rescanning") {
+		t.Fatalf("Unexpected result %q, %v", msg, err)
+	}
+	if !state.config.NoIgnore || len(calls) != 1 || calls[0] {
+		t.Errorf("Expected a rescan without ignore rules, got NoIgnore %v and calls %v", state.config.NoIgnore, calls)
+	}
+	if len(state.directories) != 0 {
+		t.Errorf("The old directory list should be replaced, got %v", state.directories)
+	}
+
+	p.applySelected(state)
+	if state.config.NoIgnore || len(calls) != 2 || !calls[1] {
+		t.Errorf("Expected a rescan with ignore rules again, got calls %v", calls)
+	}
+}
+
+func TestPaletteKeys(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{config: TUIConfig{}}
+	state.addDirectories([]string{"/srv/app"})
+	state.rematch()
+	key := func(k tcell.Key, r rune) int {
+		return handleKeyEventState(tcell.NewEventKey(k, r, tcell.ModNone), state, screen)
+	}
+
+	key(tcell.KeyCtrlP, 0)
+	if state.palette == nil {
+		t.Fatal("Ctrl+P did not open the palette")
+	}
+	// Typing does not reach the query while the palette is open
+	key(tcell.KeyRune, 'x')
+	if state.query != "" {
+		t.Errorf("Query changed to %q behind the palette", state.query)
+	}
+	key(tcell.KeyDown, 0)
+	key(tcell.KeyRune, ' ')
+	if !state.config.Group {
+		t.Error("Space did not apply the highlighted option")
+	}
+	if !strings.Contains(state.statusMsg, "Grouping on") {
+		t.Errorf("Expected a confirmation, got %q", state.statusMsg)
+	}
+
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, computeLayout(24, state.config).ResultsY+2); !strings.Contains(row, "▶  Group by top-level directory: on") {
+		t.Errorf("Expected the highlighted option drawn, got %q", row)
+	}
+
+	key(tcell.KeyEscape, 0)
+	if state.palette != nil {
+		t.Error("Escape did not close the palette")
+	}
+	if result := key(tcell.KeyCtrlQ, 0); result != -1 {
+		t.Errorf("Ctrl+Q after closing returned %d", result)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// expandPath expands $VAR and ${VAR} references, then a leading ~ or ~user,
+// and makes path absolute. Undefined variables and unknown users are errors
+// rather than silently expanding to an unrelated path.
+func expandPath(path string) (string, error) {
+	var undefined []string
+	path = os.Expand(path, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, "$"+name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(undefined, ", "))
+	}
+	
+	if strings.HasPrefix(path, "~") {
+		name, rest := path[1:], ""
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name, rest = name[:i], name[i:]
+		}
+		
+		var home string
+		if name == "" {
+			home = homeDir()
+			if home == "" {
+				return "", fmt.Errorf("cannot expand ~: home directory unknown")
+			}
+		} else {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", fmt.Errorf("cannot expand ~%s: no such user", name)
+			}
+			home = u.HomeDir
+		}
+		path = home + rest
+	}
+	return filepath.Abs(path)
+}
+
+// typedDirectory resolves a query typed as a path to an existing directory
+func typedDirectory(query string) (string, bool) {
+	if strings.TrimSpace(query) == "" {
+		return "", false
+	}
+	path, err := expandPath(query)
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// pathTransform rewrites the selected directory before it is handed to the
+// shell, see --transform
+type pathTransform func(path string) (string, error)
+
+// parseTransforms turns --transform specs into transforms, applied in the
+// given order:
+//
+//	resolve-symlinks    replace the path by its real location
+//	clean               tidy . and .. elements and repeated separators
+//	strip-prefix=<dir>  drop dir from the front of paths inside it
+//	add-prefix=<dir>    put dir in front of every path
+func parseTransforms(specs []string) ([]pathTransform, error) {
+	transforms := make([]pathTransform, 0, len(specs))
+	for _, spec := range specs {
+		name, arg, hasArg := strings.Cut(spec, "=")
+		switch {
+		case name == "resolve-symlinks" && !hasArg:
+			transforms = append(transforms, filepath.EvalSymlinks)
+		case name == "clean" && !hasArg:
+			transforms = append(transforms, func(path string) (string, error) {
+				return filepath.Clean(path), nil
+			})
+		case name == "strip-prefix" && arg != "":
+			prefix := filepath.Clean(arg)
+			transforms = append(transforms, func(path string) (string, error) {
+				if !isWithinPath(path, prefix) {
+					return path, nil
+				}
+				return filepath.Join(string(filepath.Separator), strings.TrimPrefix(path, prefix)), nil
+			})
+		case name == "add-prefix" && arg != "":
+			transforms = append(transforms, func(path string) (string, error) {
+				return filepath.Join(arg, path), nil
+			})
+		default:
+			return nil, fmt.Errorf("unknown transform %q (want resolve-symlinks, clean, strip-prefix=<dir> or add-prefix=<dir>)", spec)
+		}
+	}
+	return transforms, nil
+}
+
+// applyTransforms runs path through transforms in order; none leaves it as is
+func applyTransforms(path string, transforms []pathTransform) (string, error) {
+	for _, transform := range transforms {
+		var err error
+		if path, err = transform(path); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
\ No newline at end of file
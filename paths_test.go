@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"~", home},
+		{"~/projects/api", filepath.Join(home, "projects", "api")},
+		{"/abs/path", "/abs/path"},
+		{"relative", filepath.Join(cwd, "relative")},
+		{"not~tilde", filepath.Join(cwd, "not~tilde")},
+	}
+
+	for _, tc := range testCases {
+		got, err := expandPath(tc.input)
+		if err != nil {
+			t.Errorf("expandPath(%q) failed: %v", tc.input, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("expandPath(%q) = %q, expected %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+func TestTypedDirectory(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if err := os.MkdirAll(filepath.Join(home, "new-checkout"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "notes.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if path, ok := typedDirectory("~/new-checkout"); !ok || path != filepath.Join(home, "new-checkout") {
+		t.Errorf("Expected ~/new-checkout to resolve, got %q, %v", path, ok)
+	}
+	for _, query := range []string{"", "  ", "~/missing", "~/notes.txt"} {
+		if path, ok := typedDirectory(query); ok {
+			t.Errorf("typedDirectory(%q) = %q, expected no directory", query, path)
+		}
+	}
+}
+func TestExpandPathVariablesAndUsers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CDF_TEST_WORK", "/srv/work")
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"$CDF_TEST_WORK", "/srv/work"},
+		{"${CDF_TEST_WORK}/api", "/srv/work/api"},
+		{"$HOME/sub", filepath.Join(home, "sub")},
+	}
+	for _, tc := range testCases {
+		got, err := expandPath(tc.input)
+		if err != nil || got != tc.expected {
+			t.Errorf("expandPath(%q) = %q, %v; expected %q", tc.input, got, err, tc.expected)
+		}
+	}
+
+	if current, err := user.Current(); err == nil && current.HomeDir != "" {
+		got, err := expandPath("~" + current.Username + "/sub")
+		if err != nil || got != filepath.Join(current.HomeDir, "sub") {
+			t.Errorf("expandPath(~%s/sub) = %q, %v; expected under %s", current.Username, got, err, current.HomeDir)
+		}
+	}
+
+	for _, input := range []string{"$CDF_TEST_UNDEFINED/x", "${CDF_TEST_UNDEFINED}", "~cdf-no-such-user-xyz/x"} {
+		if got, err := expandPath(input); err == nil {
+			t.Errorf("expandPath(%q) = %q, expected an error", input, got)
+		}
+	}
+}
+
+func TestPathTransforms(t *testing.T) {
+	root := t.TempDir()
+	real := filepath.Join(root, "real")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatalf("EvalSymlinks failed: %v", err)
+	}
+
+	testCases := []struct {
+		specs    []string
+		path     string
+		expected string
+	}{
+		{nil, "/work/a/../b", "/work/a/../b"},
+		{[]string{"clean"}, "/work//a/../b/.", "/work/b"},
+		{[]string{"resolve-symlinks"}, link, filepath.Join(resolvedRoot, "real")},
+		{[]string{"strip-prefix=/container"}, "/container/home/me", "/home/me"},
+		{[]string{"strip-prefix=/container"}, "/container", "/"},
+		{[]string{"strip-prefix=/container"}, "/containers/x", "/containers/x"},
+		{[]string{"add-prefix=/host"}, "/home/me", "/host/home/me"},
+		// Order matters: strip then add swaps one mount point for another
+		{[]string{"strip-prefix=/container", "add-prefix=/mnt/c"}, "/container/srv", "/mnt/c/srv"},
+		{[]string{"add-prefix=/mnt/c", "strip-prefix=/container"}, "/container/srv", "/mnt/c/container/srv"},
+		{[]string{"resolve-symlinks", "strip-prefix=" + resolvedRoot}, link, "/real"},
+	}
+	for _, tc := range testCases {
+		transforms, err := parseTransforms(tc.specs)
+		if err != nil {
+			t.Fatalf("parseTransforms(%q) failed: %v", tc.specs, err)
+		}
+		got, err := applyTransforms(tc.path, transforms)
+		if err != nil {
+			t.Errorf("%q on %s failed: %v", tc.specs, tc.path, err)
+		} else if got != tc.expected {
+			t.Errorf("%q on %s = %s, expected %s", tc.specs, tc.path, got, tc.expected)
+		}
+	}
+
+	// A dangling link can't be resolved
+	transforms, _ := parseTransforms([]string{"resolve-symlinks"})
+	if _, err := applyTransforms(filepath.Join(root, "missing"), transforms); err == nil {
+		t.Error("Expected resolving a missing path to fail")
+	}
+
+	for _, bad := range []string{"upcase", "strip-prefix", "strip-prefix=", "clean=1"} {
+		if _, err := parseTransforms([]string{bad}); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits for --preview-cmd
+const (
+	previewDebounce = 100 * time.Millisecond // Default time the selection must settle before a run
+	previewTimeout  = 2 * time.Second        // A run is killed after this long
+	previewMaxBytes = 64 * 1024              // Output beyond this is discarded
+	previewWaitGone = 100 * time.Millisecond // After a kill, how long children may keep the output open
+)
+
+// previewCommandLine substitutes the shell-quoted path for every {} in the
+// template
+func previewCommandLine(template, path string) string {
+	return strings.ReplaceAll(template, "{}", shellQuote(path))
+}
+
+// shellQuote wraps s in single quotes for sh, escaping any it contains
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// cappedBuffer keeps the first max bytes written to it and silently drops
+// the rest, so a chatty command cannot grow memory without bound. With
+// maxLines set it also stops after that many lines, calling full once the
+// first byte past them arrives so the writer can be stopped.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+	maxLines  int
+	lines     int
+	full      func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.maxLines > 0 {
+		for i, c := range p {
+			if b.lines == b.maxLines {
+				// Output goes on past the last wanted line
+				p = p[:i]
+				if !b.truncated {
+					b.truncated = true
+					if b.full != nil {
+						b.full()
+					}
+				}
+				break
+			}
+			if c == '\n' {
+				b.lines++
+			}
+		}
+	}
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return n, nil
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// runPreviewCommand runs cmdline with sh, writing its stdout to out
+func runPreviewCommand(ctx context.Context, cmdline string, out *cappedBuffer) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", cmdline)
+	cmd.Stdout = out
+	// Killing sh leaves its children writing; closing the pipe stops them
+	cmd.WaitDelay = previewWaitGone
+	return cmd.Run()
+}
+
+// previewer runs the --preview-cmd template for the selected directory. Runs
+// wait for the selection to stay put for debounce, a newer selection cancels
+// the one pending or in flight, and output is capped at previewMaxBytes and,
+// when lines is set, that many lines.
+type previewer struct {
+	mu       sync.Mutex
+	template string
+	lines    int           // Lines read per run before the command is stopped; 0 for no limit
+	debounce time.Duration // How long a selection must last before its run starts
+	run      func(ctx context.Context, cmdline string, out *cappedBuffer) error
+	notify   func() // Called when new output is ready to draw
+	path     string // Directory the current or pending run is for
+	output   string // Output for path, empty until its run finishes
+	gen      int    // Bumped on every request to discard stale runs
+	timer    *time.Timer
+	cancel   context.CancelFunc
+}
+
+// newPreviewer returns a previewer for template, showing at most lines
+// lines (0 for no limit) once the selection has settled for debounce, that
+// calls notify whenever the output changes
+func newPreviewer(template string, lines int, debounce time.Duration, notify func()) *previewer {
+	return &previewer{template: template, lines: lines, debounce: debounce, run: runPreviewCommand, notify: notify}
+}
+
+// request asks for a preview of path, abandoning any earlier request. It is
+// a no-op when path is already being previewed.
+func (p *previewer) request(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if path == p.path {
+		return
+	}
+	p.stopLocked()
+	p.gen++
+	p.path = path
+	p.output = ""
+	if path == "" {
+		return
+	}
+	gen := p.gen
+	p.timer = time.AfterFunc(p.debounce, func() { p.start(gen, path) })
+}
+
+// start launches the run for request gen unless a newer request replaced it
+func (p *previewer) start(gen int, path string) {
+	p.mu.Lock()
+	if gen != p.gen {
+		p.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	p.cancel = cancel
+	p.mu.Unlock()
+	
+	// Enough lines end the run early instead of reading the rest
+	out := &cappedBuffer{max: previewMaxBytes, maxLines: p.lines, full: cancel}
+	err := p.run(ctx, previewCommandLine(p.template, path), out)
+	cancel()
+	
+	text := out.buf.String()
+	if out.truncated {
+		text = strings.TrimSuffix(text, "\n") + "\n… (more)"
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		text += "\n(preview timed out)"
+	} else if err != nil && text == "" {
+		text = err.Error()
+	}
+	
+	p.mu.Lock()
+	if gen != p.gen {
+		// Cancelled by a newer selection; its output would be misleading
+		p.mu.Unlock()
+		return
+	}
+	p.output = text
+	p.cancel = nil
+	p.mu.Unlock()
+	if p.notify != nil {
+		p.notify()
+	}
+}
+
+// text returns the output for the current selection
+func (p *previewer) text() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output
+}
+
+// stop cancels any pending or running command
+func (p *previewer) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopLocked()
+	p.gen++
+}
+
+func (p *previewer) stopLocked() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+}
\ No newline at end of file
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreviewCommandLine(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		expected string
+	}{
+		{"ls -la {}", "/home/user/src", "ls -la '/home/user/src'"},
+		{"git -C {} log", "/work/my repo", "git -C '/work/my repo' log"},
+		{"echo {} {}", "/a", "echo '/a' '/a'"},
+		{"cat {}/README", "/it's", `cat '/it'\''s'/README`},
+		{"date", "/a", "date"},
+	}
+
+	for _, test := range tests {
+		if got := previewCommandLine(test.template, test.path); got != test.expected {
+			t.Errorf("previewCommandLine(%q, %q) = %q, expected %q", test.template, test.path, got, test.expected)
+		}
+	}
+}
+
+func TestPreviewRunsShellCommand(t *testing.T) {
+	out := &cappedBuffer{max: previewMaxBytes}
+	err := runPreviewCommand(context.Background(), previewCommandLine("printf '%s' {}", "/it's here"), out)
+	if err != nil {
+		t.Fatalf("runPreviewCommand failed: %v", err)
+	}
+	if got := out.buf.String(); got != "/it's here" {
+		t.Errorf("Expected the path to survive quoting, got %q", got)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	out := &cappedBuffer{max: 10}
+	for i := 0; i < 3; i++ {
+		if n, err := out.Write([]byte("abcdef")); n != 6 || err != nil {
+			t.Fatalf("Write should accept everything, got %d, %v", n, err)
+		}
+	}
+	if out.buf.String() != "abcdefabcd" || !out.truncated {
+		t.Errorf("Expected 10 bytes and truncated, got %q (truncated %v)", out.buf.String(), out.truncated)
+	}
+}
+
+func TestCappedBufferLines(t *testing.T) {
+	stopped := 0
+	out := &cappedBuffer{max: previewMaxBytes, maxLines: 2, full: func() { stopped++ }}
+	out.Write([]byte("one\ntw"))
+	out.Write([]byte("o\n"))
+	if out.truncated || stopped != 0 {
+		t.Fatal("Exactly maxLines lines should not count as truncated")
+	}
+	out.Write([]byte("three\nfour\n"))
+	out.Write([]byte("five\n"))
+	if out.buf.String() != "one\ntwo\n" || !out.truncated {
+		t.Errorf("Expected two lines and truncated, got %q (truncated %v)", out.buf.String(), out.truncated)
+	}
+	if stopped != 1 {
+		t.Errorf("Expected full to be called once, got %d", stopped)
+	}
+}
+
+func TestPreviewLinesStopsLargeListing(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2000; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("entry%04d", i)), nil, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	for _, template := range []string{"ls {}", "yes {}"} {
+		// yes never ends on its own: only the line cap stops it in time
+		notified := make(chan struct{}, 1)
+		p := newPreviewer(template, 10, previewDebounce, func() { notified <- struct{}{} })
+		start := time.Now()
+		p.request(dir)
+		select {
+		case <-notified:
+		case <-time.After(previewTimeout + time.Second):
+			t.Fatalf("%s: no preview", template)
+		}
+		p.stop()
+
+		if elapsed := time.Since(start); elapsed >= previewTimeout {
+			t.Errorf("%s: the command ran until the timeout instead of stopping after 10 lines", template)
+		}
+		lines := strings.Split(p.text(), "\n")
+		if len(lines) != 11 || lines[10] != "… (more)" {
+			t.Errorf("%s: expected 10 lines and the more marker, got %q", template, p.text())
+		}
+		if template == "ls {}" && lines[9] != "entry0009" {
+			t.Errorf("Expected the first entries, got %q", lines[9])
+		}
+	}
+}
+
+// fakeRuns records preview runs, blocking each until its context ends when
+// block is set
+type fakeRuns struct {
+	mu    sync.Mutex
+	lines []string
+	block bool
+}
+
+func (f *fakeRuns) run(ctx context.Context, cmdline string, out *cappedBuffer) error {
+	f.mu.Lock()
+	f.lines = append(f.lines, cmdline)
+	block := f.block
+	f.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		fmt.Fprint(out, "stale")
+		return ctx.Err()
+	}
+	fmt.Fprint(out, "output for "+cmdline)
+	return nil
+}
+
+func (f *fakeRuns) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.lines)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the previewer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPreviewerDebounces(t *testing.T) {
+	runs := &fakeRuns{}
+	notified := make(chan struct{}, 10)
+	p := newPreviewer("show {}", 0, previewDebounce, func() { notified <- struct{}{} })
+	p.run = runs.run
+	defer p.stop()
+
+	// Scrolling quickly through three entries runs only the last
+	p.request("/a")
+	p.request("/b")
+	p.request("/c")
+	select {
+	case <-notified:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a notification once the preview finished")
+	}
+
+	if runs.count() != 1 || runs.lines[0] != "show '/c'" {
+		t.Errorf("Expected a single run for /c, got %v", runs.lines)
+	}
+	if got := p.text(); got != "output for show '/c'" {
+		t.Errorf("Unexpected preview text %q", got)
+	}
+
+	// Asking again for the same path does not rerun it
+	p.request("/c")
+	time.Sleep(2 * previewDebounce)
+	if runs.count() != 1 {
+		t.Errorf("Expected no rerun for the same selection, got %v", runs.lines)
+	}
+}
+
+func TestPreviewerCancelsOnSelectionChange(t *testing.T) {
+	runs := &fakeRuns{block: true}
+	p := newPreviewer("slow {}", 0, previewDebounce, nil)
+	p.run = runs.run
+	defer p.stop()
+
+	p.request("/a")
+	waitFor(t, func() bool { return runs.count() == 1 })
+
+	// Moving on cancels the blocked run, whose output must not appear
+	runs.mu.Lock()
+	runs.block = false
+	runs.mu.Unlock()
+	p.request("/b")
+	waitFor(t, func() bool { return p.text() != "" })
+
+	if got := p.text(); got != "output for slow '/b'" {
+		t.Errorf("Expected only the newer selection's output, got %q", got)
+	}
+	if strings.Contains(p.text(), "stale") {
+		t.Error("Cancelled run leaked its output")
+	}
+}
+
+func TestPreviewerStop(t *testing.T) {
+	runs := &fakeRuns{}
+	p := newPreviewer("show {}", 0, previewDebounce, nil)
+	p.run = runs.run
+
+	p.request("/a")
+	p.stop()
+	time.Sleep(2 * previewDebounce)
+	if runs.count() != 0 {
+		t.Errorf("Expected stop to cancel the pending run, got %v", runs.lines)
+	}
+}
+
+func TestPreviewDebounceWaitsForStableSelection(t *testing.T) {
+	const debounce = 150 * time.Millisecond
+	runs := &fakeRuns{}
+	p := newPreviewer("show {}", 0, debounce, nil)
+	p.run = runs.run
+	defer p.stop()
+
+	// Each move restarts the wait, so nothing runs while scrolling continues
+	p.request("/a")
+	time.Sleep(debounce / 2)
+	p.request("/b")
+	time.Sleep(debounce / 2)
+	settled := time.Now()
+	p.request("/c")
+	time.Sleep(debounce / 2)
+	if runs.count() != 0 {
+		t.Fatalf("Expected no run before the selection was stable, got %v", runs.lines)
+	}
+
+	waitFor(t, func() bool { return p.text() != "" })
+	if elapsed := time.Since(settled); elapsed < debounce {
+		t.Errorf("Preview loaded %s after the last move, before the %s debounce", elapsed, debounce)
+	}
+	if runs.count() != 1 || runs.lines[0] != "show '/c'" {
+		t.Errorf("Expected only the settled selection to run, got %v", runs.lines)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recentRootsLimit is how many scan roots --pick-root remembers
+const recentRootsLimit = 20
+
+// recentRootsFile returns where --pick-root keeps the scan roots used,
+// ~/.cache/cdf/roots
+func recentRootsFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "roots"), nil
+}
+
+// loadRecentRoots reads the recent roots at path, most recent first. A
+// missing file holds none.
+func loadRecentRoots(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	var roots []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if root := strings.TrimSpace(scanner.Text()); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	return roots, scanner.Err()
+}
+
+// rememberRoot moves root to the front of the recent roots at path, keeping
+// at most recentRootsLimit, and replaces the file atomically
+func rememberRoot(path, root string) error {
+	roots, err := loadRecentRoots(path)
+	if err != nil {
+		return err
+	}
+	kept := []string{root}
+	for _, r := range roots {
+		if r != root && len(kept) < recentRootsLimit {
+			kept = append(kept, r)
+		}
+	}
+	
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".roots-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	
+	w := bufio.NewWriter(tmp)
+	for _, r := range kept {
+		fmt.Fprintln(w, r)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// finderFunc runs the finder over a directory channel, as runTUIWithConfigCtx
+// does
+type finderFunc func(ctx context.Context, dirChan <-chan DirBatch, config TUIConfig) (string, error)
+
+// pickRoot runs the first stage of --pick-root: the recent roots at path
+// that are still directories, most recent first and followed by cwd, are
+// offered in the finder, and the one chosen becomes the scan root. With
+// nothing recent to offer, cwd is used without asking.
+func pickRoot(ctx context.Context, path, cwd string, find finderFunc) (string, error) {
+	recent, err := loadRecentRoots(path)
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, root := range append(recent, cwd) {
+		if info, err := os.Stat(root); err == nil && info.IsDir() && !containsString(candidates, root) {
+			candidates = append(candidates, root)
+		}
+	}
+	if len(candidates) <= 1 {
+		return cwd, nil
+	}
+	
+	ch := make(chan DirBatch, 1)
+	ch <- DirBatch{Directories: candidates, Done: true}
+	close(ch)
+	return find(ctx, ch, TUIConfig{PromptLabel: "root", BrowseOrder: browseWalk})
+}
\ No newline at end of file
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRememberRoot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "roots")
+	if roots, err := loadRecentRoots(path); err != nil || roots != nil {
+		t.Errorf("Expected a missing file to hold no roots, got %v, %v", roots, err)
+	}
+
+	for _, root := range []string{"/srv/api", "/srv/web", "/home/me/notes", "/srv/api"} {
+		if err := rememberRoot(path, root); err != nil {
+			t.Fatalf("rememberRoot(%s) failed: %v", root, err)
+		}
+	}
+	roots, err := loadRecentRoots(path)
+	if err != nil {
+		t.Fatalf("loadRecentRoots failed: %v", err)
+	}
+	if got := strings.Join(roots, " "); got != "/srv/api /home/me/notes /srv/web" {
+		t.Errorf("Expected the most recent first without duplicates, got %q", got)
+	}
+
+	// Only the most recent ones are kept
+	for i := 0; i < recentRootsLimit+5; i++ {
+		if err := rememberRoot(path, fmt.Sprintf("/srv/p%d", i)); err != nil {
+			t.Fatalf("rememberRoot failed: %v", err)
+		}
+	}
+	roots, _ = loadRecentRoots(path)
+	if len(roots) != recentRootsLimit || roots[0] != fmt.Sprintf("/srv/p%d", recentRootsLimit+4) {
+		t.Errorf("Expected the %d most recent roots, got %v", recentRootsLimit, roots)
+	}
+}
+
+func TestPickRootThenScan(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"api/cmd", "web/src", "here"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	api, web, here := filepath.Join(base, "api"), filepath.Join(base, "web"), filepath.Join(base, "here")
+	path := filepath.Join(base, "roots")
+	for _, root := range []string{api, filepath.Join(base, "gone"), web} {
+		if err := rememberRoot(path, root); err != nil {
+			t.Fatalf("rememberRoot failed: %v", err)
+		}
+	}
+
+	// The picker is offered the roots that still exist, then the current
+	// directory, and what it returns is the root the scan starts from
+	var offered []string
+	var prompt string
+	find := func(ctx context.Context, dirChan <-chan DirBatch, config TUIConfig) (string, error) {
+		prompt = config.PromptLabel
+		for batch := range dirChan {
+			offered = append(offered, batch.Directories...)
+		}
+		return offered[1], nil
+	}
+	root, err := pickRoot(context.Background(), path, here, find)
+	if err != nil {
+		t.Fatalf("pickRoot failed: %v", err)
+	}
+	if got := strings.Join(offered, " "); got != strings.Join([]string{web, api, here}, " ") || prompt != "root" {
+		t.Errorf("Expected the picker over %v, got %v (prompt %q)", []string{web, api, here}, offered, prompt)
+	}
+	if root != api {
+		t.Fatalf("Expected the picked %s as the scan root, got %s", api, root)
+	}
+
+	var found []string
+	for batch := range scanWithConfig(ScanConfig{Root: root, MaxDepth: 5, InitialBatchSize: 10, MaxBatchSize: 10}) {
+		found = append(found, batch.Directories...)
+	}
+	if len(found) != 1 || found[0] != filepath.Join(api, "cmd") {
+		t.Errorf("Expected the scan to run below the picked root, found %v", found)
+	}
+
+	// Cancelling the picker cancels the run; with nothing recent there is
+	// nothing to pick and the current directory is used
+	cancel := func(context.Context, <-chan DirBatch, TUIConfig) (string, error) { return "", ErrCancelled }
+	if _, err := pickRoot(context.Background(), path, here, cancel); !errors.Is(err, ErrCancelled) {
+		t.Errorf("Expected ErrCancelled from a cancelled picker, got %v", err)
+	}
+	if root, err := pickRoot(context.Background(), filepath.Join(base, "none"), here, cancel); err != nil || root != here {
+		t.Errorf("Expected %s without recent roots, got %q, %v", here, root, err)
+	}
+}
\ No newline at end of file
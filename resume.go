@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resumeTTL is how long a saved session can be resumed
+const resumeTTL = 10 * time.Minute
+
+// resumeHeader identifies the session file format; version 2 added
+// modification times
+const resumeHeader = "cdf-resume 2"
+
+// session is what --resume keeps between runs: the directories a finished
+// scan found from Root, and the query that was typed
+type session struct {
+	Root        string
+	Saved       time.Time
+	Query       string
+	Directories []string
+	// ModTimes holds when Root and each directory were last modified as of
+	// the scan. A directory modified since may have gained or lost
+	// subdirectories; one without a time is trusted as it is.
+	ModTimes map[string]time.Time
+	// Stale lists, once loaded, the outermost directories (Root included)
+	// modified since they were saved, whose subtrees need rescanning
+	Stale []string
+}
+
+// resumeFile returns where the session is kept
+func resumeFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cdf", "resume"), nil
+}
+
+// saveSession writes s to path, replacing any earlier session atomically
+func saveSession(path string, s session) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".resume-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintln(w, resumeHeader)
+	fmt.Fprintf(w, "root\t%s\n", s.Root)
+	fmt.Fprintf(w, "saved\t%d\n", s.Saved.Unix())
+	fmt.Fprintf(w, "query\t%s\n", s.Query)
+	fmt.Fprintf(w, "rootmtime\t%d\n", unixNano(s.ModTimes[s.Root]))
+	fmt.Fprintln(w)
+	for _, dir := range s.Directories {
+		// The time leads so the path can hold any character but a newline
+		fmt.Fprintf(w, "%d\t%s\n", unixNano(s.ModTimes[dir]), dir)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// unixNano is t in nanoseconds since the epoch, or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// loadSession reads the session at path if it was saved for root less than
+// ttl before now. Directories that no longer exist are dropped, and those
+// modified since are listed in Stale with their current times.
+func loadSession(path, root string, ttl time.Duration, now time.Time) (session, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return session{}, false
+	}
+	defer f.Close()
+	
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != resumeHeader {
+		return session{}, false
+	}
+	
+	var s session
+	var rootTime int64
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, _ := strings.Cut(line, "\t")
+		switch key {
+		case "root":
+			s.Root = value
+		case "saved":
+			unix, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return session{}, false
+			}
+			s.Saved = time.Unix(unix, 0)
+		case "query":
+			s.Query = value
+		case "rootmtime":
+			rootTime, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if s.Root != root || now.Sub(s.Saved) > ttl || now.Before(s.Saved) {
+		return session{}, false
+	}
+	
+	s.ModTimes = make(map[string]time.Time)
+	var changed []string
+	check := func(dir string, saved int64, info os.FileInfo) {
+		s.ModTimes[dir] = info.ModTime()
+		if saved != 0 && info.ModTime().UnixNano() != saved {
+			changed = append(changed, dir)
+		}
+	}
+	if info, err := os.Stat(root); err == nil {
+		check(root, rootTime, info)
+	}
+	for scanner.Scan() {
+		field, dir, ok := strings.Cut(scanner.Text(), "\t")
+		saved, err := strconv.ParseInt(field, 10, 64)
+		if !ok || err != nil {
+			return session{}, false
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			s.Directories = append(s.Directories, dir)
+			check(dir, saved, info)
+		}
+	}
+	if scanner.Err() != nil {
+		return session{}, false
+	}
+	s.Stale = outermost(changed)
+	return s, true
+}
+
+// outermost drops the directories lying inside another one of dirs
+func outermost(dirs []string) []string {
+	sorted := append([]string(nil), dirs...)
+	sort.Strings(sorted)
+	var kept []string
+	for _, dir := range sorted {
+		if len(kept) > 0 && isWithinPath(dir, kept[len(kept)-1]) {
+			continue
+		}
+		kept = append(kept, dir)
+	}
+	return kept
+}
+
+// resumeSession replays s as the result of a finished scan, then rescans
+// each of its stale directories as deep as the original scan reached below it
+// and merges in the directories not listed yet. config is the scan's
+// template and startPath where it started; stale directories outside
+// startPath belong to the global phase and are rescanned the way it scans.
+func resumeSession(ctx context.Context, s session, startPath string, config ScanConfig) <-chan DirBatch {
+	ch := make(chan DirBatch, 1)
+	
+	go func() {
+		defer close(ch)
+		
+		modTimes := make([]time.Time, len(s.Directories))
+		seen := make(map[string]bool, len(s.Directories))
+		for i, dir := range s.Directories {
+			modTimes[i] = s.ModTimes[dir]
+			seen[dir] = true
+		}
+		// The session may predate entries added to the deny file since
+		directories, modTimes := config.Deny.withoutDenied(s.Directories, modTimes)
+		select {
+		case ch <- DirBatch{Directories: directories, ModTimes: modTimes, Done: len(s.Stale) == 0}:
+		case <-ctx.Done():
+			return
+		}
+		
+		if len(s.Stale) == 0 {
+			return
+		}
+		for _, dir := range s.Stale {
+			rescan := config
+			rescan.Root, rescan.MinDepth = dir, 0
+			base, global := startPath, !isWithinPath(dir, startPath)
+			if global {
+				base = string(filepath.Separator)
+				if !config.IncludeAncestors {
+					rescan.OmitPaths = ancestorPaths(startPath)
+				}
+			}
+			// Entries n levels below the scan root were listed while n-1
+			// was within MaxDepth
+			rescan.MaxDepth -= levelsBelow(dir, base)
+			if rescan.MaxDepth < 0 {
+				continue
+			}
+			
+			excluded := ""
+			if global {
+				excluded = startPath
+			}
+			for batch := range scanWithConfigCtxExcluding(ctx, rescan, excluded) {
+				batch = dropSeen(batch, seen)
+				batch.Global = global
+				batch.Done = batch.Err != nil // Finished below, after every rescan
+				select {
+				case ch <- batch:
+				case <-ctx.Done():
+					return
+				}
+				if batch.Err != nil {
+					return
+				}
+			}
+		}
+		select {
+		case ch <- DirBatch{Done: true}:
+		case <-ctx.Done():
+		}
+	}()
+	
+	return ch
+}
+
+// levelsBelow counts the path components of dir beneath base, which must
+// contain it
+func levelsBelow(dir, base string) int {
+	rel := relativeTo(base, dir)
+	if rel == "" {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
\ No newline at end of file
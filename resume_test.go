@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "cache", "resume")
+
+	kept := filepath.Join(tempDir, "kept")
+	deleted := filepath.Join(tempDir, "deleted")
+	for _, dir := range []string{kept, deleted} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	saved := time.Now().Truncate(time.Second)
+	err := saveSession(path, session{
+		Root:        tempDir,
+		Saved:       saved,
+		Query:       "kep",
+		Directories: []string{kept, deleted},
+	})
+	if err != nil {
+		t.Fatalf("saveSession failed: %v", err)
+	}
+	if err := os.Remove(deleted); err != nil {
+		t.Fatalf("Failed to remove test dir: %v", err)
+	}
+
+	s, ok := loadSession(path, tempDir, resumeTTL, saved.Add(time.Minute))
+	if !ok {
+		t.Fatal("Expected the session to be restored")
+	}
+	if s.Query != "kep" || !s.Saved.Equal(saved) {
+		t.Errorf("Restored query %q saved %v, expected kep at %v", s.Query, s.Saved, saved)
+	}
+	if len(s.Directories) != 1 || s.Directories[0] != kept {
+		t.Errorf("Expected only the surviving directory, got %v", s.Directories)
+	}
+
+	if _, ok := loadSession(path, tempDir, resumeTTL, saved.Add(resumeTTL+time.Second)); ok {
+		t.Error("A session past its TTL should not be restored")
+	}
+	if _, ok := loadSession(path, "/elsewhere", resumeTTL, saved); ok {
+		t.Error("A session from another root should not be restored")
+	}
+	if _, ok := loadSession(filepath.Join(tempDir, "missing"), tempDir, resumeTTL, saved); ok {
+		t.Error("Expected no session without a file")
+	}
+}
+
+func TestResumeSaveOnExit(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+
+	dirChan := make(chan DirBatch, 1)
+	dirChan <- DirBatch{Directories: []string{"/srv/api", "/srv/web"}, Done: true}
+	close(dirChan)
+
+	var savedDirs []string
+	var savedQuery string
+	config := TUIConfig{
+		InitialQuery: "ap",
+		OnExit: func(directories []string, query string, modTimes map[string]time.Time) {
+			savedDirs = append([]string(nil), directories...)
+			savedQuery = query
+		},
+	}
+
+	// Wait for the scan to land before quitting so the list is complete
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		screen.PostEvent(tcell.NewEventKey(tcell.KeyRune, 'i', tcell.ModNone))
+		screen.PostEvent(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone))
+	}()
+	path, err := runTUIOnScreen(context.Background(), screen, dirChan, config)
+	if err != nil || path != "/srv/api" {
+		t.Fatalf("Expected /srv/api selected from the restored query, got %q, %v", path, err)
+	}
+
+	if savedQuery != "api" || len(savedDirs) != 2 {
+		t.Errorf("Expected the list and query saved on exit, got %v %q", savedDirs, savedQuery)
+	}
+}
+
+func TestResumeRescansOnlyChangedSubtrees(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/src", "b/old", "c/deep"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	config := ScanConfig{MaxDepth: 5, InitialBatchSize: 10, MaxBatchSize: 10, CaptureModTimes: true}
+
+	// Save the session of a full scan
+	saved := session{Root: root, Saved: time.Now(), ModTimes: make(map[string]time.Time)}
+	scan := config
+	scan.Root = root
+	for batch := range scanWithConfig(scan) {
+		for i, dir := range batch.Directories {
+			saved.Directories = append(saved.Directories, dir)
+			saved.ModTimes[dir] = batch.ModTimes[i]
+		}
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Fatalf("Failed to stat root: %v", err)
+	}
+	saved.ModTimes[root] = info.ModTime()
+	path := filepath.Join(t.TempDir(), "resume")
+	if err := saveSession(path, saved); err != nil {
+		t.Fatalf("saveSession failed: %v", err)
+	}
+
+	// a gains a directory and b loses one; c's new directory is hidden by
+	// restoring its time, so finding it would mean c was rescanned
+	later := time.Now().Add(time.Hour)
+	changes := []func() error{
+		func() error { return os.Mkdir(filepath.Join(root, "a", "new"), 0755) },
+		func() error { return os.Chtimes(filepath.Join(root, "a"), later, later) },
+		func() error { return os.Remove(filepath.Join(root, "b", "old")) },
+		func() error { return os.Chtimes(filepath.Join(root, "b"), later, later) },
+		func() error { return os.Mkdir(filepath.Join(root, "c", "unseen"), 0755) },
+		func() error {
+			old := saved.ModTimes[filepath.Join(root, "c")]
+			return os.Chtimes(filepath.Join(root, "c"), old, old)
+		},
+	}
+	for _, change := range changes {
+		if err := change(); err != nil {
+			t.Fatalf("Failed to change the tree: %v", err)
+		}
+	}
+
+	s, ok := loadSession(path, root, resumeTTL, time.Now())
+	if !ok {
+		t.Fatal("Expected the session to be restored")
+	}
+	expectedStale := []string{filepath.Join(root, "a"), filepath.Join(root, "b")}
+	if strings.Join(s.Stale, " ") != strings.Join(expectedStale, " ") {
+		t.Errorf("Stale = %v, expected %v", s.Stale, expectedStale)
+	}
+
+	var found []string
+	done := false
+	for batch := range resumeSession(context.Background(), s, root, config) {
+		if batch.Err != nil {
+			t.Fatalf("Rescan failed: %v", batch.Err)
+		}
+		for _, dir := range batch.Directories {
+			found = append(found, strings.TrimPrefix(dir, root))
+		}
+		done = done || batch.Done
+	}
+	if !done {
+		t.Error("Resumed scan never completed")
+	}
+	sort.Strings(found)
+	if got := strings.Join(found, " "); got != "/a /a/new /a/src /b /c /c/deep" {
+		t.Errorf("Resumed directories %q, expected a/new added, b/old dropped and c left alone", got)
+	}
+}
\ No newline at end of file
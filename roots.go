@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadRoots reads a --roots-config file: one directory per line, with ~,
+// ~user and $VAR expanded. Blank lines and lines starting with # are skipped.
+func loadRoots(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	
+	var roots []string
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		root, err := expandPath(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		roots = append(roots, root)
+	}
+	return roots, scanner.Err()
+}
+
+// usableRoots loads the roots listed at path and keeps the usable ones (see
+// resolveRoots). A file that leaves no root to scan is an errNoValidInput
+// error rather than an empty scan.
+func usableRoots(path string) (roots []string, skipped []string, err error) {
+	listed, err := loadRoots(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots, skipped = resolveRoots(listed)
+	if len(roots) > 0 {
+		return roots, skipped, nil
+	}
+	if len(skipped) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s lists no roots", errNoValidInput, path)
+	}
+	return nil, skipped, fmt.Errorf("%w: no usable roots in %s (%s)", errNoValidInput, path, strings.Join(skipped, "; "))
+}
+
+// resolveRoots keeps the roots that are existing directories not already
+// inside another kept root, and explains why each other one was skipped
+func resolveRoots(roots []string) (kept []string, skipped []string) {
+	for _, root := range roots {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			skipped = append(skipped, fmt.Sprintf("%s: not a directory", root))
+			continue
+		}
+		covered := ""
+		for _, other := range roots {
+			if other != root && strings.HasPrefix(root, other+string(filepath.Separator)) {
+				covered = other
+				break
+			}
+		}
+		if covered != "" {
+			skipped = append(skipped, fmt.Sprintf("%s: already scanned under %s", root, covered))
+			continue
+		}
+		if containsString(kept, root) {
+			continue
+		}
+		kept = append(kept, root)
+	}
+	return kept, skipped
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scanRootsWithConfigCtx scans each root in turn with config as a template,
+// merging the results into one stream that is done after the last root. The
+// roots themselves are listed too, unless config.MinDepth excludes them.
+func scanRootsWithConfigCtx(ctx context.Context, roots []string, config ScanConfig) <-chan DirBatch {
+	ch := make(chan DirBatch, 2)
+	
+	go func() {
+		defer close(ch)
+		
+		send := func(batch DirBatch) bool {
+			select {
+			case ch <- batch:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		
+		if config.MinDepth == 0 && len(roots) > 0 {
+			if !send(DirBatch{Directories: append([]string(nil), roots...), Done: false}) {
+				return
+			}
+		}
+		
+		for i, root := range roots {
+			config.Root = root
+			for batch := range scanWithConfigCtx(ctx, config) {
+				if batch.Done && i < len(roots)-1 && batch.Err == nil {
+					batch.Done = false // More roots to come
+				}
+				if !send(batch) || batch.Err != nil {
+					return
+				}
+			}
+		}
+		if len(roots) == 0 {
+			send(DirBatch{Done: true})
+		}
+	}()
+	
+	return ch
+}
\ No newline at end of file
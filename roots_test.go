@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("HOME", tempDir)
+	t.Setenv("CDF_TEST_ROOT", "/srv")
+
+	path := filepath.Join(tempDir, "roots")
+	content := "# work projects\n~/code\n\n  $CDF_TEST_ROOT/app  \n/opt/tools\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write roots config: %v", err)
+	}
+
+	roots, err := loadRoots(path)
+	if err != nil {
+		t.Fatalf("loadRoots failed: %v", err)
+	}
+	expected := []string{filepath.Join(tempDir, "code"), "/srv/app", "/opt/tools"}
+	if strings.Join(roots, " ") != strings.Join(expected, " ") {
+		t.Errorf("loadRoots = %v, expected %v", roots, expected)
+	}
+
+	bad := filepath.Join(tempDir, "bad")
+	if err := os.WriteFile(bad, []byte("/ok\n$CDF_UNDEFINED_ROOT/x\n"), 0644); err != nil {
+		t.Fatalf("Failed to write roots config: %v", err)
+	}
+	if _, err := loadRoots(bad); err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("Expected an error naming line 2, got %v", err)
+	}
+}
+
+func TestResolveRoots(t *testing.T) {
+	tempDir := t.TempDir()
+	code := filepath.Join(tempDir, "code")
+	nested := filepath.Join(code, "nested")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	missing := filepath.Join(tempDir, "missing")
+
+	kept, skipped := resolveRoots([]string{code, missing, nested, code})
+	if len(kept) != 1 || kept[0] != code {
+		t.Errorf("Expected only %s to be kept, got %v", code, kept)
+	}
+	if len(skipped) != 2 || !strings.HasPrefix(skipped[0], missing) || !strings.HasPrefix(skipped[1], nested) {
+		t.Errorf("Expected the missing and nested roots to be skipped, got %v", skipped)
+	}
+}
+
+func TestScanRootsOnlyScansConfiguredTrees(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{
+		"alpha/src/pkg",
+		"alpha/node_modules/dep",
+		"beta/docs",
+		"outside/unrelated",
+	} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	alpha, beta := filepath.Join(tempDir, "alpha"), filepath.Join(tempDir, "beta")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var found []string
+	doneCount := 0
+	for batch := range scanRootsWithConfigCtx(ctx, []string{alpha, beta}, ScanConfig{
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+	}) {
+		if batch.Err != nil {
+			t.Fatalf("Scan failed: %v", batch.Err)
+		}
+		if batch.Done {
+			doneCount++
+		}
+		found = append(found, batch.Directories...)
+	}
+
+	sort.Strings(found)
+	expected := []string{
+		alpha,
+		filepath.Join(alpha, "src"),
+		filepath.Join(alpha, "src", "pkg"),
+		beta,
+		filepath.Join(beta, "docs"),
+	}
+	sort.Strings(expected)
+	if strings.Join(found, " ") != strings.Join(expected, " ") {
+		t.Errorf("Scanned %v, expected %v", found, expected)
+	}
+	if doneCount != 1 {
+		t.Errorf("Expected a single Done batch after the last root, got %d", doneCount)
+	}
+}
+func TestUsableRootsRejectsEmptyInput(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	empty := write("empty", "")
+	commentsOnly := write("comments", "# nothing yet\n\n")
+	allInvalid := write("invalid", filepath.Join(tempDir, "missing")+"\n"+empty+"\n")
+
+	for _, path := range []string{empty, commentsOnly, allInvalid} {
+		roots, _, err := usableRoots(path)
+		if !errors.Is(err, errNoValidInput) || len(roots) != 0 {
+			t.Errorf("usableRoots(%s) = %v, %v; expected errNoValidInput", filepath.Base(path), roots, err)
+		}
+		if code := exitCode(err); code != exitNoInput {
+			t.Errorf("Exit code for %s = %d, expected %d", filepath.Base(path), code, exitNoInput)
+		}
+	}
+
+	// The reasons travel with the error so the user can fix the file
+	if _, _, err := usableRoots(allInvalid); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected the skip reasons in the error, got %v", err)
+	}
+
+	valid := write("valid", tempDir+"\n"+filepath.Join(tempDir, "missing")+"\n")
+	roots, skipped, err := usableRoots(valid)
+	if err != nil || len(roots) != 1 || len(skipped) != 1 {
+		t.Errorf("Expected one usable and one skipped root, got %v, %v, %v", roots, skipped, err)
+	}
+	if code := exitCode(errors.New("boom")); code != 1 {
+		t.Errorf("Other errors should exit 1, got %d", code)
+	}
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 var ignorePatterns = []string{
@@ -48,9 +54,129 @@ func scanDirectories(root string, maxDepth int, useIgnorePatterns bool) ([]strin
 type ScanConfig struct {
 	Root              string
 	MaxDepth          int
+	MinDepth          int // Shallower directories are walked but not reported
 	UseIgnorePatterns bool
 	InitialBatchSize  int
 	MaxBatchSize      int
+	// IgnorePatterns holds extra user patterns. Bare names match a directory
+	// at any level; patterns containing "/" match the path relative to
+	// IgnoreBase.
+	IgnorePatterns []string
+	// IgnoreBase is the directory anchored ignore patterns are relative to,
+	// Root when empty. A scan of a subtree sets it to the original root so
+	// the patterns keep meaning the same paths.
+	IgnoreBase string
+	// OmitPaths are left out of the results but still descended into
+	OmitPaths map[string]bool
+	// IncludeAncestors keeps the starting directory's parent chain in the
+	// global phase of a two-phase scan; by default it is omitted
+	IncludeAncestors bool
+	// CaptureModTimes fills DirBatch.ModTimes, at the cost of a stat per directory
+	CaptureModTimes bool
+	// BreadthFirst walks level by level so shallow directories arrive first
+	BreadthFirst bool
+	// DetectRepos fills DirBatch.Repos with directories containing a .git entry
+	DetectRepos bool
+	// OneFilesystem skips directories on a different device than Root, like
+	// find -xdev
+	OneFilesystem bool
+	// SkipEmpty leaves out directories without any entries, at the cost of
+	// an extra read per directory
+	SkipEmpty bool
+	// SymlinkTargets reports symlinks to directories, by their own path
+	// but without descending into them, and fills DirBatch.Targets with
+	// where they resolve to
+	SymlinkTargets bool
+	// MinEntries leaves out directories with fewer entries than this,
+	// generalizing SkipEmpty; only that many names are read per directory
+	MinEntries int
+	// NewerThan, when set, leaves out directories last modified at or
+	// before it; they are still descended into. Directories whose mtime
+	// can't be read are left out too unless KeepUnknownAge is set.
+	NewerThan      time.Time
+	KeepUnknownAge bool
+	// FixedBatch keeps every batch at InitialBatchSize instead of growing
+	// towards MaxBatchSize on large scans
+	FixedBatch bool
+	// LocalOnly limits a two-phase scan to its first phase, the starting
+	// directory, leaving out the global results from /
+	LocalOnly bool
+	// Progress, when set, receives a scanProgress every ProgressInterval
+	// directories examined (defaultProgressInterval if zero) and once more
+	// when the walk ends. Sends block like DirBatch sends, so the receiver
+	// must keep draining it until the final DirBatch; it is never closed.
+	Progress         chan<- scanProgress
+	ProgressInterval int
+	// Retries is how many more times a directory read that failed is tried,
+	// with a short backoff, before its subtree is given up on
+	Retries int
+	// DebugLog, when set, receives a line for every broken symlink skipped
+	DebugLog io.Writer
+	// Trace, when set, receives a timing line per phase of a two-phase scan
+	// and one for the whole scan (see tracePhase)
+	Trace io.Writer
+	// SkipHidden leaves out dot directories and their subtrees, whether or
+	// not UseIgnorePatterns is set (see ignoreRules.SkipHidden)
+	SkipHidden bool
+	// WritableOnly leaves out directories the current user can't create
+	// entries in; they are still descended into. Where writability can't be
+	// told (see readOnlyDir) nothing is left out.
+	WritableOnly bool
+	// Workers is how many directory reads may be in flight at once; the
+	// walk reads the directories it reaches next ahead of visiting them.
+	// Zero or one reads one directory at a time.
+	Workers int
+	// Deny leaves its directories out whatever the other settings, including
+	// UseIgnorePatterns; denied subtrees are not descended into
+	Deny denylist
+}
+
+// defaultProgressInterval is how many directories pass between progress
+// events when ScanConfig.ProgressInterval is unset
+const defaultProgressInterval = 500
+
+// scanProgress is a snapshot of a running scan's counters
+type scanProgress struct {
+	Scanned    int    // Directories examined so far, reported or not
+	Deepest    string // Deepest directory examined so far
+	Ignored    int    // Directories skipped by ignore rules or the excluded path
+	Mounts     int    // Directories skipped as being on another filesystem
+	Unreadable int    // Entries that could not be read
+	Broken     int    // Dangling symlinks, checked with SymlinkTargets or DebugLog
+	Done       bool   // This is the final event for the scan
+}
+
+// ignorePath returns path as the ignore patterns see it, relative to
+// IgnoreBase or, when that is unset, Root
+func (c ScanConfig) ignorePath(path string) string {
+	if c.IgnoreBase != "" {
+		return relativeTo(c.IgnoreBase, path)
+	}
+	return relativeTo(c.Root, path)
+}
+
+// deviceOf looks up the filesystem a path lives on; tests replace it
+var deviceOf = deviceID
+
+// ignoreConfig returns the ignore rules in effect for this scan
+func (c ScanConfig) ignoreConfig() ignoreRules {
+	cfg := ignoreRules{SkipHidden: c.SkipHidden}
+	if c.UseIgnorePatterns {
+		cfg.Builtin, cfg.Patterns = true, c.IgnorePatterns
+	}
+	return cfg
+}
+
+// tooOld reports whether a directory with the given stat result falls outside
+// NewerThan
+func (c ScanConfig) tooOld(info fs.FileInfo, err error) bool {
+	if c.NewerThan.IsZero() {
+		return false
+	}
+	if err != nil {
+		return !c.KeepUnknownAge
+	}
+	return !info.ModTime().After(c.NewerThan)
 }
 
 // scanDirectoriesAsync scans directories and sends results through a channel in batches
@@ -89,153 +215,199 @@ func scanWithConfig(config ScanConfig) <-chan DirBatch {
 func scanWithConfigCtxExcluding(ctx context.Context, config ScanConfig, excludePath string) <-chan DirBatch {
 	// Use smaller buffer to provide backpressure
 	ch := make(chan DirBatch, 2)
+	if excludePath != "" {
+		excludePath = filepath.Clean(excludePath)
+	}
 	
 	go func() {
 		defer close(ch)
 		
 		var batch []string
 		batch = make([]string, 0, config.InitialBatchSize)
+		var modTimes []time.Time
+		var repos []string
+		var targets map[string]string
+		ignored := 0 // Ignore-rule skips since the last batch
+		rootDevice, checkDevice := uint64(0), false
+		if config.OneFilesystem {
+			rootDevice, checkDevice = deviceOf(config.Root)
+		}
 		currentBatchSize := config.InitialBatchSize
 		dirCount := 0
+		ignoreConfig := config.ignoreConfig()
+		last := config.Root // Where a scanError says the scan stopped
 		
-		// Custom walk function that respects context cancellation and excludes a path
-		err := walkDirContext(ctx, config.Root, func(path string, d fs.DirEntry, err error) error {
-			// Check for cancellation
+		var progress scanProgress
+		deepest := 0
+		interval := config.ProgressInterval
+		if interval <= 0 {
+			interval = defaultProgressInterval
+		}
+		sendProgress := func() error {
+			if config.Progress == nil {
+				return nil
+			}
 			select {
+			case config.Progress <- progress:
+				return nil
 			case <-ctx.Done():
 				return ctx.Err()
-			default:
 			}
-			
+		}
+		
+		// Custom walk function that respects context cancellation and excludes a path
+		walk := walkDirDepth
+		if config.BreadthFirst {
+			walk = walkDirBreadth
+		}
+		
+		// Only directories the walk will descend into are read ahead
+		reader := newDirReader(config.Retries, config.Workers, func(path string, depth int) bool {
+			if depth-1 > config.MaxDepth || (excludePath != "" && isWithinPath(path, excludePath)) || config.Deny.covers(path) {
+				return false
+			}
+			if isIgnored(config.ignorePath(path), ignoreConfig) {
+				return false
+			}
+			if checkDevice {
+				if device, ok := deviceOf(path); ok && device != rootDevice {
+					return false
+				}
+			}
+			return true
+		})
+		
+		err := walk(ctx, config.Root, reader, func(path string, d fs.DirEntry, depth int, err error) error {
+			last = path
 			if err != nil {
 				// Log permission errors but continue scanning
+				progress.Unreadable++
 				return nil
 			}
 			
-			if !d.IsDir() {
+			// A .git entry (a directory, or a file for worktrees and
+			// submodules) marks its parent as a repository root; check before
+			// the ignore rules skip it
+			if config.DetectRepos && d.Name() == ".git" {
+				repos = append(repos, filepath.Dir(path))
+			}
+			
+			if d.Type()&fs.ModeSymlink != 0 {
+				// Symlinks are never descended into, so only a reported target
+				// or the debug log is worth a stat. A dangling one is only
+				// counted, so it can neither abort the scan nor show up as a
+				// directory.
+				if !config.SymlinkTargets && config.DebugLog == nil {
+					return nil
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					progress.Broken++
+					if config.DebugLog != nil {
+						fmt.Fprintf(config.DebugLog, "Skipping broken symlink: %s\n", path)
+					}
+					return nil
+				}
+				if !config.SymlinkTargets || !info.IsDir() || depth-1 > config.MaxDepth || depth-1 < config.MinDepth || config.OmitPaths[path] {
+					return nil
+				}
+				if config.Deny.denies(path) {
+					return nil
+				}
+				if isIgnored(config.ignorePath(path), ignoreConfig) || config.tooOld(info, nil) {
+					return nil
+				}
+				if config.WritableOnly && readOnlyDir(path) {
+					return nil
+				}
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return nil
+				}
+				if targets == nil {
+					targets = make(map[string]string)
+				}
+				targets[path] = target
+				batch = append(batch, path)
+				if config.CaptureModTimes {
+					modTimes = append(modTimes, info.ModTime())
+				}
+				dirCount++
 				return nil
 			}
 			
-			if path == config.Root {
+			if !d.IsDir() {
 				return nil
 			}
 			
-			// Skip the excluded path and all its subdirectories
-			if excludePath != "" && (path == excludePath || strings.HasPrefix(path, excludePath+string(filepath.Separator))) {
+			// depth counts path components below root, so an immediate child is
+			// depth 1 and matches isWithinDepth's separator count of 0
+			if depth-1 > config.MaxDepth {
 				return filepath.SkipDir
 			}
 			
-			if !isWithinDepth(path, config.Root, config.MaxDepth) {
-				return filepath.SkipDir
+			progress.Scanned++
+			if depth > deepest {
+				deepest, progress.Deepest = depth, path
+			}
+			if progress.Scanned%interval == 0 {
+				if err := sendProgress(); err != nil {
+					return err
+				}
 			}
 			
-			if config.UseIgnorePatterns && shouldIgnore(d.Name()) {
+			if config.Deny.covers(path) {
 				return filepath.SkipDir
 			}
 			
-			batch = append(batch, path)
-			dirCount++
-			
-			// Send batch when it reaches the size limit
-			if len(batch) >= currentBatchSize {
-				// Create new slice to avoid data races
-				sendBatch := make([]string, len(batch))
-				copy(sendBatch, batch)
-				
-				select {
-				case ch <- DirBatch{
-					Directories: sendBatch,
-					Done:        false,
-				}:
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				
-				// Adaptive batch sizing: increase batch size for large directories
-				if dirCount > 500 && currentBatchSize < config.MaxBatchSize {
-					currentBatchSize = min(currentBatchSize*2, config.MaxBatchSize)
-				}
-				
-				batch = batch[:0] // Reset slice but keep capacity
+			// Skip the excluded path and all its subdirectories
+			if excludePath != "" && isWithinPath(path, excludePath) {
+				progress.Ignored++
+				return filepath.SkipDir
 			}
 			
-			return nil
-		})
-		
-		// Handle context cancellation
-		if ctx.Err() != nil {
-			err = ctx.Err()
-		}
-		
-		// Send any remaining directories
-		if len(batch) > 0 || err != nil {
-			select {
-			case ch <- DirBatch{
-				Directories: batch,
-				Done:        true,
-				Err:         err,
-			}:
-			case <-ctx.Done():
-			}
-		} else {
-			// Send done signal even if no remaining batch
-			select {
-			case ch <- DirBatch{
-				Directories: nil,
-				Done:        true,
-				Err:         err,
-			}:
-			case <-ctx.Done():
+			if isIgnored(config.ignorePath(path), ignoreConfig) {
+				progress.Ignored++
+				ignored++
+				return filepath.SkipDir
 			}
-		}
-	}()
-	
-	return ch
-}
-
-func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
-	// Use smaller buffer to provide backpressure
-	ch := make(chan DirBatch, 2)
-	
-	go func() {
-		defer close(ch)
-		
-		var batch []string
-		batch = make([]string, 0, config.InitialBatchSize)
-		currentBatchSize := config.InitialBatchSize
-		dirCount := 0
-		
-		// Custom walk function that respects context cancellation
-		err := walkDirContext(ctx, config.Root, func(path string, d fs.DirEntry, err error) error {
-			// Check for cancellation
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
+			
+			if checkDevice {
+				if device, ok := deviceOf(path); ok && device != rootDevice {
+					// A mount point: leave the other filesystem alone
+					progress.Mounts++
+					return filepath.SkipDir
+				}
 			}
 			
-			if err != nil {
-				// Log permission errors but continue scanning
+			if config.OmitPaths[path] || config.Deny.Exact[path] || depth-1 < config.MinDepth {
 				return nil
 			}
 			
-			if !d.IsDir() {
+			if config.SkipEmpty && isEmptyDir(path) {
 				return nil
 			}
 			
-			if path == config.Root {
+			if config.MinEntries > 1 && hasFewerEntries(path, config.MinEntries) {
 				return nil
 			}
 			
-			if !isWithinDepth(path, config.Root, config.MaxDepth) {
-				return filepath.SkipDir
+			if config.tooOld(d.Info()) {
+				return nil
 			}
 			
-			if config.UseIgnorePatterns && shouldIgnore(d.Name()) {
-				return filepath.SkipDir
+			if config.WritableOnly && readOnlyDir(path) {
+				return nil
 			}
 			
 			batch = append(batch, path)
+			if config.CaptureModTimes {
+				var modTime time.Time
+				if info, err := d.Info(); err == nil {
+					modTime = info.ModTime()
+				}
+				modTimes = append(modTimes, modTime)
+			}
 			dirCount++
 			
 			// Send batch when it reaches the size limit
@@ -243,10 +415,16 @@ func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
 				// Create new slice to avoid data races
 				sendBatch := make([]string, len(batch))
 				copy(sendBatch, batch)
+				sendTimes, sendRepos, sendTargets, sendIgnored := modTimes, repos, targets, ignored
+				modTimes, repos, targets, ignored = nil, nil, nil, 0
 				
 				select {
 				case ch <- DirBatch{
 					Directories: sendBatch,
+					ModTimes:    sendTimes,
+					Repos:       sendRepos,
+					Targets:     sendTargets,
+					Ignored:     sendIgnored,
 					Done:        false,
 				}:
 				case <-ctx.Done():
@@ -254,7 +432,7 @@ func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
 				}
 				
 				// Adaptive batch sizing: increase batch size for large directories
-				if dirCount > 500 && currentBatchSize < config.MaxBatchSize {
+				if !config.FixedBatch && dirCount > 500 && currentBatchSize < config.MaxBatchSize {
 					currentBatchSize = min(currentBatchSize*2, config.MaxBatchSize)
 				}
 				
@@ -268,12 +446,26 @@ func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
 		if ctx.Err() != nil {
 			err = ctx.Err()
 		}
+		if err != nil {
+			err = &scanError{Path: last, Op: "walk", Err: err}
+		}
+		
+		// The final counters go out before the final batch, so a receiver
+		// that stops at Done has already seen them
+		if err == nil {
+			progress.Done = true
+			sendProgress()
+		}
 		
 		// Send any remaining directories
 		if len(batch) > 0 || err != nil {
 			select {
 			case ch <- DirBatch{
 				Directories: batch,
+				ModTimes:    modTimes,
+				Repos:       repos,
+				Targets:     targets,
+				Ignored:     ignored,
 				Done:        true,
 				Err:         err,
 			}:
@@ -284,6 +476,8 @@ func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
 			select {
 			case ch <- DirBatch{
 				Directories: nil,
+				Repos:       repos,
+				Ignored:     ignored,
 				Done:        true,
 				Err:         err,
 			}:
@@ -295,17 +489,364 @@ func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
 	return ch
 }
 
-// walkDirContext is a wrapper around filepath.WalkDir that respects context cancellation
-func walkDirContext(ctx context.Context, root string, fn fs.WalkDirFunc) error {
-	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		// Check context before processing
+// isEmptyDir reports whether dir has no entries at all. Unreadable
+// directories are not known to be empty, so they count as non-empty.
+func isEmptyDir(dir string) bool {
+	return hasFewerEntries(dir, 1)
+}
+
+// hasFewerEntries reports whether dir has fewer than n entries, reading no
+// more than n names. Unreadable directories are kept, as with isEmptyDir.
+func hasFewerEntries(dir string, n int) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	count := 0
+	for count < n {
+		names, err := f.Readdirnames(n - count)
+		count += len(names)
+		if err == io.EOF {
+			return count < n
+		}
+		if err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// isWithinPath reports whether path is dir or lies below it. dir must be
+// clean; it only ends in a separator when it is a filesystem root.
+func isWithinPath(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
+func scanWithConfigCtx(ctx context.Context, config ScanConfig) <-chan DirBatch {
+	return scanWithConfigCtxExcluding(ctx, config, "")
+}
+
+// ancestorPaths returns every parent directory of path up to and including
+// the filesystem root, but not path itself
+func ancestorPaths(path string) map[string]bool {
+	ancestors := make(map[string]bool)
+	path = filepath.Clean(path)
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ancestors
+		}
+		ancestors[parent] = true
+		path = parent
+	}
+}
+
+// readDir lists a directory for the walkers; tests replace it to simulate
+// failing filesystems
+var readDir = os.ReadDir
+
+// retryBackoff is the pause before the first retry of a failed directory
+// read; it doubles for each further retry
+var retryBackoff = 50 * time.Millisecond
+
+// readDirRetrying reads dir, retrying a failed read up to retries times, as
+// network mounts can fail transiently. Missing and permission-denied
+// directories fail the same way every time and are not retried, and the
+// backoff is cut short when ctx ends.
+func readDirRetrying(ctx context.Context, dir string, retries int) ([]fs.DirEntry, error) {
+	entries, err := readDir(dir)
+	backoff := retryBackoff
+	for attempt := 0; attempt < retries && err != nil; attempt++ {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			break
+		}
+		timer := time.NewTimer(backoff)
 		select {
+		case <-timer.C:
 		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			return fn(path, d, err)
+			timer.Stop()
+			return entries, err
 		}
-	})
+		backoff *= 2
+		entries, err = readDir(dir)
+	}
+	return entries, err
+}
+
+// dirReader reads directories for the walkers, retrying failed reads (see
+// readDirRetrying). With more than one worker, the directories the walk
+// reaches next are read ahead, at most workers at a time, while the walk
+// still visits everything in order. A nil dirReader reads one directory at a
+// time without retrying.
+type dirReader struct {
+	retries int
+	workers int
+	// wanted reports whether the walk will descend into the directory at
+	// path, depth components below the root, so that only those are read
+	// ahead; nil wants every directory
+	wanted func(path string, depth int) bool
+	slots  chan struct{} // Held for every read while workers > 1
+	mu     sync.Mutex
+	ahead  map[string]chan dirListing // Reads started ahead, by directory
+}
+
+// dirListing is the outcome of a directory read
+type dirListing struct {
+	entries []fs.DirEntry
+	err     error
+}
+
+func newDirReader(retries, workers int, wanted func(path string, depth int) bool) *dirReader {
+	r := &dirReader{retries: retries, workers: workers, wanted: wanted}
+	if workers > 1 {
+		r.slots = make(chan struct{}, workers)
+		r.ahead = make(map[string]chan dirListing)
+	}
+	return r
+}
+
+// read lists dir, taking the result of a read started ahead when there is one
+func (r *dirReader) read(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+	if r == nil {
+		return readDirRetrying(ctx, dir, 0)
+	}
+	if r.slots == nil {
+		return readDirRetrying(ctx, dir, r.retries)
+	}
+	
+	r.mu.Lock()
+	result, ok := r.ahead[dir]
+	delete(r.ahead, dir)
+	r.mu.Unlock()
+	if !ok {
+		result = r.start(ctx, dir)
+	}
+	listing := <-result
+	return listing.entries, listing.err
+}
+
+// readAhead starts reading dir, depth components below the root, in the
+// background if the walk will want it and it isn't being read already
+func (r *dirReader) readAhead(ctx context.Context, dir string, depth int) {
+	if r == nil || r.slots == nil {
+		return
+	}
+	// Checked first, as wanted may stat dir and match the ignore rules
+	r.mu.Lock()
+	_, started := r.ahead[dir]
+	r.mu.Unlock()
+	if started || (r.wanted != nil && !r.wanted(dir, depth)) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ahead[dir]; !ok {
+		r.ahead[dir] = r.start(ctx, dir)
+	}
+}
+
+// siblingReads reads ahead the subdirectories listed in one directory as the
+// walk moves through its entries, keeping the next workers-1 of them started.
+// Each subdirectory is considered once, so a directory of many files costs
+// one pass over its entries.
+type siblingReads struct {
+	dir     string
+	entries []fs.DirEntry
+	depth   int   // Depth of the entries below the root
+	subdirs []int // Indexes of the directories among entries
+	passed  int   // subdirs[:passed] are at or before the walk's position
+	next    int   // subdirs[:next] have been considered for reading ahead
+}
+
+// siblings prepares reading ahead the subdirectories among entries of dir,
+// or returns nil when r doesn't read ahead
+func (r *dirReader) siblings(dir string, entries []fs.DirEntry, depth int) *siblingReads {
+	if r == nil || r.slots == nil {
+		return nil
+	}
+	w := &siblingReads{dir: dir, entries: entries, depth: depth}
+	for i, entry := range entries {
+		if entry.IsDir() {
+			w.subdirs = append(w.subdirs, i)
+		}
+	}
+	return w
+}
+
+// advance starts the reads for the subdirectories after entries[i], as many
+// as there are workers besides the one the walk waits on
+func (w *siblingReads) advance(ctx context.Context, r *dirReader, i int) {
+	if w == nil {
+		return
+	}
+	for w.passed < len(w.subdirs) && w.subdirs[w.passed] <= i {
+		w.passed++
+	}
+	if w.next < w.passed {
+		w.next = w.passed
+	}
+	for ; w.next < len(w.subdirs) && w.next < w.passed+r.workers-1; w.next++ {
+		r.readAhead(ctx, filepath.Join(w.dir, w.entries[w.subdirs[w.next]].Name()), w.depth)
+	}
+}
+
+// forget drops the read started ahead for dir, which the walk skipped
+func (r *dirReader) forget(dir string) {
+	if r == nil || r.slots == nil {
+		return
+	}
+	r.mu.Lock()
+	delete(r.ahead, dir)
+	r.mu.Unlock()
+}
+
+// start reads dir on its own goroutine once a worker slot is free
+func (r *dirReader) start(ctx context.Context, dir string) chan dirListing {
+	result := make(chan dirListing, 1)
+	go func() {
+		r.slots <- struct{}{}
+		entries, err := readDirRetrying(ctx, dir, r.retries)
+		<-r.slots
+		result <- dirListing{entries, err}
+	}()
+	return result
+}
+
+// walkDepthFunc is the callback for walkDirDepth. depth is the number of path
+// components between root and path (1 for root's immediate children). A read
+// error for a directory is reported in a second call with err set.
+type walkDepthFunc func(path string, d fs.DirEntry, depth int, err error) error
+
+// walkDirDepth walks the tree under root (excluding root itself) in the same
+// lexical, depth-first order as filepath.WalkDir, honouring filepath.SkipDir
+// and filepath.SkipAll. The depth is tracked as the walk descends so callers
+// don't have to recompute it from the path, and the context is checked once
+// per directory read rather than once per entry. Directories are read
+// through r (see dirReader).
+func walkDirDepth(ctx context.Context, root string, r *dirReader, fn walkDepthFunc) error {
+	err := walkDirDepthRecursive(ctx, root, nil, 0, r, fn)
+	if err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func walkDirDepthRecursive(ctx context.Context, dir string, d fs.DirEntry, depth int, r *dirReader, fn walkDepthFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	entries, err := r.read(ctx, dir)
+	if err != nil {
+		if err := fn(dir, d, depth, err); err != nil {
+			if err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+		// ReadDir may still have returned the entries it managed to read
+	}
+	
+	ahead := r.siblings(dir, entries, depth+1)
+	for i, entry := range entries {
+		ahead.advance(ctx, r, i)
+		
+		path := filepath.Join(dir, entry.Name())
+		if err := fn(path, entry, depth+1, nil); err != nil {
+			r.forget(path)
+			if err != filepath.SkipDir {
+				return err
+			}
+			if !entry.IsDir() {
+				// As with WalkDir, SkipDir on a file skips the rest of its directory
+				return nil
+			}
+			continue
+		}
+		
+		if entry.IsDir() {
+			if err := walkDirDepthRecursive(ctx, path, entry, depth+1, r, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkDirBreadth is walkDirDepth in breadth-first order: every directory at
+// one depth is visited before any below it, in lexical order within each
+// directory. The queue holds the directories of at most two levels at a time.
+func walkDirBreadth(ctx context.Context, root string, r *dirReader, fn walkDepthFunc) error {
+	type queued struct {
+		path  string
+		entry fs.DirEntry
+		depth int
+	}
+	queue := []queued{{path: root}}
+	aheadTo := 0 // queue[:aheadTo] have been considered for reading ahead
+	
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		
+		dir := queue[0]
+		queue[0] = queued{}
+		queue = queue[1:]
+		if aheadTo > 0 {
+			aheadTo--
+		}
+		
+		// Everything queued has been accepted, so the next few are read
+		// ahead while this one is listed
+		if r != nil {
+			for ; aheadTo < len(queue) && aheadTo < r.workers-1; aheadTo++ {
+				r.readAhead(ctx, queue[aheadTo].path, queue[aheadTo].depth)
+			}
+		}
+		
+		entries, err := r.read(ctx, dir.path)
+		if err != nil {
+			if err := fn(dir.path, dir.entry, dir.depth, err); err != nil {
+				if err == filepath.SkipDir {
+					continue
+				}
+				if err == filepath.SkipAll {
+					return nil
+				}
+				return err
+			}
+		}
+	
+	listing:
+		for _, entry := range entries {
+			path := filepath.Join(dir.path, entry.Name())
+			if err := fn(path, entry, dir.depth+1, nil); err != nil {
+				switch {
+				case err == filepath.SkipAll:
+					return nil
+				case err != filepath.SkipDir:
+					return err
+				case !entry.IsDir():
+					// As with WalkDir, SkipDir on a file skips the rest of its directory
+					break listing
+				}
+				continue
+			}
+			
+			if entry.IsDir() {
+				queue = append(queue, queued{path: path, entry: entry, depth: dir.depth + 1})
+			}
+		}
+	}
+	return nil
 }
 
 func min(a, b int) int {
@@ -317,9 +858,18 @@ func min(a, b int) int {
 
 // DirBatch represents a batch of discovered directories
 type DirBatch struct {
-	Directories []string // New directories in this batch
-	Done        bool     // Whether scanning is complete
-	Err         error    // Any error that occurred
+	Directories []string          // New directories in this batch
+	ModTimes    []time.Time       // Parallel to Directories when captured; zero if unreadable
+	Repos       []string          // Git repository roots found so far, possibly listed in earlier batches
+	Targets     map[string]string // Where symlinked directories in this batch resolve to, with SymlinkTargets
+	Ignored     int               // Directories skipped by ignore rules since the previous batch, subtrees counted once
+	Done        bool              // Whether scanning is complete
+	Err         error             // Any error that occurred
+	// LocalEmpty marks the point where a two-phase scan found nothing under
+	// the starting directory; everything after it comes from the global phase
+	LocalEmpty bool
+	// Global marks directories from the global phase of a two-phase scan
+	Global bool
 }
 
 func shouldIgnore(name string) bool {
@@ -331,6 +881,10 @@ func shouldIgnore(name string) bool {
 	return false
 }
 
+// isWithinDepth reports whether path is at most maxDepth levels below root's
+// immediate children: it counts the separators in path relative to root, so
+// an immediate child is 0 and so is root itself. ScanConfig.MaxDepth counts
+// the same way; scanMaxDepth converts --depth to it.
 func isWithinDepth(path, root string, maxDepth int) bool {
 	relPath, err := filepath.Rel(root, path)
 	if err != nil {
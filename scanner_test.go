@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestScanDirectories(t *testing.T) {
@@ -195,4 +203,1000 @@ func TestScanDirectoriesNonExistentPath(t *testing.T) {
 	if len(dirs) != 0 {
 		t.Error("Expected empty results for nonexistent path")
 	}
+}
+
+func TestScanWithPathIgnorePatterns(t *testing.T) {
+	tempDir := t.TempDir()
+
+	testDirs := []string{
+		"src/generated/deep",
+		"lib/generated",
+		"src/handwritten",
+	}
+	for _, dir := range testDirs {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	config := ScanConfig{
+		Root:              tempDir,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+		IgnorePatterns:    []string{"src/generated"},
+	}
+
+	var dirs []string
+	for batch := range scanWithConfig(config) {
+		dirs = append(dirs, batch.Directories...)
+	}
+
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir, filepath.Join(tempDir, "src", "generated")) {
+			t.Errorf("Path-scoped ignore did not skip %s", dir)
+		}
+	}
+
+	found := false
+	for _, dir := range dirs {
+		if dir == filepath.Join(tempDir, "lib", "generated") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected lib/generated to survive a src/generated rule")
+	}
+}
+
+func TestWalkDirDepth(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"a/b/c", "a/skip/inner", "z"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "a", "file.txt"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	depths := make(map[string]int)
+	err := walkDirDepth(context.Background(), tempDir, nil, func(path string, d fs.DirEntry, depth int, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(tempDir, path)
+		depths[filepath.ToSlash(rel)] = depth
+		if d.Name() == "skip" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkDirDepth failed: %v", err)
+	}
+
+	expected := map[string]int{
+		"a":          1,
+		"a/b":        2,
+		"a/b/c":      3,
+		"a/file.txt": 2,
+		"a/skip":     2,
+		"z":          1,
+	}
+	for path, depth := range expected {
+		if got, ok := depths[path]; !ok || got != depth {
+			t.Errorf("depth of %s = %d (seen %v), expected %d", path, got, ok, depth)
+		}
+	}
+	if _, ok := depths["a/skip/inner"]; ok {
+		t.Error("walkDirDepth descended into a directory that returned SkipDir")
+	}
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := walkDirDepth(ctx, tempDir, nil, func(string, fs.DirEntry, int, error) error { return nil })
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestAncestorPaths(t *testing.T) {
+	ancestors := ancestorPaths("/home/me/projects/")
+	for _, expected := range []string{"/", "/home", "/home/me"} {
+		if !ancestors[expected] {
+			t.Errorf("Expected %s among the ancestors", expected)
+		}
+	}
+	if ancestors["/home/me/projects"] || len(ancestors) != 3 {
+		t.Errorf("Unexpected ancestors: %v", ancestors)
+	}
+
+	if got := ancestorPaths("/"); len(got) != 0 {
+		t.Errorf("The root has no ancestors, got %v", got)
+	}
+}
+
+func TestScanOmitsAncestorChain(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"home/me/work/app", "home/me/notes", "home/other", "srv"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	cwd := filepath.Join(tempDir, "home", "me", "work")
+	config := ScanConfig{
+		Root:             tempDir,
+		MaxDepth:         5,
+		InitialBatchSize: 10,
+		MaxBatchSize:     10,
+		OmitPaths:        ancestorPaths(cwd),
+	}
+
+	found := make(map[string]bool)
+	for batch := range scanWithConfigCtxExcluding(context.Background(), config, cwd) {
+		for _, dir := range batch.Directories {
+			found[dir] = true
+		}
+	}
+
+	for _, omitted := range []string{"home", "home/me", "home/me/work", "home/me/work/app"} {
+		if found[filepath.Join(tempDir, omitted)] {
+			t.Errorf("%s should be absent from the global phase", omitted)
+		}
+	}
+	// Siblings along the chain are still reached through the omitted parents
+	for _, kept := range []string{"home/me/notes", "home/other", "srv"} {
+		if !found[filepath.Join(tempDir, kept)] {
+			t.Errorf("Expected %s in the global phase", kept)
+		}
+	}
+}
+
+func TestScanCapturesModTimes(t *testing.T) {
+	tempDir := t.TempDir()
+
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	for _, dir := range []string{"fresh", "old"} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+	if err := os.Chtimes(filepath.Join(tempDir, "old"), old, old); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	config := ScanConfig{
+		Root:             tempDir,
+		MaxDepth:         5,
+		InitialBatchSize: 1,
+		MaxBatchSize:     1,
+		CaptureModTimes:  true,
+	}
+
+	modTimes := make(map[string]time.Time)
+	for batch := range scanWithConfig(config) {
+		if len(batch.ModTimes) != len(batch.Directories) {
+			t.Fatalf("ModTimes not parallel to Directories: %d vs %d", len(batch.ModTimes), len(batch.Directories))
+		}
+		for i, dir := range batch.Directories {
+			modTimes[filepath.Base(dir)] = batch.ModTimes[i]
+		}
+	}
+
+	if !modTimes["old"].Equal(old) {
+		t.Errorf("Expected old mtime %v, got %v", old, modTimes["old"])
+	}
+	if time.Since(modTimes["fresh"]) > time.Hour {
+		t.Errorf("Expected a fresh mtime, got %v", modTimes["fresh"])
+	}
+}
+
+func TestWalkDirBreadth(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"a/b/c", "a/skip/inner", "z/y"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	var order []string
+	err := walkDirBreadth(context.Background(), tempDir, nil, func(path string, d fs.DirEntry, depth int, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(tempDir, path)
+		order = append(order, fmt.Sprintf("%s@%d", filepath.ToSlash(rel), depth))
+		if d.Name() == "skip" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkDirBreadth failed: %v", err)
+	}
+
+	expected := "a@1 z@1 a/b@2 a/skip@2 z/y@2 a/b/c@3"
+	if got := strings.Join(order, " "); got != expected {
+		t.Errorf("walk order = %q, expected %q", got, expected)
+	}
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := walkDirBreadth(ctx, tempDir, nil, func(string, fs.DirEntry, int, error) error { return nil })
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestBreadthFirstScanShallowFirst(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// One deep branch that sorts first, and shallow siblings after it
+	dirs := []string{"aaa/1/2/3/4/5", "aaa/node_modules/pkg"}
+	for i := 0; i < 4; i++ {
+		dirs = append(dirs, fmt.Sprintf("shallow%d", i))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	config := ScanConfig{
+		Root:              tempDir,
+		MaxDepth:          3,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  5,
+		MaxBatchSize:      5,
+		BreadthFirst:      true,
+	}
+
+	var batches [][]string
+	for batch := range scanWithConfig(config) {
+		batches = append(batches, batch.Directories)
+	}
+	if len(batches) < 2 {
+		t.Fatalf("Expected several batches, got %d", len(batches))
+	}
+
+	first := strings.Join(batches[0], "\n")
+	for i := 0; i < 4; i++ {
+		if !strings.Contains(first, fmt.Sprintf("shallow%d", i)) {
+			t.Errorf("shallow%d missing from the first batch: %v", i, batches[0])
+		}
+	}
+
+	var all []string
+	for _, batch := range batches {
+		all = append(all, batch...)
+	}
+	for _, dir := range all {
+		rel, _ := filepath.Rel(tempDir, dir)
+		if strings.Contains(rel, "node_modules") {
+			t.Errorf("Ignored directory %s was scanned", rel)
+		}
+		if strings.Count(filepath.ToSlash(rel), "/") > config.MaxDepth {
+			t.Errorf("%s is deeper than the depth limit", rel)
+		}
+	}
+}
+
+func TestScanDetectsRepos(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"app/.git/objects", "app/src", "plain/src", "worktree"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+	// Worktrees and submodules have a .git file instead of a directory
+	if err := os.WriteFile(filepath.Join(tempDir, "worktree", ".git"), []byte("gitdir: ../app/.git"), 0644); err != nil {
+		t.Fatalf("Failed to create .git file: %v", err)
+	}
+
+	config := ScanConfig{
+		Root:              tempDir,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  2,
+		MaxBatchSize:      2,
+		DetectRepos:       true,
+	}
+
+	repos := make(map[string]bool)
+	for batch := range scanWithConfig(config) {
+		for _, dir := range batch.Directories {
+			if strings.Contains(dir, ".git") {
+				t.Errorf("The .git directory itself should stay ignored: %s", dir)
+			}
+		}
+		for _, repo := range batch.Repos {
+			repos[repo] = true
+		}
+	}
+
+	for _, dir := range []string{"app", "worktree"} {
+		if !repos[filepath.Join(tempDir, dir)] {
+			t.Errorf("Expected %s to be detected as a repository root", dir)
+		}
+	}
+	if len(repos) != 2 {
+		t.Errorf("Expected exactly two repository roots, got %v", repos)
+	}
+}
+
+func TestOneFilesystemSkipsMounts(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"local/src", "mnt/share/docs", "other"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	// Pretend mnt/share is a mount point of another device
+	mount := filepath.Join(tempDir, "mnt", "share")
+	original := deviceOf
+	deviceOf = func(path string) (uint64, bool) {
+		if path == mount || strings.HasPrefix(path, mount+string(filepath.Separator)) {
+			return 2, true
+		}
+		return 1, true
+	}
+	defer func() { deviceOf = original }()
+
+	scan := func(oneFilesystem bool) map[string]bool {
+		config := ScanConfig{
+			Root:             tempDir,
+			MaxDepth:         5,
+			InitialBatchSize: 10,
+			MaxBatchSize:     10,
+			OneFilesystem:    oneFilesystem,
+		}
+		found := make(map[string]bool)
+		for batch := range scanWithConfig(config) {
+			for _, dir := range batch.Directories {
+				rel, _ := filepath.Rel(tempDir, dir)
+				found[filepath.ToSlash(rel)] = true
+			}
+		}
+		return found
+	}
+
+	found := scan(true)
+	for _, dir := range []string{"mnt/share", "mnt/share/docs"} {
+		if found[dir] {
+			t.Errorf("%s is on another device and should be skipped", dir)
+		}
+	}
+	for _, dir := range []string{"local", "local/src", "mnt", "other"} {
+		if !found[dir] {
+			t.Errorf("Expected %s on the root's device to be scanned", dir)
+		}
+	}
+
+	if !scan(false)["mnt/share/docs"] {
+		t.Error("Without --one-filesystem mounts should be crossed")
+	}
+}
+
+func TestDeviceID(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "child"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+
+	parent, ok := deviceID(tempDir)
+	if !ok {
+		t.Skip("Device IDs are not available on this platform")
+	}
+	child, ok := deviceID(filepath.Join(tempDir, "child"))
+	if !ok || child != parent {
+		t.Errorf("A subdirectory should share its parent's device: %d vs %d", child, parent)
+	}
+	if _, ok := deviceID(filepath.Join(tempDir, "missing")); ok {
+		t.Error("Expected no device for a missing path")
+	}
+}
+
+func TestDeepenPassYieldsOnlyNewLevel(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"a/b/c/d", "a/x", "e/f/g"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	scan := func(minDepth, maxDepth int) []string {
+		config := ScanConfig{
+			Root:             tempDir,
+			MinDepth:         minDepth,
+			MaxDepth:         maxDepth,
+			InitialBatchSize: 10,
+			MaxBatchSize:     10,
+		}
+		var dirs []string
+		for batch := range scanWithConfig(config) {
+			dirs = append(dirs, batch.Directories...)
+		}
+		return dirs
+	}
+
+	// Start shallow, then deepen one level at a time
+	listed := scan(0, 0)
+	seen := make(map[string]bool)
+	for _, dir := range listed {
+		seen[dir] = true
+	}
+	for depth := 1; depth <= 3; depth++ {
+		for _, dir := range scan(depth, depth) {
+			if seen[dir] {
+				t.Errorf("Deepening to %d re-emitted %s", depth, dir)
+			}
+			seen[dir] = true
+			listed = append(listed, dir)
+		}
+	}
+
+	full := scan(0, 3)
+	sort.Strings(full)
+	sort.Strings(listed)
+	if strings.Join(listed, "\n") != strings.Join(full, "\n") {
+		t.Errorf("Incremental deepening found\n%v\nexpected the full scan\n%v", listed, full)
+	}
+}
+
+func TestScanProgressEvents(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 25; i++ {
+		if err := os.Mkdir(filepath.Join(tempDir, fmt.Sprintf("dir%02d", i)), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	deepest := filepath.Join(tempDir, "dir00", "a", "b")
+	for _, dir := range []string{deepest, filepath.Join(tempDir, "node_modules")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	progressChan := make(chan scanProgress)
+	var events []scanProgress
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for p := range progressChan {
+			events = append(events, p)
+			if p.Done {
+				return
+			}
+		}
+	}()
+
+	var found int
+	for batch := range scanWithConfig(ScanConfig{
+		Root:              tempDir,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  4,
+		MaxBatchSize:      4,
+		Progress:          progressChan,
+		ProgressInterval:  10,
+	}) {
+		found += len(batch.Directories)
+	}
+	<-collected
+
+	// 25 top-level dirs, a, b and node_modules are examined
+	scanned := []int{10, 20, 28}
+	if len(events) != len(scanned) {
+		t.Fatalf("Expected %d progress events, got %+v", len(scanned), events)
+	}
+	for i, event := range events {
+		if event.Scanned != scanned[i] {
+			t.Errorf("Event %d: expected Scanned %d, got %d", i, scanned[i], event.Scanned)
+		}
+		if event.Done != (i == len(events)-1) {
+			t.Errorf("Event %d: unexpected Done %v", i, event.Done)
+		}
+	}
+	final := events[len(events)-1]
+	if final.Ignored != 1 || final.Deepest != deepest {
+		t.Errorf("Expected 1 ignored and deepest %s, got %+v", deepest, final)
+	}
+	if found != 27 {
+		t.Errorf("Progress must not change the batches: expected 27 dirs, got %d", found)
+	}
+}
+
+func TestBrokenSymlinksSkipped(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"real/sub", "other"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	broken := filepath.Join(tempDir, "real", "dangling")
+	if err := os.Symlink(filepath.Join(tempDir, "gone"), broken); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tempDir, "other"), filepath.Join(tempDir, "alias")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	for _, breadthFirst := range []bool{false, true} {
+		progressChan := make(chan scanProgress, 1)
+		var log strings.Builder
+		var found []string
+		done := false
+		for batch := range scanWithConfig(ScanConfig{
+			Root:              tempDir,
+			MaxDepth:          5,
+			UseIgnorePatterns: true,
+			InitialBatchSize:  10,
+			MaxBatchSize:      10,
+			BreadthFirst:      breadthFirst,
+			Progress:          progressChan,
+			DebugLog:          &log,
+		}) {
+			if batch.Err != nil {
+				t.Fatalf("Scan aborted: %v", batch.Err)
+			}
+			found = append(found, batch.Directories...)
+			done = done || batch.Done
+		}
+
+		if !done {
+			t.Error("Scan did not complete")
+		}
+		sort.Strings(found)
+		expected := []string{filepath.Join(tempDir, "other"), filepath.Join(tempDir, "real"), filepath.Join(tempDir, "real", "sub")}
+		if strings.Join(found, "|") != strings.Join(expected, "|") {
+			t.Errorf("BreadthFirst %v: expected %v, got %v", breadthFirst, expected, found)
+		}
+		if final := <-progressChan; final.Broken != 1 {
+			t.Errorf("Expected 1 broken symlink counted, got %+v", final)
+		}
+		if !strings.Contains(log.String(), broken) || strings.Contains(log.String(), "alias") {
+			t.Errorf("Expected only the dangling link in the debug log, got %q", log.String())
+		}
+	}
+}
+
+func TestFixedBatchSize(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 30; i++ {
+		for j := 0; j < 30; j++ {
+			if err := os.MkdirAll(filepath.Join(tempDir, fmt.Sprintf("d%02d", i), fmt.Sprintf("e%02d", j)), 0755); err != nil {
+				t.Fatalf("Failed to create test dir: %v", err)
+			}
+		}
+	}
+
+	sizes := func(fixed bool) []int {
+		var sizes []int
+		for batch := range scanWithConfig(ScanConfig{
+			Root:             tempDir,
+			MaxDepth:         5,
+			InitialBatchSize: 20,
+			MaxBatchSize:     200,
+			FixedBatch:       fixed,
+		}) {
+			if !batch.Done {
+				sizes = append(sizes, len(batch.Directories))
+			}
+		}
+		return sizes
+	}
+
+	// 930 directories: past 500 the adaptive scan grows its batches
+	if adaptive := sizes(false); adaptive[len(adaptive)-1] <= 20 {
+		t.Fatalf("Expected adaptive batches to grow, got %v", adaptive)
+	}
+	for i, size := range sizes(true) {
+		if size != 20 {
+			t.Fatalf("Batch %d has %d directories, expected a constant 20", i, size)
+		}
+	}
+}
+
+func TestIsWithinPath(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		expected  bool
+	}{
+		{"/home/me", "/home/me", true},
+		{"/home/me/src", "/home/me", true},
+		{"/home/meta", "/home/me", false},
+		{"/home", "/home/me", false},
+		{"/home/me/src", "/", true},
+		{"/", "/", true},
+	}
+	for _, test := range tests {
+		if got := isWithinPath(test.path, test.dir); got != test.expected {
+			t.Errorf("isWithinPath(%q, %q) = %v, expected %v", test.path, test.dir, got, test.expected)
+		}
+	}
+}
+
+func TestScanExcludingTrailingSeparator(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"keep/a", "skip/b", "skipper"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	config := ScanConfig{Root: tempDir, MaxDepth: 5, InitialBatchSize: 10, MaxBatchSize: 10}
+
+	scan := func(excludePath string) []string {
+		var found []string
+		for batch := range scanWithConfigCtxExcluding(context.Background(), config, excludePath) {
+			for _, dir := range batch.Directories {
+				found = append(found, strings.TrimPrefix(dir, tempDir))
+			}
+		}
+		sort.Strings(found)
+		return found
+	}
+
+	expected := "/keep /keep/a /skipper"
+	for _, exclude := range []string{filepath.Join(tempDir, "skip"), filepath.Join(tempDir, "skip") + "/", filepath.Join(tempDir, "skip") + "//"} {
+		if got := strings.Join(scan(exclude), " "); got != expected {
+			t.Errorf("Excluding %q found %q, expected %q", exclude, got, expected)
+		}
+	}
+
+	// Excluding / covers everything, however it is spelled
+	for _, exclude := range []string{"/", "//"} {
+		if got := scan(exclude); len(got) != 0 {
+			t.Errorf("Excluding %q should leave nothing, found %v", exclude, got)
+		}
+	}
+}
+
+func TestScanSkipEmpty(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"empty", "parent/empty-child", "withfile", "locked/inner"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "withfile", "README"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	// An unreadable directory can't be shown to be empty, so it stays
+	locked := filepath.Join(tempDir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("Failed to lock test dir: %v", err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	var found []string
+	for batch := range scanWithConfig(ScanConfig{
+		Root:             tempDir,
+		MaxDepth:         5,
+		InitialBatchSize: 10,
+		MaxBatchSize:     10,
+		SkipEmpty:        true,
+	}) {
+		for _, dir := range batch.Directories {
+			found = append(found, strings.TrimPrefix(dir, tempDir))
+		}
+	}
+	sort.Strings(found)
+
+	// parent holds a directory, and locked holds one as well or can't be
+	// read; either way both are kept
+	expected := "/locked /parent /withfile"
+	if got := strings.Join(found, " "); got != expected {
+		t.Errorf("Found %q, expected %q", got, expected)
+	}
+}
+
+func TestScanMinEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	// Entry counts: none 0, one 1, two 2, three 3 (a file and two dirs)
+	files := map[string]int{"none": 0, "one": 1, "two": 2, "three": 1}
+	for dir, count := range files {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+		for i := 0; i < count; i++ {
+			if err := os.WriteFile(filepath.Join(tempDir, dir, fmt.Sprintf("f%d", i)), nil, 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+	}
+	for _, dir := range []string{"three/a", "three/b"} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	testCases := []struct {
+		min      int
+		expected string
+	}{
+		{0, "/none /one /three /three/a /three/b /two"},
+		{1, "/none /one /three /three/a /three/b /two"},
+		{2, "/three /two"},
+		{3, "/three"},
+		{4, ""},
+	}
+	for _, tc := range testCases {
+		var found []string
+		for batch := range scanWithConfig(ScanConfig{
+			Root:             tempDir,
+			MaxDepth:         5,
+			InitialBatchSize: 10,
+			MaxBatchSize:     10,
+			MinEntries:       tc.min,
+		}) {
+			for _, dir := range batch.Directories {
+				found = append(found, strings.TrimPrefix(dir, tempDir))
+			}
+		}
+		sort.Strings(found)
+		if got := strings.Join(found, " "); got != tc.expected {
+			t.Errorf("MinEntries %d: found %q, expected %q", tc.min, got, tc.expected)
+		}
+	}
+
+	// A directory that can't be read is kept
+	if hasFewerEntries(filepath.Join(tempDir, "missing"), 2) {
+		t.Error("An unreadable directory should not count as having fewer entries")
+	}
+}
+
+func TestScanNewerThan(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"old/fresh", "old/stale", "recent"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	// Age the parents last, since creating the children touched them
+	month := time.Now().Add(-30 * 24 * time.Hour)
+	for _, dir := range []string{"old/stale", "old"} {
+		if err := os.Chtimes(filepath.Join(tempDir, dir), month, month); err != nil {
+			t.Fatalf("Failed to age %s: %v", dir, err)
+		}
+	}
+
+	var found []string
+	for batch := range scanWithConfig(ScanConfig{
+		Root:             tempDir,
+		MaxDepth:         5,
+		InitialBatchSize: 10,
+		MaxBatchSize:     10,
+		NewerThan:        time.Now().Add(-7 * 24 * time.Hour),
+	}) {
+		for _, dir := range batch.Directories {
+			found = append(found, strings.TrimPrefix(dir, tempDir))
+		}
+	}
+	sort.Strings(found)
+	// A stale directory is still searched for fresh ones below it
+	if got := strings.Join(found, " "); got != "/old/fresh /recent" {
+		t.Errorf("Found %q, expected only the recently modified directories", got)
+	}
+
+	config := ScanConfig{NewerThan: month}
+	if !config.tooOld(nil, os.ErrPermission) {
+		t.Error("Expected a directory of unknown age to be left out by default")
+	}
+	config.KeepUnknownAge = true
+	if config.tooOld(nil, os.ErrPermission) {
+		t.Error("Expected KeepUnknownAge to keep a directory of unknown age")
+	}
+}
+
+func TestScanRetriesFailedReads(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"mount/a", "mount/b", "local"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	// The mount's first read fails as a network filesystem blip would
+	flaky := filepath.Join(tempDir, "mount")
+	var attempts int
+	defer func(read func(string) ([]os.DirEntry, error), backoff time.Duration) {
+		readDir, retryBackoff = read, backoff
+	}(readDir, retryBackoff)
+	retryBackoff = time.Millisecond
+	readDir = func(dir string) ([]os.DirEntry, error) {
+		if dir == flaky {
+			attempts++
+			if attempts == 1 {
+				return nil, errors.New("stale file handle")
+			}
+		}
+		return os.ReadDir(dir)
+	}
+
+	for _, breadthFirst := range []bool{false, true} {
+		for retries, expected := range []string{"/local /mount", "/local /mount /mount/a /mount/b"} {
+			attempts = 0
+			var found []string
+			for batch := range scanWithConfig(ScanConfig{
+				Root:             tempDir,
+				MaxDepth:         5,
+				InitialBatchSize: 10,
+				MaxBatchSize:     10,
+				BreadthFirst:     breadthFirst,
+				Retries:          retries,
+			}) {
+				for _, dir := range batch.Directories {
+					found = append(found, strings.TrimPrefix(dir, tempDir))
+				}
+			}
+			sort.Strings(found)
+			if got := strings.Join(found, " "); got != expected {
+				t.Errorf("BreadthFirst %v, Retries %d: found %q, expected %q", breadthFirst, retries, got, expected)
+			}
+		}
+	}
+
+	// Errors that won't go away are not retried, and a cancelled scan stops
+	// waiting to retry
+	attempts = 0
+	readDir = func(dir string) ([]os.DirEntry, error) {
+		attempts++
+		return nil, fs.ErrPermission
+	}
+	if _, err := readDirRetrying(context.Background(), flaky, 3); err == nil || attempts != 1 {
+		t.Errorf("Permission error read %d times, expected once", attempts)
+	}
+	retryBackoff = time.Hour
+	readDir = func(string) ([]os.DirEntry, error) { return nil, errors.New("timed out") }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := readDirRetrying(ctx, flaky, 3); err == nil {
+		t.Error("Expected the read error after cancellation")
+	}
+}
+
+func TestScanWorkersBoundConcurrentReads(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 6; i++ {
+		for j := 0; j < 4; j++ {
+			if err := os.MkdirAll(filepath.Join(tempDir, fmt.Sprintf("d%d/e%d", i, j)), 0755); err != nil {
+				t.Fatalf("Failed to create test dir: %v", err)
+			}
+		}
+	}
+
+	// Slow reads down so that reads running together overlap
+	var mu sync.Mutex
+	active, most := 0, 0
+	defer func(read func(string) ([]os.DirEntry, error)) { readDir = read }(readDir)
+	readDir = func(dir string) ([]os.DirEntry, error) {
+		mu.Lock()
+		active++
+		if active > most {
+			most = active
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return os.ReadDir(dir)
+	}
+
+	for _, breadthFirst := range []bool{false, true} {
+		var sequential []string
+		for _, workers := range []int{1, 3} {
+			// Read-ahead from the previous run may still be finishing
+			mu.Lock()
+			most = 0
+			mu.Unlock()
+			var found []string
+			for batch := range scanWithConfig(ScanConfig{
+				Root:             tempDir,
+				MaxDepth:         5,
+				InitialBatchSize: 100,
+				MaxBatchSize:     100,
+				BreadthFirst:     breadthFirst,
+				Workers:          workers,
+			}) {
+				found = append(found, batch.Directories...)
+			}
+
+			if len(found) != 30 {
+				t.Errorf("BreadthFirst %v, Workers %d: found %d directories, expected 30", breadthFirst, workers, len(found))
+			}
+			mu.Lock()
+			peak := most
+			mu.Unlock()
+			if peak > workers {
+				t.Errorf("BreadthFirst %v, Workers %d: %d reads ran at once", breadthFirst, workers, peak)
+			}
+			if workers > 1 && peak < 2 {
+				t.Errorf("BreadthFirst %v, Workers %d: reads never overlapped", breadthFirst, workers)
+			}
+
+			// Reading ahead doesn't change the order directories are found in
+			if sequential == nil {
+				sequential = found
+			} else if strings.Join(found, " ") != strings.Join(sequential, " ") {
+				t.Errorf("BreadthFirst %v, Workers %d: found %q, expected the sequential order %q", breadthFirst, workers, found, sequential)
+			}
+		}
+	}
+}
+func TestReadAheadChecksEachSiblingOnce(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 200; i++ {
+		if err := os.WriteFile(filepath.Join(tempDir, fmt.Sprintf("f%03d", i)), nil, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	for _, name := range []string{"a", "m", "z"} {
+		if err := os.Mkdir(filepath.Join(tempDir, name), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	checked := make(map[string]int)
+	r := newDirReader(0, 3, func(path string, depth int) bool {
+		mu.Lock()
+		checked[path]++
+		mu.Unlock()
+		return true
+	})
+	err := walkDirDepth(context.Background(), tempDir, r, func(string, fs.DirEntry, int, error) error { return nil })
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	// a is walked first, and the files around the others don't make the
+	// walk look at them again
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]int{filepath.Join(tempDir, "m"): 1, filepath.Join(tempDir, "z"): 1}
+	if !reflect.DeepEqual(checked, expected) {
+		t.Errorf("Expected each later subdirectory considered once for reading ahead, got %v", checked)
+	}
+}
+func TestSubtreeScanKeepsAnchoredIgnoreBase(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/notes", "a/a/notes"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	// A Ctrl+F style scan of a, with the pattern anchored at root
+	var found []string
+	for batch := range scanWithConfig(ScanConfig{
+		Root:              filepath.Join(root, "a"),
+		IgnoreBase:        root,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		IgnorePatterns:    []string{"/a/notes"},
+		InitialBatchSize:  10,
+		MaxBatchSize:      10,
+	}) {
+		found = append(found, batch.Directories...)
+	}
+
+	sort.Strings(found)
+	expected := []string{filepath.Join(root, "a", "a"), filepath.Join(root, "a", "a", "notes")}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected only root's a/notes ignored, found %v", found)
+	}
 }
\ No newline at end of file
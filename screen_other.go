@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "github.com/gdamore/tcell/v2"
+
+// openTTYScreen opens the console, which is separate from stdout there too
+func openTTYScreen() (tcell.Screen, error) {
+	return tcell.NewScreen()
+}
\ No newline at end of file
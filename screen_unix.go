@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// openTTYScreen draws the finder on the controlling terminal, never on
+// stdout, so result=$(cdf --print) captures the selected path and nothing
+// else even when the finder is killed mid-draw. The terminal is opened here
+// rather than left to tcell.NewScreen so that guarantee doesn't rest on
+// which screen tcell picks by default.
+func openTTYScreen() (tcell.Screen, error) {
+	tty, err := tcell.NewDevTty()
+	if err != nil {
+		return nil, fmt.Errorf("opening the terminal: %w", err)
+	}
+	return tcell.NewTerminfoScreenFromTty(tty)
+}
\ No newline at end of file
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runServer implements --server: it keeps the scanned directories in memory
+// and answers requests read line by line from r, writing responses to w.
+//
+//	QUERY <text>   OK <n>, then the n best matches, one per line
+//	RESCAN         OK <n>, where n is the number of directories now indexed
+//	QUIT           BYE, then the server returns
+//
+// Anything else, or a QUERY that is not a valid --regex, gets ERR <reason>.
+// scan is called once up front and again for every RESCAN; if a rescan fails
+// the previous index is kept. Reaching the end of r ends the server like
+// QUIT, without the reply.
+func runServer(r io.Reader, w io.Writer, scan func() ([]string, error), config TUIConfig, top int, format func(string) string) error {
+	directories, err := scan()
+	if err != nil {
+		return err
+	}
+	index := newQueryIndex(directories, config)
+	
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		command, arg, _ := strings.Cut(scanner.Text(), " ")
+		switch strings.ToUpper(command) {
+		case "QUERY":
+			paths := index.top(arg, top)
+			if err := index.queryErr(); err != nil {
+				fmt.Fprintf(bw, "ERR %v\n", err)
+				break
+			}
+			fmt.Fprintf(bw, "OK %d\n", len(paths))
+			for _, path := range paths {
+				fmt.Fprintln(bw, format(path))
+			}
+		case "RESCAN":
+			if directories, err := scan(); err != nil {
+				fmt.Fprintf(bw, "ERR rescan failed: %v\n", err)
+			} else {
+				index = newQueryIndex(directories, config)
+				fmt.Fprintf(bw, "OK %d\n", index.size())
+			}
+		case "QUIT":
+			fmt.Fprintln(bw, "BYE")
+			return bw.Flush()
+		case "":
+			continue
+		default:
+			fmt.Fprintf(bw, "ERR unknown command %q\n", command)
+		}
+		// Each response is complete once flushed; clients wait on it
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
\ No newline at end of file
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerProtocol(t *testing.T) {
+	scans := [][]string{
+		{"/srv/api", "/srv/web", "/home/me/notes"},
+		{"/srv/api", "/srv/api-v2", "/srv/web", "/home/me/notes"},
+	}
+	scanCount := 0
+	scan := func() ([]string, error) {
+		if scanCount >= len(scans) {
+			return nil, errors.New("disk gone")
+		}
+		scanCount++
+		return scans[scanCount-1], nil
+	}
+
+	// Drive the server over pipes like a client would, one request at a time
+	clientIn, serverIn := io.Pipe()
+	serverOut, clientOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- runServer(clientIn, clientOut, scan, TUIConfig{}, 2, func(path string) string { return path })
+		clientOut.Close()
+	}()
+	responses := bufio.NewScanner(serverOut)
+
+	request := func(line string, lines int) []string {
+		t.Helper()
+		if _, err := io.WriteString(serverIn, line+"\n"); err != nil {
+			t.Fatalf("Failed to send %q: %v", line, err)
+		}
+		var got []string
+		for i := 0; i < lines && responses.Scan(); i++ {
+			got = append(got, responses.Text())
+		}
+		return got
+	}
+
+	if got := request("QUERY api", 2); strings.Join(got, "|") != "OK 1|/srv/api" {
+		t.Errorf("QUERY api = %q", got)
+	}
+	if got := request("QUERY zzzz", 1); strings.Join(got, "|") != "OK 0" {
+		t.Errorf("QUERY without matches = %q", got)
+	}
+	if got := request("FROB", 1); len(got) != 1 || !strings.HasPrefix(got[0], "ERR unknown command") {
+		t.Errorf("Unknown command = %q", got)
+	}
+
+	// RESCAN swaps in the fresh index
+	if got := request("RESCAN", 1); strings.Join(got, "|") != "OK 4" {
+		t.Errorf("RESCAN = %q", got)
+	}
+	if got := request("QUERY api", 3); strings.Join(got, "|") != "OK 2|/srv/api|/srv/api-v2" {
+		t.Errorf("QUERY api after RESCAN = %q", got)
+	}
+
+	// A failed rescan keeps serving the previous index
+	if got := request("RESCAN", 1); len(got) != 1 || !strings.HasPrefix(got[0], "ERR rescan failed") {
+		t.Errorf("Failed RESCAN = %q", got)
+	}
+	if got := request("QUERY notes", 2); strings.Join(got, "|") != "OK 1|/home/me/notes" {
+		t.Errorf("QUERY after failed RESCAN = %q", got)
+	}
+
+	if got := request("QUIT", 1); strings.Join(got, "|") != "BYE" {
+		t.Errorf("QUIT = %q", got)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Server returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Server did not stop after QUIT")
+	}
+}
+
+func TestServerInitialScanError(t *testing.T) {
+	scan := func() ([]string, error) { return nil, errors.New("permission denied") }
+	err := runServer(strings.NewReader("QUERY x\n"), io.Discard, scan, TUIConfig{}, 1, func(path string) string { return path })
+	if err == nil {
+		t.Error("Expected the initial scan error to stop the server")
+	}
+}
+
+func TestServerInvalidRegex(t *testing.T) {
+	scan := func() ([]string, error) { return []string{"/srv/api", "/srv/web"}, nil }
+	var out strings.Builder
+	in := strings.NewReader("QUERY (api\nQUERY ^/srv/a\n")
+	if err := runServer(in, &out, scan, TUIConfig{Regex: true}, 5, func(path string) string { return path }); err != nil {
+		t.Fatalf("runServer failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ERR ") || lines[1] != "OK 1" || lines[2] != "/srv/api" {
+		t.Errorf("Unexpected responses %q", lines)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// translitTable romanizes lower-case Cyrillic, Greek and accented Latin
+// letters. Scripts such as CJK need a dictionary rather than a letter table
+// and are left as they are.
+var translitTable = map[rune]string{
+	// Cyrillic (Russian, plus Ukrainian and Belarusian letters)
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+	
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+	'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	
+	// Latin with diacritics
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'č': "c", 'ć': "c", 'ď': "d", 'è': "e", 'é': "e", 'ê': "e",
+	'ë': "e", 'ě': "e", 'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ı': "i", 'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n", 'ò': "o", 'ó': "o",
+	'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ő': "o", 'œ': "oe", 'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ù': "u", 'ú': "u",
+	'û': "u", 'ü': "u", 'ů': "u", 'ű': "u", 'ý': "y", 'ÿ': "y", 'ź': "z",
+	'ż': "z", 'ž': "z",
+}
+
+func init() {
+	// Upper-case letters romanize to the capitalized form
+	for r, latin := range translitTable {
+		upper := unicode.ToUpper(r)
+		if _, exists := translitTable[upper]; exists {
+			continue
+		}
+		if latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		translitTable[upper] = latin
+	}
+}
+
+// transliterate returns s with every letter in translitTable romanized
+func transliterate(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+	
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		if latin, ok := translitTable[r]; ok {
+			b.WriteString(latin)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTransliterate(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"/home/user/projects", "/home/user/projects"},
+		{"/проект/api", "/proekt/api"},
+		{"/Документы/Работа", "/Dokumenty/Rabota"},
+		{"/щука", "/shchuka"},
+		{"/έργα/κώδικας", "/erga/kodikas"},
+		{"/Café/Müller", "/Cafe/Muller"},
+		{"/項目/api", "/項目/api"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			if got := transliterate(tc.input); got != tc.expected {
+				t.Errorf("transliterate(%q) = %q, expected %q", tc.input, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTranslitMatching(t *testing.T) {
+	directories := []string{
+		"/home/user/проект/api",
+		"/home/user/Документы",
+		"/home/user/έργα",
+		"/home/user/plain",
+	}
+
+	testCases := []struct {
+		query    string
+		expected string
+	}{
+		{"proekt/api", "/home/user/проект/api"},
+		{"dokumenty", "/home/user/Документы"},
+		{"erga", "/home/user/έργα"},
+		{"проект", "/home/user/проект/api"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			state := &uiState{config: TUIConfig{Translit: true}}
+			state.addDirectories(directories)
+			state.query = tc.query
+			state.rematch()
+
+			if len(state.matches) == 0 {
+				t.Fatalf("No matches for %q", tc.query)
+			}
+			if state.matches[0].Str != tc.expected {
+				t.Errorf("Top match for %q = %s, expected %s", tc.query, state.matches[0].Str, tc.expected)
+			}
+		})
+	}
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		state := &uiState{}
+		state.addDirectories(directories)
+		state.query = "proekt"
+		state.rematch()
+		if len(state.matches) != 0 {
+			t.Errorf("Expected no romanized matches without --translit, got %d", len(state.matches))
+		}
+	})
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
 	"github.com/sahilm/fuzzy"
 )
 
@@ -16,8 +21,1108 @@ type uiState struct {
 	selected     int
 	scrollOffset int
 	directories  []string
+	keys         []string // Search keys parallel to directories, nil when matching paths as-is
 	matches      []fuzzy.Match
+	ranked       []fuzzy.Match // matches before postProcess, capped at MaxResults
 	scanComplete bool
+	statusMsg    string    // Transient message shown in the status bar
+	statusUntil  time.Time // When statusMsg expires
+	budgetSpent  bool      // The soft scan budget has elapsed
+	sampled      bool      // matches came from a sample, not the full list
+	matchGen     int       // Bumped on every rematch to discard stale full matches
+	fullMatch    *time.Timer
+	notify       func() // Requests a redraw from outside the event loop
+	enterPending bool   // Enter was pressed mid-scan and is waiting on the scan
+	drawn        string // Selected match in the last frame drawn, for Enter
+	committed    bool   // commitPath and commitErr hold the captured commit
+	commitPath   string // What the finder returns, captured with the key
+	commitErr    error
+	enterUntil   time.Time            // How long a pending Enter may auto-commit
+	pins         []string             // Pinned paths in pin order, kept above all matches
+	prevCount    int                  // Match count before the last query edit, -1 before any
+	modTimes     map[string]time.Time // Captured mtimes by path, for HighlightRecent
+	autoAt       time.Time            // When the single match auto-selects; zero when not armed
+	autoStop     chan struct{}        // Stops the countdown ticker
+	autoDeclined string               // Query whose auto-select a keypress cancelled
+	locked       string               // Primary filter locked with Tab; query refines it
+	repos        map[string]bool      // Git repository roots seen by the scan
+	children     map[string]int       // Listed subdirectories per directory, for CollapseChains
+	cached       matchCache           // Full match results by query for the current directories
+	removed      map[string]bool      // Paths dismissed with Ctrl+X for this session
+	hiddenAbove  map[string]bool      // Ancestors of the selection hidden with Ctrl+A, nil when shown
+	depth        int                  // Scan depth reached so far, for Deepen
+	scanCtx      context.Context      // Cancels scans started from the TUI
+	iconTypes    iconCache            // Directory types detected for Icons
+	writeModes   writeCache           // Read-only directories seen, for DimReadOnly
+	crumbFor     string               // Selection the breadcrumb cursor was moved on
+	crumbUp      int                  // Segments above crumbFor picked with ←
+	preview      *previewer           // Runs PreviewCmd, nil when unset
+	localEmpty   bool                 // The starting directory had no directories
+	local        map[string]bool      // Directories from the local scan phase, for sortInterleave
+	groupCounts  map[string]int       // Matches per group header, for GroupCounts
+	scanGen      int                  // Bumped by every reload; older scans are dropped
+	reloadStop   context.CancelFunc   // Cancels the scan started by the last reload
+	palette      *palette             // Open Ctrl+P palette, nil when closed
+	regexErr     error                // Why the query is not a valid regexp, with Regex
+	targets      map[string]string    // Where symlinked directories resolve to, for MatchTargets
+	ignored      int                  // Directories the scan skipped by ignore rules, for ShowIgnored
+	config       TUIConfig
+}
+
+// TUIConfig holds presentation options for the interactive finder
+type TUIConfig struct {
+	Compact bool // Drop the spacer rows to fit more results
+	// Borders replaces the spacer rows with rules directly below the prompt
+	// and above the status bar
+	Borders bool
+	Reverse bool // Prompt at the bottom, results growing upwards from it
+	// ScanBudget is a soft deadline: once it passes, an unfinished scan keeps
+	// running but is presented as background work rather than something to
+	// wait for. Zero disables it.
+	ScanBudget time.Duration
+	// SampleThreshold is the directory count above which keystrokes match a
+	// sample of at most that many directories, with the full match deferred
+	// until typing pauses. Zero disables sampling.
+	SampleThreshold int
+	// WaitForScan makes Enter on a query hold off while the scan is still
+	// running: the selection commits if the scan finishes within
+	// scanWaitGrace, and a second Enter forces it.
+	WaitForScan bool
+	// Translit matches against romanized paths (and queries), so a Cyrillic
+	// or Greek directory can be found by typing Latin letters
+	Translit bool
+	// IgnoreSegments lists path components left out of the matched text,
+	// e.g. src or internal; the displayed and selected paths keep them
+	IgnoreSegments map[string]bool
+	// MaxResults caps the match list at the best N; zero means unlimited
+	MaxResults int
+	// CountHint shows the live match count next to the prompt, along with
+	// how it changed since the last query edit
+	CountHint bool
+	// HighlightRecent marks directories modified within this window; zero
+	// disables it
+	HighlightRecent time.Duration
+	// AgeColors grades result lines by modification age: brightest within
+	// the first threshold, a step dimmer past each later one. Nil disables it.
+	AgeColors []time.Duration
+	// AutoSelect commits a lone match this long after the scan completes,
+	// counting down in the status bar; any key cancels. Zero disables it.
+	AutoSelect time.Duration
+	// Group lists matches under headers for their top-level directory below
+	// Root (or below / for matches outside it)
+	Group bool
+	Root  string
+	// GroupCounts adds the number of matches in each group to its header
+	GroupCounts bool
+	// MaxPerPrefix keeps at most this many matches under each prefix of
+	// PrefixDepth components below Root, for a more varied list; zero
+	// keeps everything
+	MaxPerPrefix int
+	PrefixDepth  int
+	// Regex matches the query as a Go regular expression instead of fuzzily;
+	// an invalid one matches nothing and is reported in the status bar
+	Regex bool
+	// PreferRepos ranks git repository roots above other directories with
+	// the same score
+	PreferRepos bool
+	// ReposOnly hides every directory that is not a git repository root
+	ReposOnly bool
+	// CollapseChains hides directories whose only listed subdirectory is a
+	// single child, so a linear chain like a/b/c/d shows as its endpoint
+	CollapseChains bool
+	// EmptyMessage replaces the guidance shown when a finished scan found no
+	// directories at all; lines are separated by newlines
+	EmptyMessage string
+	// Deepen, when set, lets Ctrl+D rescan to one level beyond Depth. It
+	// must only yield directories at exactly that depth, as everything
+	// shallower is already listed.
+	Deepen func(ctx context.Context, depth int) <-chan DirBatch
+	Depth  int
+	// DepthBase is added to Depth when showing it, so the status bar counts
+	// levels the way --depth does (see scanMaxDepth)
+	DepthBase int
+	// FocusScan, when set, lets Ctrl+F scan below the selected directory
+	// past the depth limit; descendants already listed are dropped
+	FocusScan func(ctx context.Context, root string) <-chan DirBatch
+	// Reload, when set, lets Ctrl+R re-read the ignore sources and start a
+	// fresh scan with them (or without any when useIgnore is false),
+	// returning it with the number of patterns loaded
+	Reload func(ctx context.Context, useIgnore bool) (<-chan DirBatch, int, error)
+	// ExportPath, when set, is where Ctrl+E writes the current matches, one
+	// absolute path per line
+	ExportPath string
+	// NoIgnore records that the scan runs without ignore rules; the palette
+	// toggles it and rescans
+	NoIgnore bool
+	// InitialQuery is typed into the prompt before the first frame
+	InitialQuery string
+	// PromptLabel replaces cdf in front of the prompt, e.g. root for the
+	// --pick-root picker
+	PromptLabel string
+	// OnExit receives the directory list, query and any captured
+	// modification times when the finder closes after a completed scan
+	OnExit func(directories []string, query string, modTimes map[string]time.Time)
+	// EscapeMode is what Escape does: escapeCancel quits right away,
+	// escapeClearThenCancel first clears a non-empty query
+	EscapeMode string
+	// Icons, when set, prefixes each match with the icon for its directory
+	// type (see detectProjectType); "dir" is used for plain directories
+	Icons map[string]string
+	// DimReadOnly greys out the rows of directories the current user can't
+	// write to (see readOnlyDir)
+	DimReadOnly bool
+	// Algo is algoFuzzy (the default) or algoInitials, which ranks matches
+	// whose component initials spell the query first
+	Algo string
+	// BrowseOrder arranges the matches while the query is empty: browseWalk
+	// (the default), browseAlpha, browseDepth, browseFrecency, which uses
+	// Frecency, or browseShuffle, which uses ShuffleSeed
+	BrowseOrder string
+	ShuffleSeed int64
+	// SortMode orders the matches: sortScore (the default), sortLength or
+	// sortInterleave
+	SortMode string
+	// Frecency scores directories from the selection history (see
+	// frecency); each match's score gains FrecencyWeight times its
+	// frecency when ranking. A zero weight leaves the order unchanged.
+	Frecency       map[string]float64
+	FrecencyWeight float64
+	// TailWeight boosts query matches within the last TailWeight segments
+	// of a path over matches in its ancestors (see weightTail); zero
+	// ranks every segment alike
+	TailWeight int
+	// LocalOnly means the scan covers only Root, so an empty scan is
+	// explained in terms of Root rather than the whole filesystem
+	LocalOnly bool
+	// PreviewCmd is a shell command run for the selected directory, with {}
+	// replaced by its quoted path; its output fills a pane beside the results
+	PreviewCmd string
+	// PreviewLines caps the preview at this many lines; the command is
+	// stopped once more arrive. Zero means no cap beyond previewMaxBytes.
+	PreviewLines int
+	// PreviewDebounce is how long the selection must stay put before its
+	// preview runs, so fast scrolling doesn't start a command per row. Zero
+	// runs it as soon as the selection changes.
+	PreviewDebounce time.Duration
+	// AcceptQuery makes Enter with no matches select the query itself when
+	// it names an existing directory
+	AcceptQuery bool
+	// MatchTargets also matches symlinked directories by the path they
+	// resolve to; they are still shown and returned by their own path
+	MatchTargets bool
+	// MatchAbbrev also matches each directory by its abbreviated form, the
+	// first letter of every component (~/p/w/s for ~/projects/webapp/src)
+	MatchAbbrev bool
+	// ShowIgnored adds how many directories the ignore rules skipped to the
+	// status bar, as a hint that --no-ignore might find what is missing
+	ShowIgnored bool
+	// Aliases labels directories by path; a label is matched along with
+	// the path and shown in its place
+	Aliases map[string]string
+	// Breadcrumb shows the selection's path as segments on a row of its own
+	// below the results; ←/→ pick one, which Enter and Ctrl+F then use
+	// in place of the selection
+	Breadcrumb bool
+	// NumberSelect numbers the first nine visible results; Alt+1 to Alt+9
+	// select the result with that number at once, while plain digits keep
+	// typing into the query
+	NumberSelect bool
+}
+
+// usesSearchKeys reports whether directories are matched through search keys
+// rather than as-is
+func (c TUIConfig) usesSearchKeys() bool {
+	return c.Translit || len(c.IgnoreSegments) > 0 || c.MatchTargets || len(c.Aliases) > 0 || c.MatchAbbrev
+}
+
+// searchKey returns the text matched for path
+func (c TUIConfig) searchKey(path string) string {
+	key := path
+	if len(c.IgnoreSegments) > 0 {
+		key = withoutSegments(key, c.IgnoreSegments)
+	}
+	if c.MatchAbbrev {
+		// In front, so the tail of the key is still the path's (see tailBoost)
+		key = abbreviatePath(path, homeDir()) + " " + key
+	}
+	if label := c.Aliases[path]; label != "" {
+		key = label + " " + key
+	}
+	if c.Translit {
+		key = transliterate(key)
+	}
+	return key
+}
+
+// searchQuery normalizes the typed query the same way as searchKey
+func (c TUIConfig) searchQuery(query string) string {
+	if c.Translit {
+		query = transliterate(query)
+	}
+	return query
+}
+
+// Escape key behaviours for TUIConfig.EscapeMode
+const (
+	escapeCancel          = "cancel"
+	escapeClearThenCancel = "clear-then-cancel"
+)
+
+// scanWaitGrace is how long a pending Enter waits for the scan to finish
+const scanWaitGrace = time.Second
+
+// fullMatchDelay is the typing pause after which a sampled match is replaced
+// by a full one
+const fullMatchDelay = 150 * time.Millisecond
+
+// screenLayout describes which rows of the screen hold each part of the UI
+type screenLayout struct {
+	PromptY       int  // Row of the prompt
+	PromptDivider int  // Row of the divider between prompt and results
+	ResultsY      int  // Top row of the result area
+	MaxDisplay    int  // Number of result rows
+	StatusDivider int  // Row of the divider between results and status bar, or -1
+	StatusY       int  // Row of the status bar
+	Reverse       bool // Results are listed bottom-up from the prompt
+	BreadcrumbY   int  // Row of the breadcrumb bar, or -1
+}
+
+// computeLayout is the single source of truth for the vertical layout, shared
+// by the renderer and the scroll math in the key handlers
+func computeLayout(height int, config TUIConfig) screenLayout {
+	var layout screenLayout
+	if config.Borders {
+		// prompt, rule, results..., rule, status
+		layout = screenLayout{
+			PromptY:       0,
+			PromptDivider: 1,
+			ResultsY:      2,
+			MaxDisplay:    height - 4,
+			StatusDivider: height - 2,
+			StatusY:       height - 1,
+		}
+	} else if config.Compact {
+		// prompt, divider, results..., status
+		layout = screenLayout{
+			PromptY:       0,
+			PromptDivider: 1,
+			ResultsY:      2,
+			MaxDisplay:    height - 3,
+			StatusDivider: -1,
+			StatusY:       height - 1,
+		}
+	} else {
+		// prompt, spacer, divider, spacer, results..., divider, status, spacer
+		layout = screenLayout{
+			PromptY:       0,
+			PromptDivider: 2,
+			ResultsY:      4,
+			MaxDisplay:    height - 7,
+			StatusDivider: height - 3,
+			StatusY:       height - 2,
+		}
+	}
+	
+	layout.BreadcrumbY = -1
+	if config.Breadcrumb {
+		// Taken from the bottom of the result area
+		layout.MaxDisplay--
+		layout.BreadcrumbY = layout.ResultsY + layout.MaxDisplay
+	}
+	
+	if config.Reverse {
+		// Mirror every row so the prompt sits at the bottom
+		mirror := func(y int) int { return height - 1 - y }
+		layout.PromptY = mirror(layout.PromptY)
+		layout.PromptDivider = mirror(layout.PromptDivider)
+		layout.ResultsY = mirror(layout.ResultsY + layout.MaxDisplay - 1)
+		if layout.StatusDivider >= 0 {
+			layout.StatusDivider = mirror(layout.StatusDivider)
+		}
+		layout.StatusY = mirror(layout.StatusY)
+		if layout.BreadcrumbY >= 0 {
+			layout.BreadcrumbY = mirror(layout.BreadcrumbY)
+		}
+		layout.Reverse = true
+	}
+	return layout
+}
+
+// ResultRow returns the screen row for the displayIndex-th visible result.
+// In reverse mode the best match sits on the row closest to the prompt.
+func (l screenLayout) ResultRow(displayIndex int) int {
+	if l.Reverse {
+		return l.ResultsY + l.MaxDisplay - 1 - displayIndex
+	}
+	return l.ResultsY + displayIndex
+}
+
+// defaultEmptyMessage is shown in the result area when the scan completes
+// without discovering a single directory
+const defaultEmptyMessage = `📭 No directories found
+• Check that the starting path is the one you meant
+• Try --no-ignore in case ignore patterns hid everything
+• Try a larger --depth to look further down`
+
+// localEmptyMessage replaces defaultEmptyMessage when only the starting
+// directory was scanned
+const localEmptyMessage = `📭 No directories below the starting path
+• It has no subdirectories, or ignore patterns hid them all
+• Try --no-ignore to include ignored directories
+• Drop --local to search the rest of the filesystem too`
+
+// statusMessageDuration is how long transient status messages stay visible
+const statusMessageDuration = 2 * time.Second
+
+// displayView is a snapshot of everything updateDisplayAsync needs to draw a frame
+type displayView struct {
+	Matches      []fuzzy.Match
+	Query        string
+	Selected     int
+	ScrollOffset int
+	TotalDirs    int
+	ScanComplete bool
+	StatusMsg    string
+	Config       TUIConfig
+	Pinned       map[string]bool
+	BudgetSpent  bool
+	Sampled      bool
+	PrevCount    int // Match count before the last query edit, -1 if unknown
+	ModTimes     map[string]time.Time
+	Now          time.Time // Reference time for HighlightRecent
+	AutoAt       time.Time // When the lone match auto-selects, zero if not armed
+	Locked       string
+	Depth        int // Current scan depth, shown when it can be deepened
+	IconTypes    *iconCache
+	WriteModes   *writeCache
+	Preview      string // PreviewCmd output for the selection
+	LocalEmpty   bool   // The local phase found nothing; matches are global
+	GroupCounts  map[string]int
+	Palette      []string // Ctrl+P palette entries, nil when closed
+	PaletteIndex int      // Highlighted palette entry
+	Ignored      int      // Directories skipped by ignore rules so far
+	CrumbUp      int      // Breadcrumb segments above the selection picked
+}
+
+// view snapshots the state for rendering; the caller must hold at least a read lock
+func (s *uiState) view() displayView {
+	v := displayView{
+		Matches:      s.matches,
+		Query:        s.query,
+		Selected:     s.selected,
+		ScrollOffset: s.scrollOffset,
+		TotalDirs:    len(s.directories),
+		ScanComplete: s.scanComplete,
+		Config:       s.config,
+		Pinned:       make(map[string]bool, len(s.pins)),
+		BudgetSpent:  s.budgetSpent,
+		Sampled:      s.sampled,
+		PrevCount:    s.prevCount,
+		ModTimes:     s.modTimes,
+		Now:          time.Now(),
+		AutoAt:       s.autoAt,
+		Locked:       s.locked,
+		Depth:        s.depth,
+		IconTypes:    &s.iconTypes,
+		WriteModes:   &s.writeModes,
+		LocalEmpty:   s.localEmpty,
+		GroupCounts:  s.groupCounts,
+		Ignored:      s.ignored,
+		CrumbUp:      s.activeCrumbUp(),
+	}
+	for _, pin := range s.pins {
+		v.Pinned[pin] = true
+	}
+	if s.preview != nil {
+		v.Preview = s.preview.text()
+	}
+	if s.palette != nil {
+		v.Palette = s.palette.lines(s)
+		v.PaletteIndex = s.palette.selected
+	}
+	if s.statusMsg != "" && time.Now().Before(s.statusUntil) {
+		v.StatusMsg = s.statusMsg
+	} else if s.regexErr != nil {
+		v.StatusMsg = "  ✗ " + s.regexErr.Error()
+	}
+	return v
+}
+
+// startScanBudget flips budgetSpent once the soft scan budget elapses and calls
+// notify so the screen can redraw. It returns nil when no budget is set.
+func (s *uiState) startScanBudget(budget time.Duration, notify func()) *time.Timer {
+	if budget <= 0 {
+		return nil
+	}
+	return time.AfterFunc(budget, func() {
+		s.mu.Lock()
+		s.budgetSpent = true
+		s.mu.Unlock()
+		notify()
+	})
+}
+
+// rematch recomputes matches for the current query; the caller must hold the
+// write lock. Above the sample threshold it matches a bounded sample so each
+// keystroke stays fast, and schedules a full match for when typing pauses.
+func (s *uiState) rematch() {
+	s.matchGen++
+	if s.fullMatch != nil {
+		s.fullMatch.Stop()
+	}
+	
+	query := s.config.searchQuery(s.query)
+	s.regexErr = nil
+	if s.locked != "" {
+		// The locked term filters, the live query refines within it
+		primary := s.matchKeys(s.config.searchQuery(s.locked), s.directories, s.keys)
+		if s.config.Regex {
+			refined, err := regexRefine(query, primary, s.directories, s.keys)
+			s.noteRegexErr(err)
+			s.setRanked(refined)
+		} else {
+			s.setRanked(refineMatches(query, primary, s.directories, s.keys))
+		}
+		s.sampled = false
+		return
+	}
+	
+	// A regexp is cheap enough to run in full on every keystroke
+	threshold := s.config.SampleThreshold
+	if threshold <= 0 || len(s.directories) <= threshold || s.config.Regex {
+		s.setRanked(s.fullMatches(query))
+		s.sampled = false
+		return
+	}
+	
+	// A full match already finished for this query needs no sample
+	if matches, ok := s.cached.get(query); ok {
+		s.setRanked(matches)
+		s.sampled = false
+		return
+	}
+	s.setRanked(sampledMatch(query, s.directories, s.keys, s.ranked, threshold))
+	s.sampled = true
+	
+	gen, directories, keys := s.matchGen, s.directories, s.keys
+	s.fullMatch = time.AfterFunc(fullMatchDelay, func() {
+		// directories and keys are append-only, so these snapshots are safe
+		// to read unlocked
+		matches := matchKeys(query, directories, keys)
+		
+		s.mu.Lock()
+		if s.matchGen != gen {
+			// The query or directory list changed while we were matching
+			s.mu.Unlock()
+			return
+		}
+		s.cached.put(query, matches)
+		s.setRanked(matches)
+		s.sampled = false
+		if s.selected >= len(s.matches) {
+			s.selected = 0
+			s.scrollOffset = 0
+		}
+		s.mu.Unlock()
+		
+		if s.notify != nil {
+			s.notify()
+		}
+	})
+}
+
+// setRanked stores a fresh ranking, applying the result cap and postProcess;
+// the caller must hold the write lock
+func (s *uiState) setRanked(matches []fuzzy.Match) {
+	matches = s.withoutRemoved(matches)
+	if s.config.MaxResults > 0 {
+		matches = keepTopMatches(nil, matches, s.config.MaxResults)
+	}
+	s.ranked = matches
+	s.matches = s.postProcess(matches)
+}
+
+// ingest adds a scanned batch and brings the matches up to date; the caller
+// must hold the write lock
+func (s *uiState) ingest(dirs []string) {
+	start := len(s.directories)
+	s.addDirectories(dirs)
+	
+	if s.config.MaxResults <= 0 || s.sampled || s.locked != "" {
+		s.rematch()
+		return
+	}
+	
+	// With a cap only the new directories need matching: merging them into
+	// the retained top N keeps the globally best N seen so far
+	var keys []string
+	if s.keys != nil {
+		keys = s.keys[start:]
+	}
+	fresh := s.matchKeys(s.config.searchQuery(s.query), s.directories[start:], keys)
+	for i := range fresh {
+		fresh[i].Index += start
+	}
+	s.ranked = keepTopMatches(s.ranked, s.withoutRemoved(fresh), s.config.MaxResults)
+	s.matches = s.postProcess(s.ranked)
+}
+
+// matchAll runs the full matches fullMatches doesn't find in the cache;
+// tests replace it to count them
+var matchAll = matchKeys
+
+// fullMatches matches query against every directory, answering repeated
+// queries from the cache; the caller must hold the write lock
+func (s *uiState) fullMatches(query string) []fuzzy.Match {
+	if s.config.Regex {
+		// Matching again reports the compile error for this query
+		return s.matchKeys(query, s.directories, s.keys)
+	}
+	if matches, ok := s.cached.get(query); ok {
+		return matches
+	}
+	matches := matchAll(query, s.directories, s.keys)
+	s.cached.put(query, matches)
+	return matches
+}
+
+// matchKeys matches the way the session is configured: regexMatch with
+// Regex, the package-level matchKeys otherwise; the caller must hold the
+// write lock
+func (s *uiState) matchKeys(query string, directories, keys []string) []fuzzy.Match {
+	if !s.config.Regex {
+		return matchKeys(query, directories, keys)
+	}
+	matches, err := regexMatch(query, directories, keys)
+	s.noteRegexErr(err)
+	return matches
+}
+
+// noteRegexErr keeps the first regexp compile error for the status bar; the
+// caller must hold the write lock
+func (s *uiState) noteRegexErr(err error) {
+	if err != nil && s.regexErr == nil {
+		s.regexErr = err
+	}
+}
+
+// withoutRemoved filters out dismissed paths and hidden ancestors; the
+// caller must hold a lock
+func (s *uiState) withoutRemoved(matches []fuzzy.Match) []fuzzy.Match {
+	if len(s.removed) == 0 && len(s.hiddenAbove) == 0 {
+		return matches
+	}
+	kept := make([]fuzzy.Match, 0, len(matches))
+	for _, match := range matches {
+		if !s.removed[match.Str] && !s.hiddenAbove[match.Str] {
+			kept = append(kept, match)
+		}
+	}
+	return kept
+}
+
+// remove dismisses path for the rest of the session, unpinning it if needed,
+// and keeps the selection in range; the caller must hold the write lock
+func (s *uiState) remove(path string) {
+	if s.removed == nil {
+		s.removed = make(map[string]bool)
+	}
+	s.removed[path] = true
+	for i, pin := range s.pins {
+		if pin == path {
+			s.pins = append(s.pins[:i], s.pins[i+1:]...)
+			break
+		}
+	}
+	
+	s.ranked = s.withoutRemoved(s.ranked)
+	s.matches = s.postProcess(s.ranked)
+	if s.selected >= len(s.matches) {
+		s.selected = len(s.matches) - 1
+	}
+	if s.selected < 0 {
+		s.selected = 0
+	}
+	if s.scrollOffset > s.selected {
+		s.scrollOffset = s.selected
+	}
+}
+
+// toggleAncestors hides the strict ancestors of path from the matches, or
+// shows them again if some are hidden, keeping path selected. Siblings and
+// descendants stay listed, as do pinned ancestors. It reports whether
+// ancestors are now hidden; the caller must hold the write lock.
+func (s *uiState) toggleAncestors(path string) bool {
+	if s.hiddenAbove != nil {
+		s.hiddenAbove = nil
+		s.rematch()
+	} else {
+		s.hiddenAbove = ancestorPaths(path)
+		s.ranked = s.withoutRemoved(s.ranked)
+		s.matches = s.postProcess(s.ranked)
+	}
+	
+	s.selected = 0
+	for i, match := range s.matches {
+		if match.Str == path {
+			s.selected = i
+			break
+		}
+	}
+	if s.scrollOffset > s.selected {
+		s.scrollOffset = s.selected
+	}
+	return s.hiddenAbove != nil
+}
+
+// consume applies a scanned batch to the state; the caller must hold the
+// write lock
+func (s *uiState) consume(batch DirBatch) {
+	s.ignored += batch.Ignored
+	
+	// Append new directories
+	if len(batch.Repos) > 0 {
+		s.recordRepos(batch.Repos)
+	}
+	if len(batch.Directories) > 0 {
+		if s.config.SortMode == sortInterleave && !batch.Global {
+			s.recordLocal(batch.Directories)
+		}
+		s.recordModTimes(batch)
+		s.recordTargets(batch.Targets)
+		s.ingest(batch.Directories)
+	} else if len(batch.Repos) > 0 {
+		s.matches = s.postProcess(s.ranked)
+	}
+	
+	if batch.LocalEmpty {
+		s.localEmpty = true
+	}
+	s.scanComplete = batch.Done
+}
+
+// recordLocal remembers dirs as found by the local phase; the caller must
+// hold the write lock
+func (s *uiState) recordLocal(dirs []string) {
+	if s.local == nil {
+		s.local = make(map[string]bool, len(dirs))
+	}
+	for _, dir := range dirs {
+		s.local[dir] = true
+	}
+}
+
+// deepen scans one level deeper than before and merges the new directories
+// in the background; the caller must hold the write lock
+func (s *uiState) deepen() {
+	s.depth++
+	s.scanComplete = false
+	batches := s.config.Deepen(s.scanCtx, s.depth)
+	gen := s.scanGen
+	go func() {
+		for batch := range batches {
+			s.mu.Lock()
+			if s.scanGen != gen {
+				// A reload started over
+				s.mu.Unlock()
+				return
+			}
+			// The first scan alone decides whether the start had directories
+			batch.LocalEmpty = false
+			s.consume(batch)
+			s.mu.Unlock()
+			if s.notify != nil {
+				s.notify()
+			}
+		}
+	}()
+}
+
+// activeCrumbUp returns how many breadcrumb segments above the selection are
+// picked: none once the selection has moved on; the caller must hold a lock
+func (s *uiState) activeCrumbUp() int {
+	if s.selected < 0 || s.selected >= len(s.matches) || s.matches[s.selected].Str != s.crumbFor {
+		return 0
+	}
+	return s.crumbUp
+}
+
+// moveCrumb moves the breadcrumb cursor delta segments towards the selection
+// (positive) or the root (negative), within the selection's path; the
+// caller must hold the write lock
+func (s *uiState) moveCrumb(delta int) {
+	if s.selected < 0 || s.selected >= len(s.matches) {
+		return
+	}
+	path := s.matches[s.selected].Str
+	up := s.activeCrumbUp() - delta
+	if top := len(breadcrumb(path, homeDir())) - 1; up > top {
+		up = top
+	}
+	if up < 0 {
+		up = 0
+	}
+	s.crumbFor, s.crumbUp = path, up
+}
+
+// pickedPath returns the directory Enter and Ctrl+F act on: the selection, or
+// the breadcrumb segment picked above it; the caller must hold a lock
+func (s *uiState) pickedPath() (string, bool) {
+	if s.selected < 0 || s.selected >= len(s.matches) {
+		return "", false
+	}
+	path := s.matches[s.selected].Str
+	if up := s.activeCrumbUp(); up > 0 {
+		crumbs := breadcrumb(path, homeDir())
+		path = crumbs[len(crumbs)-1-up].Path
+	}
+	return path, true
+}
+
+// focusScan scans below the selected directory and merges the descendants not
+// listed yet in the background, returning the directory scanned; the caller
+// must hold the write lock
+func (s *uiState) focusScan() (string, bool) {
+	root, ok := s.pickedPath()
+	if !ok {
+		return "", false
+	}
+	seen := make(map[string]bool)
+	for _, dir := range s.directories {
+		if isWithinPath(dir, root) {
+			seen[dir] = true
+		}
+	}
+	s.scanComplete = false
+	batches := s.config.FocusScan(s.scanCtx, root)
+	gen := s.scanGen
+	go func() {
+		for batch := range batches {
+			batch = dropSeen(batch, seen)
+			s.mu.Lock()
+			if s.scanGen != gen {
+				s.mu.Unlock()
+				return
+			}
+			s.consume(batch)
+			s.mu.Unlock()
+			if s.notify != nil {
+				s.notify()
+			}
+		}
+	}()
+	return root, true
+}
+
+// dropSeen removes the directories in seen from batch, along with their
+// modification times, and adds the rest to seen
+func dropSeen(batch DirBatch, seen map[string]bool) DirBatch {
+	var dirs []string
+	var modTimes []time.Time
+	for i, dir := range batch.Directories {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+		if i < len(batch.ModTimes) {
+			modTimes = append(modTimes, batch.ModTimes[i])
+		}
+	}
+	batch.Directories, batch.ModTimes = dirs, modTimes
+	return batch
+}
+
+// reload re-reads the ignore sources and replaces the directory list with a
+// fresh scan using them; the caller must hold the write lock
+func (s *uiState) reload() (int, error) {
+	ctx, cancel := context.WithCancel(s.scanCtx)
+	batches, count, err := s.config.Reload(ctx, !s.config.NoIgnore)
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+	if s.reloadStop != nil {
+		s.reloadStop()
+	}
+	s.reloadStop = cancel
+	s.scanGen++
+	gen := s.scanGen
+	
+	s.directories, s.keys = nil, nil
+	s.cached.reset()
+	s.modTimes, s.repos, s.local, s.targets = nil, nil, nil, nil
+	s.children = nil
+	s.localEmpty = false
+	s.ignored = 0
+	s.scanComplete = false
+	s.depth = s.config.Depth
+	s.rematch()
+	s.selected, s.scrollOffset = 0, 0
+	
+	go func() {
+		for batch := range batches {
+			s.mu.Lock()
+			if s.scanGen != gen {
+				s.mu.Unlock()
+				return
+			}
+			s.consume(batch)
+			s.mu.Unlock()
+			if s.notify != nil {
+				s.notify()
+			}
+		}
+	}()
+	return count, nil
+}
+
+// recordModTimes remembers the modification times captured with a batch; the
+// caller must hold the write lock
+func (s *uiState) recordModTimes(batch DirBatch) {
+	if len(batch.ModTimes) == 0 {
+		return
+	}
+	if s.modTimes == nil {
+		s.modTimes = make(map[string]time.Time)
+	}
+	for i, modTime := range batch.ModTimes {
+		if i < len(batch.Directories) && !modTime.IsZero() {
+			s.modTimes[batch.Directories[i]] = modTime
+		}
+	}
+}
+
+// recordTargets remembers where a batch's symlinked directories resolve to;
+// the caller must hold the write lock
+func (s *uiState) recordTargets(targets map[string]string) {
+	if !s.config.MatchTargets || len(targets) == 0 {
+		return
+	}
+	if s.targets == nil {
+		s.targets = make(map[string]string)
+	}
+	for path, target := range targets {
+		s.targets[path] = target
+	}
+}
+
+// recordRepos remembers repository roots found by the scan; the caller must
+// hold the write lock
+func (s *uiState) recordRepos(repos []string) {
+	if s.repos == nil {
+		s.repos = make(map[string]bool)
+	}
+	for _, repo := range repos {
+		s.repos[repo] = true
+	}
+}
+
+// recordChildren counts dirs under their parents, for collapseChains; the
+// caller must hold the write lock
+func (s *uiState) recordChildren(dirs []string) {
+	if s.children == nil {
+		s.children = make(map[string]int)
+	}
+	for _, dir := range dirs {
+		s.children[filepath.Dir(dir)]++
+	}
+}
+
+// addDirectories appends newly discovered directories along with their
+// search keys; the caller must hold the write lock
+func (s *uiState) addDirectories(dirs []string) {
+	s.directories = append(s.directories, dirs...)
+	s.cached.reset()
+	if s.config.CollapseChains {
+		s.recordChildren(dirs)
+	}
+	if s.config.usesSearchKeys() {
+		for _, dir := range dirs {
+			key := s.config.searchKey(dir)
+			if target, ok := s.targets[dir]; ok {
+				// Either name finds it
+				key += " " + s.config.searchKey(target)
+			}
+			s.keys = append(s.keys, key)
+		}
+	}
+}
+
+// postProcess applies the session's ranking adjustments to a fresh match list;
+// the caller must hold the write lock
+func (s *uiState) postProcess(matches []fuzzy.Match) []fuzzy.Match {
+	browsing := s.query == "" && s.locked == ""
+	if browsing {
+		matches = browseOrder(matches, s.config.BrowseOrder, s.config.Frecency, s.config.ShuffleSeed)
+	}
+	// First, as it changes the scores the later steps sort by
+	if !browsing {
+		matches = weightTail(matches, s.directories, s.keys, s.config.TailWeight)
+	}
+	if s.config.ReposOnly {
+		matches = onlyRepos(matches, s.repos)
+	}
+	if s.config.CollapseChains {
+		matches = collapseChains(matches, s.children)
+	}
+	if s.config.PreferRepos {
+		matches = preferRepos(matches, s.repos)
+	}
+	// After preferRepos, which re-sorts by plain score; ties keep its order.
+	// While browsing, BrowseOrder alone decides where history counts.
+	if !browsing {
+		matches = blendFrecency(matches, s.config.Frecency, s.config.FrecencyWeight)
+	}
+	if !browsing && s.config.Algo == algoInitials {
+		query := s.query
+		if query == "" {
+			query = s.locked
+		}
+		matches = rankInitials(matches, s.config.searchQuery(query))
+	}
+	matches = sortMatches(matches, s.config.SortMode, s.local)
+	// After sorting, so each prefix keeps the matches listed first
+	matches = capPerPrefix(matches, s.config.Root, s.config.PrefixDepth, s.config.MaxPerPrefix)
+	if s.config.Group {
+		matches = groupMatches(matches, s.config.Root)
+	}
+	matches = pinMatches(matches, s.pins, s.directories)
+	if s.config.Group && s.config.GroupCounts {
+		pinned := make(map[string]bool, len(s.pins))
+		for _, pin := range s.pins {
+			pinned[pin] = true
+		}
+		s.groupCounts = countGroups(matches, s.config.Root, pinned)
+	}
+	return matches
+}
+
+// togglePin pins or unpins path and re-ranks; the caller must hold the write lock
+func (s *uiState) togglePin(path string) bool {
+	for i, pin := range s.pins {
+		if pin == path {
+			s.pins = append(s.pins[:i], s.pins[i+1:]...)
+			s.rematch()
+			return false
+		}
+	}
+	s.pins = append(s.pins, path)
+	s.rematch()
+	return true
+}
+
+// pendingEnterReady reports whether a pending Enter should now commit because
+// the scan finished within the grace period; the caller must hold a lock
+func (s *uiState) pendingEnterReady() bool {
+	return s.enterPending && s.scanComplete && time.Now().Before(s.enterUntil)
+}
+
+// autoSelectTick is how often the auto-select countdown redraws
+const autoSelectTick = 250 * time.Millisecond
+
+// checkAutoSelect arms the auto-select countdown once the finished scan leaves
+// a single match for the query, and disarms it when that stops being true;
+// the caller must hold the write lock
+func (s *uiState) checkAutoSelect() {
+	if s.config.AutoSelect <= 0 {
+		return
+	}
+	single := s.scanComplete && s.query != "" && len(s.matches) == 1 && s.query != s.autoDeclined
+	if !single {
+		s.cancelAutoSelect()
+		return
+	}
+	if !s.autoAt.IsZero() {
+		return
+	}
+	
+	s.autoAt = time.Now().Add(s.config.AutoSelect)
+	stop := make(chan struct{})
+	s.autoStop = stop
+	if s.notify == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(autoSelectTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.notify()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// cancelAutoSelect disarms a running countdown; the caller must hold the write lock
+func (s *uiState) cancelAutoSelect() {
+	if s.autoStop != nil {
+		close(s.autoStop)
+		s.autoStop = nil
+	}
+	s.autoAt = time.Time{}
+}
+
+// autoSelectDue reports whether the countdown has run out; the caller must
+// hold a lock
+func (s *uiState) autoSelectDue() bool {
+	return !s.autoAt.IsZero() && !time.Now().Before(s.autoAt)
+}
+
+// captureCommit fixes what the finder returns while the write lock is still
+// held, so a batch arriving before commitSelection cannot change it. With
+// asDrawn, a selection that batches moved since the last frame is found again
+// by path: Enter commits the row the user saw highlighted.
+func (s *uiState) captureCommit(asDrawn bool) {
+	if asDrawn && s.drawn != "" && (s.selected < 0 || s.selected >= len(s.matches) || s.matches[s.selected].Str != s.drawn) {
+		for i, match := range s.matches {
+			if match.Str == s.drawn {
+				s.selected = i
+				break
+			}
+		}
+	}
+	s.commitPath, s.commitErr = s.selection()
+	s.committed = true
+}
+
+// commitSelection returns the selected path, or ErrCancelled when nothing is
+// selected
+func (s *uiState) commitSelection() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	
+	if s.committed {
+		return s.commitPath, s.commitErr
+	}
+	return s.selection()
+}
+
+// selection returns the path Enter selects now, or ErrCancelled when there is
+// none; the caller must hold a lock
+func (s *uiState) selection() (string, error) {
+	if path, ok := s.pickedPath(); ok {
+		return path, nil
+	}
+	if s.config.AcceptQuery && len(s.matches) == 0 {
+		if path, ok := typedDirectory(s.query); ok {
+			return path, nil
+		}
+	}
+	return "", ErrCancelled
+}
+
+// setStatus shows msg in the status bar for statusMessageDuration and schedules
+// a redraw to clear it; the caller must hold the write lock
+func (s *uiState) setStatus(msg string, screen tcell.Screen) {
+	s.statusMsg = msg
+	s.statusUntil = time.Now().Add(statusMessageDuration)
+	time.AfterFunc(statusMessageDuration, func() {
+		screen.PostEvent(tcell.NewEventInterrupt(nil))
+	})
 }
 
 func runTUI(directories []string) (string, error) {
@@ -33,7 +1138,14 @@ func runTUIAsync(dirChan <-chan DirBatch) (string, error) {
 }
 
 func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error) {
-	screen, err := tcell.NewScreen()
+	return runTUIWithConfigCtx(ctx, dirChan, TUIConfig{})
+}
+
+// newScreen opens the terminal the finder draws on; tests replace it
+var newScreen = openTTYScreen
+
+func runTUIWithConfigCtx(ctx context.Context, dirChan <-chan DirBatch, config TUIConfig) (string, error) {
+	screen, err := newScreen()
 	if err != nil {
 		return "", err
 	}
@@ -43,6 +1155,12 @@ func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error
 	}
 	defer screen.Fini()
 	
+	return runTUIOnScreen(ctx, screen, dirChan, config)
+}
+
+// runTUIOnScreen runs the finder on an initialised screen until a selection
+// is made or the user quits
+func runTUIOnScreen(ctx context.Context, screen tcell.Screen, dirChan <-chan DirBatch, config TUIConfig) (string, error) {
 	screen.SetStyle(tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite))
 	screen.Clear()
 	
@@ -50,12 +1168,28 @@ func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error
 	state := &uiState{
 		directories: make([]string, 0, 1000), // Pre-allocate for performance
 		matches:     make([]fuzzy.Match, 0),
+		query:       config.InitialQuery,
+		prevCount:   -1,
+		depth:       config.Depth,
+		scanCtx:     ctx,
+		config:      config,
 	}
 	
 	// Start a goroutine to receive directory updates
 	updateChan := make(chan struct{}, 1)
 	errorChan := make(chan error, 1)
 	
+	state.notify = func() {
+		screen.PostEvent(tcell.NewEventInterrupt(nil))
+	}
+	if timer := state.startScanBudget(config.ScanBudget, state.notify); timer != nil {
+		defer timer.Stop()
+	}
+	if config.PreviewCmd != "" {
+		state.preview = newPreviewer(config.PreviewCmd, config.PreviewLines, config.PreviewDebounce, state.notify)
+		defer state.preview.stop()
+	}
+	
 	go func() {
 		for {
 			select {
@@ -68,22 +1202,21 @@ func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error
 				}
 				
 				state.mu.Lock()
+				if state.scanGen != 0 {
+					// A reload replaced this scan; no longer reading parks it
+					// until the finder exits
+					state.mu.Unlock()
+					return
+				}
 				// Check for errors
-				if batch.Err != nil && batch.Err != context.Canceled {
+				if batch.Err != nil && !errors.Is(batch.Err, context.Canceled) {
 					select {
 					case errorChan <- batch.Err:
 					default:
 					}
 				}
 				
-				// Append new directories
-				if len(batch.Directories) > 0 {
-					state.directories = append(state.directories, batch.Directories...)
-					// Re-run fuzzy match on the updated list
-					state.matches = fuzzyMatch(state.query, state.directories)
-				}
-				
-				state.scanComplete = batch.Done
+				state.consume(batch)
 				state.mu.Unlock()
 				
 				// Non-blocking send to trigger refresh
@@ -104,6 +1237,11 @@ func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error
 		for {
 			select {
 			case <-eventCtx.Done():
+				if ctx.Err() != nil {
+					// Wake the event loop so it notices the deadline or
+					// interrupt
+					screen.PostEvent(tcell.NewEventInterrupt(nil))
+				}
 				return
 			case _, ok := <-updateChan:
 				if !ok {
@@ -114,57 +1252,292 @@ func runTUIAsyncCtx(ctx context.Context, dirChan <-chan DirBatch) (string, error
 		}
 	}()
 	
+	// pending holds an event read ahead while coalescing resizes; fullRedraw
+	// makes the next frame repaint every cell instead of just the changes
+	var pending tcell.Event
+	fullRedraw := false
+	var frames renderer
+	
+	defer func() {
+		state.mu.Lock()
+		state.cancelAutoSelect()
+		if config.OnExit != nil && state.scanComplete {
+			config.OnExit(state.directories, state.query, state.modTimes)
+		}
+		state.mu.Unlock()
+	}()
+	
 	for {
+		// Give up once the session's context ends (--max-runtime, signals)
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		// Check for scanning errors
 		select {
 		case err := <-errorChan:
-			if err != nil && err != context.Canceled {
+			if err != nil && !errors.Is(err, context.Canceled) {
 				return "", fmt.Errorf("scanning error: %w", err)
 			}
 		default:
 		}
 		// Render current state
-		state.mu.RLock()
-		updateDisplayAsync(screen, state.matches, state.query, state.selected, 
-			state.scrollOffset, len(state.directories), state.scanComplete)
-		state.mu.RUnlock()
-		screen.Show()
+		state.drawFrame(screen, &frames)
+		if fullRedraw {
+			screen.Sync()
+			fullRedraw = false
+		} else {
+			screen.Show()
+		}
 		
-		ev := screen.PollEvent()
+		ev := pending
+		pending = nil
+		if ev == nil {
+			ev = screen.PollEvent()
+		}
 		switch ev := ev.(type) {
 		case *tcell.EventKey:
 			result := handleKeyEventState(ev, state, screen)
 			
+			if result == 1 {
+				return state.commitSelection()
+			}
 			if result != 0 {
-				state.mu.RLock()
-				defer state.mu.RUnlock()
-				
-				if result == 1 && state.selected >= 0 && state.selected < len(state.matches) {
-					return state.matches[state.selected].Str, nil
-				}
-				return "", fmt.Errorf("cancelled")
+				return "", ErrCancelled
 			}
 		case *tcell.EventResize:
-			screen.Sync()
+			// A burst of resizes (e.g. a tiling window manager adjusting)
+			// becomes a single redraw at the final size, and the old cells
+			// are discarded so nothing from the previous geometry survives
+			pending = coalesceResizes(screen, resizeCoalesceWindow)
+			screen.Clear()
+			_, height := screen.Size()
+			state.mu.Lock()
+			state.fitToHeight(height)
+			state.mu.Unlock()
+			fullRedraw = true
+			frames.drawn = false
 		case *tcell.EventInterrupt:
-			// Directory update received - will refresh on next loop
+			// Directory update received - will refresh on next loop, unless
+			// it completed the scan an Enter was waiting for
+			state.mu.Lock()
+			ready := state.pendingEnterReady() || state.autoSelectDue()
+			if ready {
+				// The finished list decides, not the frame before it
+				state.captureCommit(false)
+			}
+			state.mu.Unlock()
+			if ready {
+				return state.commitSelection()
+			}
+		}
+	}
+}
+
+// drawFrame renders the current state through frames, noting the selection
+// in the same critical section as the snapshot so Enter can commit exactly
+// what was on screen (see captureCommit). The snapshot is rendered after
+// unlocking so batches and full matches aren't held up by drawing.
+func (s *uiState) drawFrame(screen tcell.Screen, frames *renderer) {
+	s.mu.Lock()
+	s.checkAutoSelect()
+	s.requestPreview()
+	view := s.view()
+	_, height := screen.Size()
+	view.ModTimes = s.visibleModTimes(view, computeLayout(height, view.Config).MaxDisplay)
+	s.drawn = ""
+	if view.Selected >= 0 && view.Selected < len(view.Matches) {
+		s.drawn = view.Matches[view.Selected].Str
+	}
+	s.mu.Unlock()
+	
+	// setRanked replaces the match slices rather than mutating them, so the
+	// snapshot stays valid while new batches arrive
+	frames.render(screen, view)
+}
+
+// visibleModTimes copies the captured mtimes of the rows view draws, since
+// recordModTimes keeps adding to s.modTimes while a frame renders; the
+// caller must hold the write lock
+func (s *uiState) visibleModTimes(view displayView, maxDisplay int) map[string]time.Time {
+	if len(s.modTimes) == 0 {
+		return nil
+	}
+	times := make(map[string]time.Time, maxDisplay)
+	for _, row := range view.resultRows(maxDisplay) {
+		if row.Match < 0 || row.Match >= len(view.Matches) {
+			continue
+		}
+		path := view.Matches[row.Match].Str
+		if modTime, ok := s.modTimes[path]; ok {
+			times[path] = modTime
+		}
+	}
+	return times
+}
+
+// copyText copies text for Ctrl+Y or Alt+Y and confirms it in the status
+// bar, naming it with kind (e.g. "query "). Key events are handled between
+// frames, so the OSC 52 sequence can't interleave with a frame being drawn.
+// The caller must hold the write lock, which is released while the copy
+// runs so a slow clipboard command doesn't hold up scan batches.
+func (s *uiState) copyText(text, kind string, screen tcell.Screen) {
+	s.mu.Unlock()
+	viaTerminal, err := copyToClipboard(text, screenTerminal(screen))
+	s.mu.Lock()
+	switch {
+	case err != nil:
+		s.setStatus(fmt.Sprintf("  ✗ Copy failed: %v", err), screen)
+	case viaTerminal:
+		// Only the terminal knows whether it accepted the sequence
+		s.setStatus("  📋 Sent "+kind+"to terminal clipboard: "+text, screen)
+	default:
+		s.setStatus("  📋 Copied "+kind+text, screen)
+	}
+}
+
+// requestPreview points the previewer at the current selection; the caller
+// must hold the write lock
+func (s *uiState) requestPreview() {
+	if s.preview == nil || s.config.PreviewCmd == "" {
+		return
+	}
+	path := ""
+	if s.selected >= 0 && s.selected < len(s.matches) {
+		path = s.matches[s.selected].Str
+	}
+	s.preview.request(path)
+}
+
+// unlock turns the locked primary filter back into the editable query; the
+// caller must hold the write lock
+func (s *uiState) unlock() {
+	s.prevCount = len(s.matches)
+	s.query, s.locked = s.locked, ""
+	s.rematch()
+	s.selected = 0
+	s.scrollOffset = 0
+}
+
+// resizeCoalesceWindow is how long the event loop waits for further resize
+// events before redrawing
+const resizeCoalesceWindow = 20 * time.Millisecond
+
+// coalesceResizes swallows resize events until none arrives for window. It
+// returns the first other event it had to read, or nil, for the caller to
+// handle next.
+func coalesceResizes(screen tcell.Screen, window time.Duration) tcell.Event {
+	deadline := time.Now().Add(window)
+	for time.Now().Before(deadline) {
+		if !screen.HasPendingEvent() {
+			time.Sleep(time.Millisecond)
+			continue
 		}
+		ev := screen.PollEvent()
+		if _, ok := ev.(*tcell.EventResize); !ok {
+			return ev
+		}
+		deadline = time.Now().Add(window)
+	}
+	return nil
+}
+
+// fitToHeight keeps the selection visible after the screen height changes;
+// the caller must hold the write lock
+func (s *uiState) fitToHeight(height int) {
+	maxDisplay := computeLayout(height, s.config).MaxDisplay
+	if maxDisplay < 1 {
+		maxDisplay = 1
+	}
+	if s.selected >= s.scrollOffset+maxDisplay {
+		s.scrollOffset = s.selected - maxDisplay + 1
+	}
+	if s.scrollOffset > s.selected {
+		s.scrollOffset = s.selected
+	}
+	if s.scrollOffset < 0 {
+		s.scrollOffset = 0
 	}
 }
 
 // handleKeyEventState handles keyboard input with proper state management
 func handleKeyEventState(event *tcell.EventKey, state *uiState, screen tcell.Screen) int {
 	_, height := screen.Size()
-	maxDisplay := height - 7 // Updated to match new layout spacing
 	
 	state.mu.Lock()
 	defer state.mu.Unlock()
 	
-	switch event.Key() {
-	case tcell.KeyEscape, tcell.KeyCtrlQ:
+	maxDisplay := computeLayout(height, state.config).MaxDisplay
+	
+	key := event.Key()
+	if key != tcell.KeyEnter {
+		// Any other key means the user is still deciding
+		state.enterPending = false
+	}
+	if !state.autoAt.IsZero() {
+		// Don't re-arm until the query changes
+		state.autoDeclined = state.query
+		state.cancelAutoSelect()
+	}
+	if state.palette != nil {
+		return state.handlePaletteKey(event, height, screen)
+	}
+	if state.config.Reverse {
+		// Keep arrows visual: Up moves away from the prompt, to worse matches
+		switch key {
+		case tcell.KeyUp:
+			key = tcell.KeyDown
+		case tcell.KeyDown:
+			key = tcell.KeyUp
+		}
+	}
+	
+	switch key {
+	case tcell.KeyEscape:
+		if state.config.EscapeMode == escapeClearThenCancel && (state.query != "" || state.locked != "") {
+			// First Escape clears, a second one on the empty query cancels
+			state.prevCount = len(state.matches)
+			state.query, state.locked = "", ""
+			state.rematch()
+			state.selected = 0
+			state.scrollOffset = 0
+			return 0
+		}
+		return -1
+	case tcell.KeyCtrlQ:
 		return -1
 	case tcell.KeyEnter:
+		if state.config.WaitForScan && !state.scanComplete && state.query != "" && !state.enterPending {
+			// The wanted directory may not have been discovered yet
+			state.enterPending = true
+			state.enterUntil = time.Now().Add(scanWaitGrace)
+			state.setStatus("  ⟳ Still scanning, press Enter again to select now", screen)
+			return 0
+		}
+		state.captureCommit(true)
 		return 1
+	case tcell.KeyCtrlY:
+		if state.selected >= 0 && state.selected < len(state.matches) {
+			state.copyText(state.matches[state.selected].Str, "", screen)
+		}
+		return 0
+	case tcell.KeyCtrlE:
+		if state.config.ExportPath != "" {
+			if err := exportResults(state.config.ExportPath, state.matches); err != nil {
+				state.setStatus(fmt.Sprintf("  ✗ Export failed: %v", err), screen)
+			} else {
+				state.setStatus(fmt.Sprintf("  💾 Exported %d to %s", len(state.matches), formatPath(state.config.ExportPath, homeDir())), screen)
+			}
+		}
+	case tcell.KeyCtrlT:
+		if state.selected >= 0 && state.selected < len(state.matches) {
+			if state.togglePin(state.matches[state.selected].Str) {
+				state.setStatus("  📌 Pinned", screen)
+			} else {
+				state.setStatus("  Unpinned", screen)
+			}
+			state.selected = 0
+			state.scrollOffset = 0
+		}
 	case tcell.KeyUp:
 		if state.selected > 0 {
 			state.selected--
@@ -179,16 +1552,100 @@ func handleKeyEventState(event *tcell.EventKey, state *uiState, screen tcell.Scr
 				state.scrollOffset = state.selected - maxDisplay + 1
 			}
 		}
+	case tcell.KeyLeft, tcell.KeyRight:
+		if state.config.Breadcrumb {
+			delta := 1
+			if event.Key() == tcell.KeyLeft {
+				delta = -1
+			}
+			state.moveCrumb(delta)
+		}
+	case tcell.KeyCtrlD:
+		if state.config.Deepen != nil {
+			if !state.scanComplete {
+				state.setStatus("  ⟳ Wait for the scan to finish before deepening", screen)
+			} else {
+				state.deepen()
+				state.setStatus(fmt.Sprintf("  ⟳ Deepening to depth %d", state.depth), screen)
+			}
+		}
+	case tcell.KeyCtrlF:
+		if state.config.FocusScan != nil {
+			if !state.scanComplete {
+				state.setStatus("  ⟳ Wait for the scan to finish before scanning deeper", screen)
+			} else if root, ok := state.focusScan(); ok {
+				state.setStatus(fmt.Sprintf("  ⟳ Scanning below %s", formatPath(root, homeDir())), screen)
+			}
+		}
+	case tcell.KeyCtrlR:
+		if state.config.Reload != nil {
+			if count, err := state.reload(); err != nil {
+				state.setStatus(fmt.Sprintf("  ✗ Reload failed: %v", err), screen)
+			} else {
+				state.setStatus(fmt.Sprintf("  ⟳ Reloaded %d ignore patterns, rescanning", count), screen)
+			}
+		}
+	case tcell.KeyCtrlP:
+		state.palette = &palette{options: paletteOptions(state.config)}
+	case tcell.KeyCtrlX:
+		if state.selected >= 0 && state.selected < len(state.matches) {
+			path := state.matches[state.selected].Str
+			state.remove(path)
+			state.setStatus("  ✗ Removed "+path, screen)
+		}
+	case tcell.KeyCtrlA:
+		if state.selected >= 0 && state.selected < len(state.matches) {
+			path := state.matches[state.selected].Str
+			if state.toggleAncestors(path) {
+				state.setStatus("  Hiding the parents of "+formatPath(path, homeDir()), screen)
+			} else {
+				state.setStatus("  Showing parent directories again", screen)
+			}
+		}
+	case tcell.KeyTab:
+		// Lock the query as the primary filter and start a fresh secondary
+		// one, or unlock again from an empty secondary
+		if state.locked == "" && state.query != "" {
+			state.prevCount = len(state.matches)
+			state.locked, state.query = state.query, ""
+			state.rematch()
+			state.selected = 0
+			state.scrollOffset = 0
+		} else if state.locked != "" && state.query == "" {
+			state.unlock()
+		}
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		if len(state.query) > 0 {
-			state.query = state.query[:len(state.query)-1]
-			state.matches = fuzzyMatch(state.query, state.directories)
+		if len(state.query) == 0 && state.locked != "" {
+			state.unlock()
+		} else if len(state.query) > 0 {
+			state.prevCount = len(state.matches)
+			state.query = dropLastRune(state.query)
+			state.rematch()
 			state.selected = 0
 			state.scrollOffset = 0
 		}
 	case tcell.KeyRune:
+		if r := event.Rune(); state.config.NumberSelect && event.Modifiers()&tcell.ModAlt != 0 && r >= '1' && r <= '9' {
+			// Alt+digit selects the numbered result at once, scan or not
+			view := state.view()
+			picks := view.quickPicks(view.resultRows(maxDisplay))
+			if n := int(r - '0'); n <= len(picks) {
+				state.selected = picks[n-1]
+				state.captureCommit(false)
+				return 1
+			}
+			return 0
+		}
+		if event.Modifiers()&tcell.ModAlt != 0 && event.Rune() == 'y' {
+			// Alt+Y copies the query, as Ctrl+Y copies the selection
+			if state.query != "" {
+				state.copyText(state.query, "query ", screen)
+			}
+			return 0
+		}
+		state.prevCount = len(state.matches)
 		state.query += string(event.Rune())
-		state.matches = fuzzyMatch(state.query, state.directories)
+		state.rematch()
 		state.selected = 0
 		state.scrollOffset = 0
 	}
@@ -197,7 +1654,7 @@ func handleKeyEventState(event *tcell.EventKey, state *uiState, screen tcell.Scr
 
 func handleKeyEvent(event *tcell.EventKey, query *string, selected *int, matches *[]fuzzy.Match, directories []string, screen tcell.Screen, scrollOffset int) (int, int) {
 	_, height := screen.Size()
-	maxDisplay := height - 7 // Updated to match new layout spacing
+	maxDisplay := computeLayout(height, TUIConfig{}).MaxDisplay
 	
 	switch event.Key() {
 	case tcell.KeyEscape:
@@ -222,7 +1679,7 @@ func handleKeyEvent(event *tcell.EventKey, query *string, selected *int, matches
 		}
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
 		if len(*query) > 0 {
-			*query = (*query)[:len(*query)-1]
+			*query = dropLastRune(*query)
 			*matches = fuzzyMatch(*query, directories)
 			if *selected >= len(*matches) {
 				*selected = len(*matches) - 1
@@ -242,108 +1699,160 @@ func handleKeyEvent(event *tcell.EventKey, query *string, selected *int, matches
 }
 
 func updateDisplay(screen tcell.Screen, matches []fuzzy.Match, query string, selected int, scrollOffset int) {
-	updateDisplayAsync(screen, matches, query, selected, scrollOffset, len(matches), true)
+	updateDisplayAsync(screen, displayView{
+		Matches:      matches,
+		Query:        query,
+		Selected:     selected,
+		ScrollOffset: scrollOffset,
+		TotalDirs:    len(matches),
+		ScanComplete: true,
+		PrevCount:    -1,
+	})
 }
 
-func updateDisplayAsync(screen tcell.Screen, matches []fuzzy.Match, query string, selected int, scrollOffset int, totalDirs int, scanComplete bool) {
+func updateDisplayAsync(screen tcell.Screen, view displayView) {
+	matches, query, scrollOffset := view.Matches, view.Query, view.ScrollOffset
+	totalDirs, scanComplete := view.TotalDirs, view.ScanComplete
+	
 	screen.Clear()
 	
 	width, height := screen.Size()
+	layout := computeLayout(height, view.Config)
 	
-	// Calculate layout dimensions with more generous spacing
-	infoPanelWidth := 14 // Slightly wider for better readability
-	if width > 80 {
-		infoPanelWidth = 18 // Even wider panel for larger terminals
-	}
-	contentWidth := width - infoPanelWidth - 1 // -1 for divider
+	contentWidth, previewX, resultsWidth := paneWidths(width, view.Config)
 	dividerX := contentWidth
 	
 	// Enhanced styles with bold text for prominence
 	style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
 	promptStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGreen).Bold(true)
 	dividerStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGray)
-	selectedStyle := tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite).Bold(true)
 	headerStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorBlue).Bold(true)
 	statusStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorYellow).Bold(true)
 	helpStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGray).Bold(true)
 	
 	// Draw prominent prompt with cursor and extra spacing
-	prompt := fmt.Sprintf("  cdf > %s_", query)
-	if len(prompt) > contentWidth {
-		prompt = prompt[:contentWidth-3] + "..."
+	label := "cdf"
+	if view.Config.PromptLabel != "" {
+		label = view.Config.PromptLabel
+	}
+	prompt := fmt.Sprintf("  %s > %s_", label, query)
+	if view.Locked != "" {
+		prompt = fmt.Sprintf("  %s > [%s] %s_", label, view.Locked, query)
+	}
+	prompt = truncateText(prompt, contentWidth)
+	drawText(screen, 0, layout.PromptY, promptStyle, prompt)
+	if view.Config.CountHint {
+		hint := countHint(len(matches), view.PrevCount)
+		promptWidth := runewidth.StringWidth(prompt)
+		if promptWidth+len(hint) <= contentWidth {
+			drawText(screen, promptWidth, layout.PromptY, helpStyle, hint)
+		}
 	}
-	drawText(screen, 0, 0, promptStyle, prompt)
-	
-	// Add empty line for breathing room
-	drawText(screen, 0, 1, style, "")
 	
-	// Draw stronger horizontal divider under prompt
+	// Draw stronger horizontal divider under prompt (after an empty line for
+	// breathing room unless compact)
+	rule := '═'
+	if view.Config.Borders {
+		rule = '─'
+	}
 	for x := 0; x < contentWidth; x++ {
-		screen.SetContent(x, 2, '═', nil, dividerStyle)
+		screen.SetContent(x, layout.PromptDivider, rule, nil, dividerStyle)
 	}
 	
 	// Draw vertical divider with double-line character for prominence
 	for y := 0; y < height; y++ {
 		screen.SetContent(dividerX, y, '║', nil, dividerStyle)
 	}
+	if view.Config.Borders {
+		// The rules meet the panel's edge
+		screen.SetContent(dividerX, layout.PromptDivider, '╢', nil, dividerStyle)
+		screen.SetContent(dividerX, layout.StatusDivider, '╢', nil, dividerStyle)
+	}
 	
 	// Draw info panel header with bold styling
 	drawText(screen, dividerX+2, 0, headerStyle, fmt.Sprintf("📁 %d dirs", totalDirs))
 	
 	// Draw scanning status with emphasis
 	scanPhase := "✓ Complete"
+	phaseStyle := statusStyle
 	if !scanComplete {
 		scanPhase = "⟳ Scanning..."
+		if view.BudgetSpent {
+			// Past the soft budget the results are likely good enough; keep
+			// scanning quietly instead of signalling that the user should wait
+			scanPhase = "· Background"
+			phaseStyle = helpStyle
+		}
+	}
+	drawText(screen, dividerX+2, 1, phaseStyle, scanPhase)
+	if view.LocalEmpty {
+		// Nothing matched locally, so every result is from elsewhere
+		drawText(screen, dividerX+2, 3, helpStyle, "∅ None local")
 	}
-	drawText(screen, dividerX+2, 1, statusStyle, scanPhase)
 	
-	// Directory list area with more spacing
-	startY := 4 // Increased from 2 for more breathing room
-	maxDisplay := height - 7 // Leave more room for spacing and status
+	// Directory list area
+	maxDisplay := layout.MaxDisplay
 	
-	endIndex := scrollOffset + maxDisplay
-	if endIndex > len(matches) {
-		endIndex = len(matches)
+	if scanComplete && totalDirs == 0 {
+		// Nothing to match against at all, as opposed to nothing matching
+		// the query: suggest how to get a useful scan
+		message := view.Config.EmptyMessage
+		if message == "" {
+			message = defaultEmptyMessage
+			if view.Config.LocalOnly {
+				message = localEmptyMessage
+			}
+		}
+		for i, text := range strings.Split(message, "\n") {
+			if i >= maxDisplay {
+				break
+			}
+			drawText(screen, 0, layout.ResultRow(i), helpStyle, truncateText("  "+text, resultsWidth))
+		}
 	}
 	
-	// Draw directory entries with enhanced spacing and styling
-	for i := scrollOffset; i < endIndex; i++ {
-		if i >= len(matches) {
-			break
+	rows := view.resultRows(maxDisplay)
+	picks := view.quickPicks(rows)
+	endIndex := scrollOffset
+	for _, row := range rows {
+		if row.Match >= 0 {
+			endIndex = row.Match + 1
 		}
-		
-		match := matches[i]
-		dir := formatMatch(match)
-		
-		// Format directory line with more prominent selection indicator and spacing
-		var line string
-		if i == selected {
-			line = fmt.Sprintf("  ▶  %s", dir)
-		} else {
-			line = fmt.Sprintf("     %s", dir)
+	}
+	
+	// Draw directory entries with enhanced spacing and styling
+	for displayIndex, row := range rows {
+		y := layout.ResultRow(displayIndex)
+		if row.Match < 0 {
+			label := row.Header
+			if row.Count > 0 {
+				label = fmt.Sprintf("%s (%d)", label, row.Count)
+			}
+			header := "  ── " + label + " ──"
+			header = truncateText(header, resultsWidth)
+			drawText(screen, 0, y, headerStyle, header)
+			continue
 		}
 		
-		// Truncate if too long for content area
-		if len(line) > contentWidth {
-			line = line[:contentWidth-3] + "..."
+		drawMatchRow(screen, view, row.Match, quickNumber(picks, row.Match), y, resultsWidth)
+	}
+	drawBreadcrumb(screen, view, layout.BreadcrumbY, resultsWidth)
+	
+	if previewX >= 0 {
+		for i := 0; i < maxDisplay; i++ {
+			screen.SetContent(previewX-1, layout.ResultsY+i, '│', nil, dividerStyle)
 		}
-		
-		displayIndex := i - scrollOffset
-		y := startY + displayIndex
-		
-		if i == selected {
-			drawText(screen, 0, y, selectedStyle, line)
-		} else {
-			drawText(screen, 0, y, style, line)
+		lines := strings.Split(strings.ReplaceAll(view.Preview, "\t", "    "), "\n")
+		for i := 0; i < maxDisplay && i < len(lines); i++ {
+			drawText(screen, previewX+1, layout.ResultsY+i, style, truncateText(lines[i], contentWidth-previewX-1))
 		}
 	}
 	
-	// Add spacing before status section
-	statusY := height - 3
-	
 	// Draw stronger horizontal divider above status
-	for x := 0; x < contentWidth; x++ {
-		screen.SetContent(x, statusY, '═', nil, dividerStyle)
+	if layout.StatusDivider >= 0 {
+		for x := 0; x < contentWidth; x++ {
+			screen.SetContent(x, layout.StatusDivider, rule, nil, dividerStyle)
+		}
 	}
 	
 	// Draw bottom status with enhanced styling and spacing
@@ -357,11 +1866,30 @@ func updateDisplayAsync(screen tcell.Screen, matches []fuzzy.Match, query string
 	} else {
 		status = fmt.Sprintf("  📂 %d matches • showing all", len(matches))
 	}
-	
-	if len(status) > contentWidth {
-		status = status[:contentWidth-3] + "..."
+	if view.Config.Deepen != nil {
+		status += fmt.Sprintf(" • depth %d", view.Depth+view.Config.DepthBase)
+	}
+	if view.Config.ShowIgnored && view.Ignored > 0 {
+		status += fmt.Sprintf(" (%d ignored)", view.Ignored)
+	}
+	if view.Sampled {
+		// Stays up until the full match replaces the sampled one
+		status += " • ~approx, pause for all"
+	}
+	if !view.AutoAt.IsZero() && len(matches) == 1 {
+		remaining := view.AutoAt.Sub(view.Now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		secs := int((remaining + time.Second - 1) / time.Second)
+		status = fmt.Sprintf("  ⏎ Selecting in %ds • any key cancels", secs)
+	}
+	if view.StatusMsg != "" {
+		status = view.StatusMsg
 	}
-	drawText(screen, 0, height-2, statusStyle, status)
+	
+	status = truncateText(status, contentWidth)
+	drawText(screen, 0, layout.StatusY, statusStyle, status)
 	
 	// Draw enhanced help text in info panel with better spacing
 	helpY := 4
@@ -370,11 +1898,413 @@ func updateDisplayAsync(screen tcell.Screen, matches []fuzzy.Match, query string
 		drawText(screen, dividerX+2, helpY+2, helpStyle, "↑↓ Navigate")
 		drawText(screen, dividerX+2, helpY+3, helpStyle, "⏎  Select")
 		drawText(screen, dividerX+2, helpY+4, helpStyle, "⎋  Quit")
+		drawText(screen, dividerX+2, helpY+5, helpStyle, "^Y Copy")
+		drawText(screen, dividerX+2, helpY+6, helpStyle, "⌥Y Copy query")
+		drawText(screen, dividerX+2, helpY+7, helpStyle, "^T Pin")
+		drawText(screen, dividerX+2, helpY+8, helpStyle, "⇥  Lock")
+		drawText(screen, dividerX+2, helpY+9, helpStyle, "^X Remove")
+		drawText(screen, dividerX+2, helpY+10, helpStyle, "^A Hide parents")
+		extra := helpY + 11
+		if view.Config.Breadcrumb {
+			drawText(screen, dividerX+2, extra, helpStyle, "←→ Path segment")
+			extra++
+		}
+		if view.Config.NumberSelect {
+			drawText(screen, dividerX+2, extra, helpStyle, "⌥1-9 Pick row")
+			extra++
+		}
+		if view.Config.Deepen != nil {
+			drawText(screen, dividerX+2, extra, helpStyle, "^D Deeper")
+			extra++
+		}
+		if view.Config.FocusScan != nil {
+			drawText(screen, dividerX+2, extra, helpStyle, "^F Scan below")
+			extra++
+		}
+		if view.Config.Reload != nil {
+			drawText(screen, dividerX+2, extra, helpStyle, "^R Reload")
+			extra++
+		}
+		if view.Config.ExportPath != "" {
+			drawText(screen, dividerX+2, extra, helpStyle, "^E Export list")
+			extra++
+		}
+		drawText(screen, dividerX+2, extra, helpStyle, "^P Options")
+	}
+	
+	if view.Palette != nil {
+		drawPalette(screen, layout, contentWidth, view.Palette, view.PaletteIndex)
+	}
+}
+
+// paneWidths splits a screen width columns wide into the content area left of
+// the info panel, the preview pane's column (-1 without one) and the width
+// left for results
+func paneWidths(width int, config TUIConfig) (contentWidth, previewX, resultsWidth int) {
+	// Calculate layout dimensions with more generous spacing
+	infoPanelWidth := 14 // Slightly wider for better readability
+	if width > 80 {
+		infoPanelWidth = 18 // Even wider panel for larger terminals
+	}
+	contentWidth = width - infoPanelWidth - 1 // -1 for divider
+	
+	// The preview pane takes the right half of the result area
+	previewX, resultsWidth = -1, contentWidth
+	if config.PreviewCmd != "" && contentWidth >= 40 {
+		previewX = contentWidth / 2
+		resultsWidth = previewX - 1
+	}
+	return contentWidth, previewX, resultsWidth
+}
+
+// renderer draws successive frames, repainting only the two affected rows when
+// nothing but the selection moved since the last frame. Holding an arrow key
+// otherwise clears and redraws every cell on each keystroke.
+type renderer struct {
+	last          displayView
+	width, height int
+	drawn         bool
+}
+
+// render draws view, fully unless it can be reached from the previous frame by
+// moving the selection alone
+func (r *renderer) render(screen tcell.Screen, view displayView) {
+	width, height := screen.Size()
+	if r.drawn && width == r.width && height == r.height && r.selectionOnly(view) {
+		layout := computeLayout(height, view.Config)
+		_, _, resultsWidth := paneWidths(width, view.Config)
+		rows := view.resultRows(layout.MaxDisplay)
+		picks := view.quickPicks(rows)
+		// The base style runTUIOnScreen sets, which a full redraw clears to
+		style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+		for displayIndex, row := range rows {
+			if row.Match != r.last.Selected && row.Match != view.Selected {
+				continue
+			}
+			y := layout.ResultRow(displayIndex)
+			for x := 0; x < resultsWidth; x++ {
+				screen.SetContent(x, y, ' ', nil, style)
+			}
+			drawMatchRow(screen, view, row.Match, quickNumber(picks, row.Match), y, resultsWidth)
+		}
+		drawBreadcrumb(screen, view, layout.BreadcrumbY, resultsWidth)
+	} else {
+		updateDisplayAsync(screen, view)
+	}
+	r.last, r.width, r.height, r.drawn = view, width, height, true
+}
+
+// selectionOnly reports whether view differs from the last frame only in which
+// match is selected, with the same matches laid out the same way
+func (r *renderer) selectionOnly(view displayView) bool {
+	last := r.last
+	if view.Selected == last.Selected || len(view.Matches) == 0 || len(view.Matches) != len(last.Matches) || &view.Matches[0] != &last.Matches[0] {
+		return false
+	}
+	if view.Config.Group || view.Palette != nil || last.Palette != nil || !view.AutoAt.IsZero() || !last.AutoAt.IsZero() {
+		return false
+	}
+	if !view.Now.Equal(last.Now) && (view.Config.HighlightRecent > 0 || view.Config.AgeColors != nil) {
+		return false
+	}
+	return view.Query == last.Query && view.Locked == last.Locked &&
+		view.ScrollOffset == last.ScrollOffset && view.TotalDirs == last.TotalDirs &&
+		view.ScanComplete == last.ScanComplete && view.StatusMsg == last.StatusMsg &&
+		view.Preview == last.Preview && view.PrevCount == last.PrevCount &&
+		view.BudgetSpent == last.BudgetSpent && view.Sampled == last.Sampled &&
+		view.Depth == last.Depth && view.LocalEmpty == last.LocalEmpty && view.Ignored == last.Ignored &&
+		view.Config.PreviewCmd == last.Config.PreviewCmd && samePins(view.Pinned, last.Pinned)
+}
+
+// samePins reports whether a and b pin the same paths
+func samePins(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path := range a {
+		if !b[path] {
+			return false
+		}
+	}
+	return true
+}
+
+// drawMatchRow draws match i of view on row y, within width columns
+func drawMatchRow(screen tcell.Screen, view displayView, i, number, y, width int) {
+	style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+	selectedStyle := tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite).Bold(true)
+	
+	match := view.Matches[i]
+	dir := formatMatch(match)
+	if label := view.Config.Aliases[match.Str]; label != "" {
+		dir = aliasedDisplay(label, dir)
+	}
+	if view.Config.Icons != nil && view.IconTypes != nil {
+		// Only drawn rows are probed, and each directory just once
+		dir = iconFor(view.Config.Icons, view.IconTypes.typeOf(match.Str)) + " " + dir
+	}
+	
+	// Format directory line with more prominent selection indicator and spacing
+	var line string
+	if i == view.Selected {
+		line = fmt.Sprintf("  ▶  %s", dir)
+	} else {
+		line = fmt.Sprintf("     %s", dir)
+	}
+	if number > 0 {
+		line = fmt.Sprintf("%d", number) + line[1:]
+	}
+	if view.Pinned[match.Str] {
+		line += "  📌"
+	}
+	if view.isRecent(match.Str) {
+		line += "  *"
+	}
+	
+	// Truncate if too long for content area
+	line = truncateText(line, width)
+	
+	if i == view.Selected {
+		drawText(screen, 0, y, selectedStyle, line)
+	} else if view.Config.DimReadOnly && view.WriteModes != nil && view.WriteModes.isReadOnly(match.Str) {
+		// Like icons, only drawn rows are inspected
+		drawText(screen, 0, y, style.Foreground(tcell.ColorGray), line)
+	} else if view.Config.AgeColors != nil {
+		modTime, known := view.ModTimes[match.Str]
+		drawText(screen, 0, y, ageStyle(style, view.Now.Sub(modTime), known, view.Config.AgeColors), line)
+	} else {
+		drawText(screen, 0, y, style, line)
+	}
+}
+
+// breadcrumbSeparator goes between the segments of the breadcrumb bar
+const breadcrumbSeparator = " › "
+
+// drawBreadcrumb draws the selection's path as segments on row y, the picked
+// one highlighted. Leading segments give way to … when the row is too narrow.
+func drawBreadcrumb(screen tcell.Screen, view displayView, y, width int) {
+	if y < 0 {
+		return
+	}
+	style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGray)
+	pickedStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorAqua).Bold(true).Underline(true)
+	for x := 0; x < width; x++ {
+		screen.SetContent(x, y, ' ', nil, style)
+	}
+	if view.Selected < 0 || view.Selected >= len(view.Matches) {
+		return
+	}
+	
+	crumbs := breadcrumb(view.Matches[view.Selected].Str, homeDir())
+	picked := len(crumbs) - 1 - view.CrumbUp
+	lineWidth := func(from int) int {
+		w := 2
+		if from > 0 {
+			w += runewidth.StringWidth("…" + breadcrumbSeparator)
+		}
+		for i := from; i < len(crumbs); i++ {
+			if i > from {
+				w += runewidth.StringWidth(breadcrumbSeparator)
+			}
+			w += runewidth.StringWidth(crumbs[i].Label)
+		}
+		return w
+	}
+	from := 0
+	for from < picked && lineWidth(from) > width {
+		from++
+	}
+	
+	x := 2
+	if from > 0 {
+		drawText(screen, x, y, style, "…"+breadcrumbSeparator)
+		x += runewidth.StringWidth("…" + breadcrumbSeparator)
+	}
+	for i := from; i < len(crumbs) && x < width; i++ {
+		if i > from {
+			drawText(screen, x, y, style, truncateText(breadcrumbSeparator, width-x))
+			x += runewidth.StringWidth(breadcrumbSeparator)
+		}
+		segmentStyle := style
+		if i == picked {
+			segmentStyle = pickedStyle
+		}
+		if x < width {
+			label := truncateText(crumbs[i].Label, width-x)
+			drawText(screen, x, y, segmentStyle, label)
+			x += runewidth.StringWidth(label)
+		}
+	}
+}
+
+// drawPalette draws the Ctrl+P palette over the result area
+func drawPalette(screen tcell.Screen, layout screenLayout, width int, entries []string, selected int) {
+	style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+	titleStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorBlue).Bold(true)
+	selectedStyle := tcell.StyleDefault.Background(tcell.ColorDarkBlue).Foreground(tcell.ColorWhite).Bold(true)
+	
+	lines := append([]string{"  ⚙ Options: Enter changes, Esc closes"}, entries...)
+	for i := 0; i < layout.MaxDisplay; i++ {
+		y := layout.ResultsY + i
+		for x := 0; x < width; x++ {
+			screen.SetContent(x, y, ' ', nil, style)
+		}
+		if i >= len(lines) {
+			continue
+		}
+		switch {
+		case i == 0:
+			drawText(screen, 0, y, titleStyle, truncateText(lines[i], width))
+		case i-1 == selected:
+			drawText(screen, 0, y, selectedStyle, truncateText("  ▶  "+lines[i], width))
+		default:
+			drawText(screen, 0, y, style, truncateText("     "+lines[i], width))
+		}
+	}
+}
+
+// isRecent reports whether path was modified within the HighlightRecent
+// window; directories without a known mtime are never recent
+func (v displayView) isRecent(path string) bool {
+	if v.Config.HighlightRecent <= 0 {
+		return false
+	}
+	modTime, ok := v.ModTimes[path]
+	return ok && v.Now.Sub(modTime) <= v.Config.HighlightRecent
+}
+
+// ageStyle grades base by how long ago a directory was modified: within
+// thresholds[0] is brightest, and each later threshold passed dims it a step,
+// down to dark gray beyond the last. Unknown ages keep base.
+func ageStyle(base tcell.Style, age time.Duration, known bool, thresholds []time.Duration) tcell.Style {
+	if !known || len(thresholds) == 0 {
+		return base
+	}
+	step := len(thresholds)
+	for i, threshold := range thresholds {
+		if age <= threshold {
+			step = i
+			break
+		}
+	}
+	// Evenly spaced grays from white down to 88
+	level := int32(255 - (255-88)*step/len(thresholds))
+	style := base.Foreground(tcell.NewRGBColor(level, level, level))
+	if step == 0 {
+		style = style.Bold(true)
+	}
+	return style
+}
+
+// resultRow is one row of the result area: a match, or a group header when
+// Match is -1
+type resultRow struct {
+	Match  int
+	Header string
+	Count  int // Matches under Header, zero when not counted
+}
+
+// resultRows lays out at most maxDisplay rows starting at ScrollOffset. In
+// grouped mode a header precedes each group, and the window slides down
+// when headers would push the selection out of view.
+func (v displayView) resultRows(maxDisplay int) []resultRow {
+	start := v.ScrollOffset
+	for {
+		rows := v.rowsFrom(start, maxDisplay)
+		if !v.Config.Group || len(rows) == 0 || start >= v.Selected || rows[len(rows)-1].Match >= v.Selected {
+			return rows
+		}
+		start++
+	}
+}
+
+// quickPickLimit is how many visible results NumberSelect numbers, one per
+// digit key
+const quickPickLimit = 9
+
+// quickPicks returns the matches rows shows that NumberSelect numbers, in
+// display order: the one numbered n is at n-1. Nil when NumberSelect is off.
+func (v displayView) quickPicks(rows []resultRow) []int {
+	if !v.Config.NumberSelect {
+		return nil
+	}
+	var picks []int
+	for _, row := range rows {
+		if row.Match >= 0 && len(picks) < quickPickLimit {
+			picks = append(picks, row.Match)
+		}
+	}
+	return picks
+}
+
+// quickNumber returns the number picks gives match i, or 0 when it has none
+func quickNumber(picks []int, i int) int {
+	for n, match := range picks {
+		if match == i {
+			return n + 1
+		}
 	}
+	return 0
+}
+
+// rowsFrom lays out at most maxDisplay rows beginning with match start
+func (v displayView) rowsFrom(start, maxDisplay int) []resultRow {
+	var rows []resultRow
+	previous := ""
+	for i := start; i < len(v.Matches) && len(rows) < maxDisplay; i++ {
+		if v.Config.Group {
+			key := displayGroup(v.Matches[i].Str, v.Config.Root, v.Pinned)
+			if key != previous {
+				if len(rows)+2 > maxDisplay {
+					// A header needs room for at least one match under it
+					break
+				}
+				rows = append(rows, resultRow{Match: -1, Header: key, Count: v.GroupCounts[key]})
+				previous = key
+			}
+		}
+		rows = append(rows, resultRow{Match: i})
+	}
+	return rows
+}
+
+// countHint formats the match count shown after the prompt, e.g. " (312 -88)"
+// when the last query edit narrowed 400 matches down to 312
+func countHint(count, prevCount int) string {
+	if prevCount < 0 || prevCount == count {
+		return fmt.Sprintf(" (%d)", count)
+	}
+	return fmt.Sprintf(" (%d %+d)", count, count-prevCount)
 }
 
+// drawText draws text from column x, advancing by each rune's display width
+// so wide characters take two cells, and attaching zero-width combining
+// marks to the preceding cell
 func drawText(screen tcell.Screen, x, y int, style tcell.Style, text string) {
-	for i, r := range text {
-		screen.SetContent(x+i, y, r, nil, style)
+	col := x
+	for _, r := range text {
+		width := runewidth.RuneWidth(r)
+		if width == 0 && col > x {
+			mainc, combc, _, _ := screen.GetContent(col-1, y)
+			screen.SetContent(col-1, y, mainc, append(combc, r), style)
+			continue
+		}
+		screen.SetContent(col, y, r, nil, style)
+		col += width
+	}
+}
+
+// truncateText shortens text to at most width columns, ending in "..." when
+// something was cut, without splitting a rune
+func truncateText(text string, width int) string {
+	return runewidth.Truncate(text, width, "...")
+}
+
+// dropLastRune removes the last rune, not the last byte, of s
+func dropLastRune(s string) string {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return s
 	}
+	return string(runes[:len(runes)-1])
 }
\ No newline at end of file
@@ -0,0 +1,1973 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/sahilm/fuzzy"
+)
+
+// newTestScreen returns an initialised simulation screen of the given size
+func newTestScreen(t *testing.T, width, height int) tcell.SimulationScreen {
+	t.Helper()
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Failed to init simulation screen: %v", err)
+	}
+	screen.SetSize(width, height)
+	t.Cleanup(screen.Fini)
+	return screen
+}
+
+// screenRow returns the text drawn on row y
+func screenRow(screen tcell.SimulationScreen, y int) string {
+	width, _ := screen.Size()
+	var b strings.Builder
+	for x := 0; x < width; x++ {
+		r, _, _, _ := screen.GetContent(x, y)
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// testMatches builds n matches named /dir/NNN
+func testMatches(n int) []fuzzy.Match {
+	matches := make([]fuzzy.Match, n)
+	for i := range matches {
+		matches[i] = fuzzy.Match{Str: fmt.Sprintf("/dir/%03d", i), Index: i}
+	}
+	return matches
+}
+
+// countResultRows counts rows showing one of the testMatches entries
+func countResultRows(screen tcell.SimulationScreen) int {
+	_, height := screen.Size()
+	rows := 0
+	for y := 0; y < height; y++ {
+		if strings.Contains(screenRow(screen, y), "/dir/") {
+			rows++
+		}
+	}
+	return rows
+}
+
+func TestComputeLayoutVisibleRows(t *testing.T) {
+	testCases := []struct {
+		height   int
+		compact  bool
+		expected int
+	}{
+		{24, false, 17},
+		{24, true, 21},
+		{10, false, 3},
+		{10, true, 7},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d-compact-%v", tc.height, tc.compact), func(t *testing.T) {
+			layout := computeLayout(tc.height, TUIConfig{Compact: tc.compact})
+			if layout.MaxDisplay != tc.expected {
+				t.Errorf("computeLayout(%d, %v).MaxDisplay = %d, expected %d",
+					tc.height, tc.compact, layout.MaxDisplay, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRenderVisibleRows(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compact-%v", compact), func(t *testing.T) {
+			screen := newTestScreen(t, 80, 24)
+			updateDisplayAsync(screen, displayView{
+				Matches:      testMatches(100),
+				TotalDirs:    100,
+				ScanComplete: true,
+				Config:       TUIConfig{Compact: compact},
+			})
+
+			expected := computeLayout(24, TUIConfig{Compact: compact}).MaxDisplay
+			if rows := countResultRows(screen); rows != expected {
+				t.Errorf("Rendered %d result rows, expected %d", rows, expected)
+			}
+			if !strings.Contains(screenRow(screen, computeLayout(24, TUIConfig{Compact: compact}).StatusY), "100 matches") {
+				t.Error("Status bar not drawn on the layout's status row")
+			}
+		})
+	}
+}
+
+func TestCompactScrollMatchesLayout(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{matches: testMatches(100), config: TUIConfig{Compact: true}}
+
+	maxDisplay := computeLayout(24, TUIConfig{Compact: true}).MaxDisplay
+	for i := 0; i < maxDisplay; i++ {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+	}
+
+	if state.selected != maxDisplay {
+		t.Fatalf("selected = %d, expected %d", state.selected, maxDisplay)
+	}
+	if state.scrollOffset != 1 {
+		t.Errorf("scrollOffset = %d, expected 1 once the selection passes the last compact row", state.scrollOffset)
+	}
+}
+
+func TestScanBudgetFlipsFlag(t *testing.T) {
+	state := &uiState{}
+	notified := make(chan struct{}, 1)
+
+	timer := state.startScanBudget(20*time.Millisecond, func() { notified <- struct{}{} })
+	if timer == nil {
+		t.Fatal("Expected a timer for a positive budget")
+	}
+	defer timer.Stop()
+
+	state.mu.RLock()
+	spent := state.view().BudgetSpent
+	state.mu.RUnlock()
+	if spent {
+		t.Error("Budget reported spent before it elapsed")
+	}
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("Budget timer never fired")
+	}
+
+	state.mu.RLock()
+	spent = state.view().BudgetSpent
+	state.mu.RUnlock()
+	if !spent {
+		t.Error("Budget not reported spent after it elapsed")
+	}
+
+	screen := newTestScreen(t, 80, 24)
+	updateDisplayAsync(screen, state.view())
+	if !strings.Contains(screenRow(screen, 1), "Background") {
+		t.Errorf("Expected the settled scanning indicator, got %q", screenRow(screen, 1))
+	}
+}
+
+func TestScanBudgetDisabled(t *testing.T) {
+	state := &uiState{}
+	if timer := state.startScanBudget(0, func() {}); timer != nil {
+		timer.Stop()
+		t.Error("Expected no timer when the budget is zero")
+	}
+}
+
+func TestSampledRematchIsBounded(t *testing.T) {
+	directories := make([]string, 5000)
+	for i := range directories {
+		directories[i] = fmt.Sprintf("/data/project%04d/src", i)
+	}
+
+	updated := make(chan struct{}, 1)
+	state := &uiState{
+		directories: directories,
+		config:      TUIConfig{SampleThreshold: 100},
+		notify:      func() { updated <- struct{}{} },
+	}
+
+	screen := newTestScreen(t, 100, 20)
+	layout := computeLayout(20, TUIConfig{})
+
+	state.mu.Lock()
+	state.query = "src"
+	state.rematch()
+	sampledCount := len(state.matches)
+	sampled := state.sampled
+	updateDisplayAsync(screen, state.view())
+	state.mu.Unlock()
+
+	if !sampled {
+		t.Error("Expected sampling above the threshold")
+	}
+	if sampledCount > 100 {
+		t.Errorf("Sampled match returned %d results, expected at most 100", sampledCount)
+	}
+	// The status bar alone says the results are approximate
+	for y := 0; y < 20; y++ {
+		row := screenRow(screen, y)
+		if y == layout.StatusY && !strings.Contains(row, "~approx") {
+			t.Errorf("Expected the approximate indicator in the status bar, got %q", row)
+		}
+		if y != layout.StatusY && (strings.Contains(row, "approx") || strings.Contains(row, "Sampled")) {
+			t.Errorf("Sampling should be shown once, in the status bar; row %d is %q", y, row)
+		}
+	}
+
+	select {
+	case <-updated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Full match never ran after the typing pause")
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if state.sampled {
+		t.Error("Sampled flag still set after the full match")
+	}
+	updateDisplayAsync(screen, state.view())
+	if status := screenRow(screen, layout.StatusY); strings.Contains(status, "~approx") {
+		t.Errorf("Expected the indicator to clear after the full match, got %q", status)
+	}
+	if len(state.matches) != len(directories) {
+		t.Errorf("Full match returned %d results, expected %d", len(state.matches), len(directories))
+	}
+}
+
+func TestStaleFullMatchDiscarded(t *testing.T) {
+	directories := make([]string, 500)
+	for i := range directories {
+		directories[i] = fmt.Sprintf("/data/project%04d", i)
+	}
+	state := &uiState{directories: directories, config: TUIConfig{SampleThreshold: 10}}
+
+	state.mu.Lock()
+	state.query = "p"
+	state.rematch()
+	state.query = "pz"
+	state.rematch()
+	state.mu.Unlock()
+
+	time.Sleep(fullMatchDelay * 3)
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	if len(state.matches) != 0 {
+		t.Errorf("A full match for an older query leaked through: %d matches for %q", len(state.matches), state.query)
+	}
+}
+
+func TestRepeatedQueryHitsMatchCache(t *testing.T) {
+	var matched []string
+	defer func(match func(string, []string, []string) []fuzzy.Match) { matchAll = match }(matchAll)
+	matchAll = func(query string, directories, keys []string) []fuzzy.Match {
+		matched = append(matched, query)
+		return matchKeys(query, directories, keys)
+	}
+	state := &uiState{directories: []string{"/srv/api", "/srv/web", "/srv/db"}}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.query = "api"
+	state.rematch()
+	first := append([]fuzzy.Match(nil), state.matches...)
+
+	state.query = "ap"
+	state.rematch()
+	state.query = "api"
+	state.rematch()
+	if !reflect.DeepEqual(matched, []string{"api", "ap"}) {
+		t.Fatalf("Retyping a query should be answered from the cache, matched %q", matched)
+	}
+	if !reflect.DeepEqual(state.matches, first) {
+		t.Errorf("Cached matches differ: got %v, want %v", state.matches, first)
+	}
+
+	// A new batch changes the directory list, so the query is matched again
+	state.ingest([]string{"/opt/apiserver"})
+	if !reflect.DeepEqual(matched, []string{"api", "ap", "api"}) {
+		t.Errorf("A stale cache entry answered after a batch arrived, matched %q", matched)
+	}
+	if len(state.matches) != 2 {
+		t.Errorf("Expected the new directory to match too, got %v", state.matches)
+	}
+}
+
+func TestWaitForScanEnter(t *testing.T) {
+	enter := tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)
+	newState := func(waitForScan, scanComplete bool) *uiState {
+		return &uiState{
+			query:        "api",
+			matches:      []fuzzy.Match{{Str: "/srv/api"}},
+			scanComplete: scanComplete,
+			config:       TUIConfig{WaitForScan: waitForScan},
+		}
+	}
+
+	t.Run("FirstEnterWaitsSecondForces", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		state := newState(true, false)
+
+		if result := handleKeyEventState(enter, state, screen); result != 0 {
+			t.Fatalf("First Enter mid-scan returned %d, expected to wait", result)
+		}
+		if !state.enterPending {
+			t.Error("Expected a pending Enter")
+		}
+		if !strings.Contains(state.view().StatusMsg, "Still scanning") {
+			t.Errorf("Expected a still-scanning hint, got %q", state.view().StatusMsg)
+		}
+		if result := handleKeyEventState(enter, state, screen); result != 1 {
+			t.Errorf("Second Enter returned %d, expected to force the selection", result)
+		}
+	})
+
+	t.Run("ScanCompletionCommitsPendingEnter", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		state := newState(true, false)
+
+		handleKeyEventState(enter, state, screen)
+		if state.pendingEnterReady() {
+			t.Fatal("Pending Enter ready before the scan finished")
+		}
+		state.scanComplete = true
+		if !state.pendingEnterReady() {
+			t.Fatal("Pending Enter not ready after the scan finished")
+		}
+		path, err := state.commitSelection()
+		if err != nil || path != "/srv/api" {
+			t.Errorf("commitSelection() = %q, %v", path, err)
+		}
+	})
+
+	t.Run("PendingEnterExpires", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		state := newState(true, false)
+
+		handleKeyEventState(enter, state, screen)
+		state.enterUntil = time.Now().Add(-time.Millisecond)
+		state.scanComplete = true
+		if state.pendingEnterReady() {
+			t.Error("Pending Enter committed after the grace period")
+		}
+	})
+
+	t.Run("OtherKeyCancelsPendingEnter", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		state := newState(true, false)
+
+		handleKeyEventState(enter, state, screen)
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+		if state.enterPending {
+			t.Error("Navigation should cancel the pending Enter")
+		}
+		if result := handleKeyEventState(enter, state, screen); result != 0 {
+			t.Errorf("Enter after cancelling should wait again, got %d", result)
+		}
+	})
+
+	t.Run("ScanCompleteSelectsImmediately", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		if result := handleKeyEventState(enter, newState(true, true), screen); result != 1 {
+			t.Errorf("Enter after the scan returned %d, expected 1", result)
+		}
+	})
+
+	t.Run("DisabledSelectsImmediately", func(t *testing.T) {
+		screen := newTestScreen(t, 80, 24)
+		if result := handleKeyEventState(enter, newState(false, false), screen); result != 1 {
+			t.Errorf("Enter without --wait-for-scan returned %d, expected 1", result)
+		}
+	})
+}
+
+func TestBordersLayout(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	config := TUIConfig{Borders: true}
+	updateDisplayAsync(screen, displayView{
+		Matches:      testMatches(100),
+		TotalDirs:    100,
+		ScanComplete: true,
+		Config:       config,
+	})
+
+	layout := computeLayout(24, config)
+	if layout.MaxDisplay != 20 {
+		t.Errorf("MaxDisplay = %d, expected 20 with borders", layout.MaxDisplay)
+	}
+	for _, y := range []int{1, 22} {
+		if row := screenRow(screen, y); !strings.HasPrefix(row, "────") {
+			t.Errorf("Expected a rule on row %d, got %q", y, row)
+		}
+	}
+	if rows := countResultRows(screen); rows != layout.MaxDisplay {
+		t.Errorf("Rendered %d result rows, expected %d", rows, layout.MaxDisplay)
+	}
+	if !strings.Contains(screenRow(screen, layout.StatusY), "100 matches") {
+		t.Error("Status bar not drawn below the bottom rule")
+	}
+
+	// Scrolling starts once the selection passes the last bordered row
+	state := &uiState{matches: testMatches(100), config: config}
+	for i := 0; i < layout.MaxDisplay; i++ {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+	}
+	if state.scrollOffset != 1 {
+		t.Errorf("scrollOffset = %d, expected 1", state.scrollOffset)
+	}
+}
+
+func TestReverseLayoutRows(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	matches := testMatches(3)
+	updateDisplayAsync(screen, displayView{
+		Matches:      matches,
+		Query:        "dir",
+		TotalDirs:    3,
+		ScanComplete: true,
+		Config:       TUIConfig{Reverse: true},
+	})
+
+	if !strings.Contains(screenRow(screen, 23), "cdf > dir") {
+		t.Errorf("Expected the prompt on the bottom row, got %q", screenRow(screen, 23))
+	}
+	// The best match sits right above the prompt area, the rest stack upwards
+	for i, y := range []int{19, 18, 17} {
+		if !strings.Contains(screenRow(screen, y), matches[i].Str) {
+			t.Errorf("Expected %s on row %d, got %q", matches[i].Str, y, screenRow(screen, y))
+		}
+	}
+	if !strings.Contains(screenRow(screen, 1), "3 matches") {
+		t.Errorf("Expected the status bar near the top, got %q", screenRow(screen, 1))
+	}
+
+	layout := computeLayout(24, TUIConfig{Reverse: true})
+	if layout.MaxDisplay != computeLayout(24, TUIConfig{}).MaxDisplay {
+		t.Error("Reverse mode should not change the number of result rows")
+	}
+	if top := layout.ResultRow(layout.MaxDisplay - 1); top != layout.ResultsY {
+		t.Errorf("Last visible result on row %d, expected the top of the result area %d", top, layout.ResultsY)
+	}
+}
+
+func TestReverseCompactLayout(t *testing.T) {
+	layout := computeLayout(24, TUIConfig{Reverse: true, Compact: true})
+	if layout.PromptY != 23 || layout.StatusY != 0 {
+		t.Errorf("Expected prompt on row 23 and status on row 0, got %+v", layout)
+	}
+	if layout.ResultRow(0) != 21 || layout.ResultRow(layout.MaxDisplay-1) != 1 {
+		t.Errorf("Result rows span %d..%d, expected 21..1", layout.ResultRow(0), layout.ResultRow(layout.MaxDisplay-1))
+	}
+}
+
+func TestReverseNavigation(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{matches: testMatches(30), config: TUIConfig{Reverse: true}}
+
+	up := tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModNone)
+	down := tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone)
+
+	handleKeyEventState(up, state, screen)
+	if state.selected != 1 {
+		t.Errorf("Up in reverse mode should move to the next match, selected = %d", state.selected)
+	}
+	handleKeyEventState(down, state, screen)
+	if state.selected != 0 {
+		t.Errorf("Down in reverse mode should move back towards the prompt, selected = %d", state.selected)
+	}
+
+	maxDisplay := computeLayout(24, state.config).MaxDisplay
+	for i := 0; i < maxDisplay; i++ {
+		handleKeyEventState(up, state, screen)
+	}
+	if state.scrollOffset != 1 {
+		t.Errorf("scrollOffset = %d, expected 1 after moving past the top row", state.scrollOffset)
+	}
+}
+
+func TestPinning(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{directories: []string{"/srv/api", "/srv/web", "/srv/db"}}
+	state.rematch()
+
+	ctrlT := tcell.NewEventKey(tcell.KeyCtrlT, 0, tcell.ModCtrl)
+	typeQuery := func(query string) {
+		for _, r := range query {
+			handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), state, screen)
+		}
+	}
+
+	// Pin /srv/db
+	state.selected = 2
+	handleKeyEventState(ctrlT, state, screen)
+	if state.matches[0].Str != "/srv/db" {
+		t.Fatalf("Pinned directory not at the top: %s", state.matches[0].Str)
+	}
+	if !state.view().Pinned["/srv/db"] {
+		t.Error("View does not report the pin")
+	}
+
+	// Survives a query that doesn't match it
+	typeQuery("api")
+	if len(state.matches) != 2 || state.matches[0].Str != "/srv/db" || state.matches[1].Str != "/srv/api" {
+		t.Errorf("Pin did not survive the query change: %+v", state.matches)
+	}
+
+	// Survives new directories arriving
+	state.directories = append(state.directories, "/srv/api-v2")
+	state.rematch()
+	if state.matches[0].Str != "/srv/db" {
+		t.Errorf("Pin did not survive a recompute: %s", state.matches[0].Str)
+	}
+
+	// Unpinning restores normal ranking
+	state.selected = 0
+	handleKeyEventState(ctrlT, state, screen)
+	for _, match := range state.matches {
+		if match.Str == "/srv/db" {
+			t.Error("Unpinned directory still shown for a query it doesn't match")
+		}
+	}
+	if len(state.pins) != 0 {
+		t.Errorf("Expected no pins, got %v", state.pins)
+	}
+}
+
+func TestMaxResultsIngestKeepsGlobalBest(t *testing.T) {
+	batches := [][]string{
+		{"/home/a/b/c/api", "/srv/x/apiary"},
+		{"/api", "/opt/rapid"},
+		{"/srv/api", "/data/aaa/ppp/iii", "/usr/api"},
+	}
+
+	state := &uiState{query: "api", config: TUIConfig{MaxResults: 2}}
+	var all []string
+	for _, batch := range batches {
+		state.ingest(batch)
+		all = append(all, batch...)
+		if len(state.matches) > 2 {
+			t.Fatalf("Cap exceeded: %d matches", len(state.matches))
+		}
+	}
+
+	expected := fuzzyMatch("api", all)[:2]
+	for i := range expected {
+		if state.matches[i].Str != expected[i].Str {
+			t.Errorf("matches[%d] = %s, expected %s", i, state.matches[i].Str, expected[i].Str)
+		}
+		if state.directories[state.matches[i].Index] != state.matches[i].Str {
+			t.Errorf("matches[%d] has a stale index %d", i, state.matches[i].Index)
+		}
+	}
+
+	// A new query re-ranks the whole list under the same cap
+	state.query = "rapid"
+	state.rematch()
+	if len(state.matches) != 1 || state.matches[0].Str != "/opt/rapid" {
+		t.Errorf("Unexpected matches after re-query: %+v", state.matches)
+	}
+}
+
+func TestCountHintNextToPrompt(t *testing.T) {
+	screen := newTestScreen(t, 100, 20)
+	state := &uiState{
+		directories: []string{"/srv/api", "/srv/apiary", "/opt/rapid", "/home/docs"},
+		prevCount:   -1,
+		config:      TUIConfig{CountHint: true},
+	}
+	state.rematch()
+
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); !strings.Contains(row, "cdf > _ (4)") {
+		t.Errorf("Expected the initial count next to the prompt, got %q", row)
+	}
+
+	for _, r := range "api" {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), state, screen)
+	}
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); !strings.Contains(row, "cdf > api_ (3)") {
+		t.Errorf("Expected an unchanged count without a delta, got %q", row)
+	}
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, 'r', tcell.ModNone), state, screen)
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); !strings.Contains(row, "cdf > apir_ (1 -2)") {
+		t.Errorf("Expected the narrowed count with its delta, got %q", row)
+	}
+
+	// Directories found mid-scan update the hint without a keystroke
+	state.ingest([]string{"/tmp/apiroot"})
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); !strings.Contains(row, "cdf > apir_ (2 -1)") {
+		t.Errorf("Expected the count to follow the scan, got %q", row)
+	}
+
+	state.config.CountHint = false
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); strings.Contains(row, "(") {
+		t.Errorf("Hint should be hidden when disabled, got %q", row)
+	}
+}
+
+// redrawCounter counts how a screen was asked to present frames
+type redrawCounter struct {
+	tcell.SimulationScreen
+	shows, syncs int
+}
+
+func (r *redrawCounter) Show() { r.shows++; r.SimulationScreen.Show() }
+func (r *redrawCounter) Sync() { r.syncs++; r.SimulationScreen.Sync() }
+
+func TestResizeBurstCoalesced(t *testing.T) {
+	screen := &redrawCounter{SimulationScreen: newTestScreen(t, 80, 24)}
+	for screen.HasPendingEvent() {
+		screen.PollEvent()
+	}
+
+	// A window manager settling on a size posts several resizes in a row
+	for _, height := range []int{20, 16, 30, 12} {
+		screen.SetSize(80, height)
+		screen.PostEvent(tcell.NewEventResize(80, height))
+	}
+	screen.PostEvent(tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone))
+
+	var dirs []string
+	for _, match := range testMatches(40) {
+		dirs = append(dirs, match.Str)
+	}
+	dirChan := make(chan DirBatch, 1)
+	dirChan <- DirBatch{Directories: dirs, Done: true}
+	close(dirChan)
+
+	if _, err := runTUIOnScreen(context.Background(), screen, dirChan, TUIConfig{}); err == nil {
+		t.Fatal("Expected Esc to cancel")
+	}
+	if screen.syncs != 1 {
+		t.Errorf("Expected a single full redraw for the burst, got %d", screen.syncs)
+	}
+}
+
+func TestFitToHeightKeepsSelectionVisible(t *testing.T) {
+	state := &uiState{selected: 30, scrollOffset: 20}
+
+	state.fitToHeight(17) // 10 result rows
+	if state.scrollOffset != 21 {
+		t.Errorf("Expected scrollOffset 21 after shrinking, got %d", state.scrollOffset)
+	}
+
+	state.selected = 5
+	state.fitToHeight(40)
+	if state.scrollOffset != 5 {
+		t.Errorf("Expected scrollOffset 5 with the selection above the view, got %d", state.scrollOffset)
+	}
+}
+
+func TestHighlightRecentMarker(t *testing.T) {
+	screen := newTestScreen(t, 100, 20)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	view := displayView{
+		Matches: []fuzzy.Match{
+			{Str: "/work/active", Index: 0},
+			{Str: "/work/stale", Index: 1},
+			{Str: "/work/unreadable", Index: 2},
+		},
+		Selected:     -1,
+		TotalDirs:    3,
+		ScanComplete: true,
+		Config:       TUIConfig{HighlightRecent: 24 * time.Hour},
+		ModTimes: map[string]time.Time{
+			"/work/active": now.Add(-2 * time.Hour),
+			"/work/stale":  now.Add(-72 * time.Hour),
+		},
+		Now: now,
+	}
+	updateDisplayAsync(screen, view)
+
+	for y := 0; y < 20; y++ {
+		row := screenRow(screen, y)
+		switch {
+		case strings.Contains(row, "/work/active"):
+			if !strings.Contains(row, "active  *") {
+				t.Errorf("Recently modified directory should be marked: %q", row)
+			}
+		case strings.Contains(row, "/work/stale"), strings.Contains(row, "/work/unreadable"):
+			if strings.Contains(row, "*") {
+				t.Errorf("Directory should not be marked: %q", row)
+			}
+		}
+	}
+
+	view.Config.HighlightRecent = 0
+	updateDisplayAsync(screen, view)
+	for y := 0; y < 20; y++ {
+		if strings.Contains(screenRow(screen, y), "*") {
+			t.Errorf("No marker expected when disabled, row %d: %q", y, screenRow(screen, y))
+		}
+	}
+}
+
+func TestAgeStyle(t *testing.T) {
+	base := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+	thresholds := []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+	gray := func(level int32) tcell.Color { return tcell.NewRGBColor(level, level, level) }
+
+	testCases := []struct {
+		name  string
+		age   time.Duration
+		known bool
+		color tcell.Color
+		bold  bool
+	}{
+		{"JustNow", time.Minute, true, gray(255), true},
+		{"FirstThreshold", 24 * time.Hour, true, gray(255), true},
+		{"DaysOld", 3 * 24 * time.Hour, true, gray(200), false},
+		{"WeeksOld", 14 * 24 * time.Hour, true, gray(144), false},
+		{"Ancient", 400 * 24 * time.Hour, true, gray(88), false},
+		{"Unknown", 0, false, tcell.ColorWhite, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fg, _, attrs := ageStyle(base, tc.age, tc.known, thresholds).Decompose()
+			if fg != tc.color {
+				t.Errorf("Foreground %v, expected %v", fg, tc.color)
+			}
+			if bold := attrs&tcell.AttrBold != 0; bold != tc.bold {
+				t.Errorf("Bold %v, expected %v", bold, tc.bold)
+			}
+		})
+	}
+
+	if ageStyle(base, time.Minute, true, nil) != base {
+		t.Error("Expected the base style without thresholds")
+	}
+}
+
+func TestAutoSelectArming(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{
+		directories: []string{"/srv/api", "/srv/web", "/var/data"},
+		config:      TUIConfig{AutoSelect: time.Minute},
+	}
+	state.query = "api"
+	state.rematch()
+
+	state.checkAutoSelect()
+	if !state.autoAt.IsZero() {
+		t.Fatal("Should not arm while the scan is running")
+	}
+
+	state.scanComplete = true
+	state.checkAutoSelect()
+	if state.autoAt.IsZero() {
+		t.Fatal("Expected the countdown to arm on a lone match after the scan")
+	}
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, computeLayout(24, state.config).StatusY); !strings.Contains(row, "Selecting in 60s") {
+		t.Errorf("Expected a countdown in the status bar, got %q", row)
+	}
+
+	// Any key cancels, and the same query doesn't re-arm
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+	state.checkAutoSelect()
+	if !state.autoAt.IsZero() {
+		t.Error("A keypress should cancel the countdown for this query")
+	}
+
+	// Widening the query disarms, narrowing it to one match again re-arms
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyBackspace, 0, tcell.ModNone), state, screen)
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyBackspace, 0, tcell.ModNone), state, screen)
+	state.checkAutoSelect()
+	if !state.autoAt.IsZero() {
+		t.Errorf("Should not arm with %d matches", len(state.matches))
+	}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, 'p', tcell.ModNone), state, screen)
+	state.checkAutoSelect()
+	if state.autoAt.IsZero() {
+		t.Error("Expected the countdown to re-arm for a new single-match query")
+	}
+	state.cancelAutoSelect()
+}
+
+func TestAutoSelectCommitsAfterDelay(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+
+	dirChan := make(chan DirBatch, 1)
+	dirChan <- DirBatch{Directories: []string{"/srv/api", "/srv/web"}, Done: true}
+	close(dirChan)
+	screen.PostEvent(tcell.NewEventKey(tcell.KeyRune, 'w', tcell.ModNone))
+
+	result := make(chan string, 1)
+	go func() {
+		path, _ := runTUIOnScreen(context.Background(), screen, dirChan, TUIConfig{AutoSelect: 50 * time.Millisecond})
+		result <- path
+	}()
+
+	select {
+	case path := <-result:
+		if path != "/srv/web" {
+			t.Errorf("Expected /srv/web to be auto-selected, got %q", path)
+		}
+	case <-time.After(5 * time.Second):
+		screen.PostEvent(tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone))
+		t.Fatal("Auto-select did not fire")
+	}
+}
+
+func TestLockedPrimaryFilter(t *testing.T) {
+	screen := newTestScreen(t, 100, 20)
+	state := &uiState{
+		directories: []string{"/work/api/docs", "/work/api/src", "/work/web/docs", "/home/docs"},
+	}
+	state.rematch()
+
+	typeText := func(text string) {
+		for _, r := range text {
+			handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), state, screen)
+		}
+	}
+	press := func(key tcell.Key) {
+		handleKeyEventState(tcell.NewEventKey(key, 0, tcell.ModNone), state, screen)
+	}
+	paths := func() []string {
+		var out []string
+		for _, match := range state.matches {
+			out = append(out, match.Str)
+		}
+		return out
+	}
+
+	typeText("api")
+	press(tcell.KeyTab)
+	if state.locked != "api" || state.query != "" {
+		t.Fatalf("Expected api locked with an empty query, got locked=%q query=%q", state.locked, state.query)
+	}
+	if len(state.matches) != 2 {
+		t.Errorf("The locked filter alone should keep both api dirs, got %v", paths())
+	}
+
+	typeText("docs")
+	if got := paths(); len(got) != 1 || got[0] != "/work/api/docs" {
+		t.Errorf("Expected the AND of both terms, got %v", got)
+	}
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 0); !strings.Contains(row, "cdf > [api] docs_") {
+		t.Errorf("Expected the locked term in the prompt, got %q", row)
+	}
+
+	// Editing the secondary term leaves the primary alone
+	for range "docs" {
+		press(tcell.KeyBackspace)
+	}
+	if state.locked != "api" || len(state.matches) != 2 {
+		t.Errorf("Clearing the secondary term should keep the lock, got locked=%q %v", state.locked, paths())
+	}
+
+	// Backspace on an empty secondary unlocks back into the query
+	press(tcell.KeyBackspace)
+	if state.locked != "" || state.query != "api" {
+		t.Errorf("Expected api back in the query, got locked=%q query=%q", state.locked, state.query)
+	}
+}
+
+func TestAcceptQueryOnNoMatches(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.Mkdir(filepath.Join(home, "fresh"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+
+	state := &uiState{query: "~/fresh", config: TUIConfig{AcceptQuery: true}}
+	if path, err := state.commitSelection(); err != nil || path != filepath.Join(home, "fresh") {
+		t.Errorf("Expected the typed directory, got %q, %v", path, err)
+	}
+
+	state.query = "~/missing"
+	if _, err := state.commitSelection(); err == nil {
+		t.Error("A query that isn't a directory should still cancel")
+	}
+
+	state.query = "~/fresh"
+	state.config.AcceptQuery = false
+	if _, err := state.commitSelection(); err == nil {
+		t.Error("Without --accept-query an empty match list should cancel")
+	}
+}
+
+func TestGroupedRowsSkipHeaders(t *testing.T) {
+	screen := newTestScreen(t, 100, 14) // 7 result rows
+	state := &uiState{
+		directories: []string{
+			"/home/me/api/src", "/home/me/web/src", "/home/me/api/docs",
+			"/usr/share/api", "/home/me/api", "/home/me/web",
+		},
+		config: TUIConfig{Group: true, Root: "/home/me"},
+	}
+	state.rematch()
+
+	view := state.view()
+	rows := view.resultRows(7)
+	var headers []string
+	for _, row := range rows {
+		if row.Match < 0 {
+			headers = append(headers, row.Header)
+		}
+	}
+	if strings.Join(headers, ",") != "/home/me/api,/home/me/web" {
+		t.Errorf("Unexpected headers in the first window: %v", headers)
+	}
+
+	// Navigation moves between matches only, never onto a header
+	for i := 0; i < len(state.matches)-1; i++ {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+	}
+	if state.matches[state.selected].Str != "/usr/share/api" {
+		t.Errorf("Expected the last match selected, got %s", state.matches[state.selected].Str)
+	}
+
+	updateDisplayAsync(screen, state.view())
+	found := false
+	for y := 0; y < 14; y++ {
+		row := screenRow(screen, y)
+		if strings.Contains(row, "▶") && strings.Contains(row, "/usr/share/api") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Headers pushed the selection out of view")
+	}
+}
+
+func TestRemoveSelectedDirectory(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{
+		directories: []string{"/work/api", "/work/api-old", "/work/web"},
+	}
+	state.query = "api"
+	state.rematch()
+	state.selected = 1
+	removed := state.matches[1].Str
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlX, 0, tcell.ModNone), state, screen)
+	for _, match := range state.matches {
+		if match.Str == removed {
+			t.Fatalf("%s still listed after removal", removed)
+		}
+	}
+	if len(state.matches) != 1 || state.selected != 0 {
+		t.Errorf("Expected one match with the selection clamped, got %d matches, selected %d", len(state.matches), state.selected)
+	}
+
+	// Re-querying must not bring it back
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyBackspace, 0, tcell.ModNone), state, screen)
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, 'i', tcell.ModNone), state, screen)
+	state.query = ""
+	state.rematch()
+	for _, match := range state.matches {
+		if match.Str == removed {
+			t.Errorf("%s reappeared after a re-query", removed)
+		}
+	}
+	if len(state.matches) != 2 {
+		t.Errorf("Expected the two remaining directories, got %d", len(state.matches))
+	}
+	if len(state.directories) != 3 {
+		t.Error("Removal should not touch the scanned directory list")
+	}
+}
+
+func TestBreadcrumbPicksParentSegment(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	state := &uiState{
+		directories: []string{"/srv/app/src/api", "/srv/web"},
+		config:      TUIConfig{Breadcrumb: true},
+	}
+	state.rematch()
+	layout := computeLayout(24, state.config)
+	if layout.BreadcrumbY != layout.ResultsY+layout.MaxDisplay || layout.MaxDisplay != computeLayout(24, TUIConfig{}).MaxDisplay-1 {
+		t.Fatalf("Expected the breadcrumb on the last result row, got %+v", layout)
+	}
+
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, layout.BreadcrumbY); !strings.Contains(row, "/ › srv › app › src › api") {
+		t.Errorf("Expected the selection's segments on the breadcrumb row, got %q", row)
+	}
+
+	// Two segments up, and no further than the top
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModNone), state, screen)
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModNone), state, screen)
+	if path, err := state.commitSelection(); err != nil || path != "/srv/app" {
+		t.Errorf("Expected Enter to select the picked /srv/app, got %q, %v", path, err)
+	}
+	for i := 0; i < 10; i++ {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModNone), state, screen)
+	}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModNone), state, screen)
+	if path, _ := state.commitSelection(); path != "/srv" {
+		t.Errorf("Expected the cursor to stop at / and come back to /srv, got %q", path)
+	}
+
+	// Moving the selection starts over at the new selection itself
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), state, screen)
+	if path, _ := state.commitSelection(); path != "/srv/web" {
+		t.Errorf("Expected the new selection itself, got %q", path)
+	}
+}
+
+func TestHideAncestorsOfSelection(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{
+		directories: []string{"/work", "/work/app", "/work/app/src", "/work/app/docs", "/work/app/src/api", "/work/application"},
+	}
+	state.query = "app"
+	state.rematch()
+	listed := func() map[string]bool {
+		paths := make(map[string]bool)
+		for _, match := range state.matches {
+			paths[match.Str] = true
+		}
+		return paths
+	}
+	for i, match := range state.matches {
+		if match.Str == "/work/app/src" {
+			state.selected = i
+		}
+	}
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlA, 0, tcell.ModNone), state, screen)
+	paths := listed()
+	if paths["/work/app"] {
+		t.Errorf("Ancestor /work/app still listed: %v", paths)
+	}
+	for _, kept := range []string{"/work/app/src", "/work/app/docs", "/work/app/src/api", "/work/application"} {
+		if !paths[kept] {
+			t.Errorf("Expected %s to stay listed, got %v", kept, paths)
+		}
+	}
+	if state.matches[state.selected].Str != "/work/app/src" {
+		t.Errorf("Expected the selection to stay on /work/app/src, got %s", state.matches[state.selected].Str)
+	}
+
+	// Typing keeps them hidden; the key again brings them back
+	state.query = ""
+	state.rematch()
+	if paths := listed(); paths["/work"] || paths["/work/app"] || len(paths) != 4 {
+		t.Errorf("Expected the ancestors to stay hidden across queries, got %v", paths)
+	}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlA, 0, tcell.ModNone), state, screen)
+	if paths := listed(); !paths["/work"] || !paths["/work/app"] {
+		t.Errorf("Expected the ancestors back after toggling, got %v", paths)
+	}
+}
+
+func TestMultibyteQueryEditing(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	state := &uiState{directories: []string{"/home/проект", "/home/日本語", "/home/cafe\u0301"}}
+	state.rematch()
+
+	typeText := func(text string) {
+		for _, r := range text {
+			handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone), state, screen)
+		}
+	}
+	backspace := func() {
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone), state, screen)
+	}
+
+	typeText("проект")
+	backspace()
+	if state.query != "проек" {
+		t.Errorf("Backspace should drop one rune, got %q", state.query)
+	}
+	if len(state.matches) != 1 || state.matches[0].Str != "/home/проект" {
+		t.Errorf("Expected the Cyrillic directory to still match, got %+v", state.matches)
+	}
+	for range "проек" {
+		backspace()
+	}
+	if state.query != "" {
+		t.Errorf("Expected an empty query, got %q", state.query)
+	}
+
+	// A combining accent is its own rune
+	typeText("cafe\u0301")
+	backspace()
+	if state.query != "cafe" {
+		t.Errorf("Expected the combining mark removed, got %q", state.query)
+	}
+}
+
+func TestWideCharacterPrompt(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	updateDisplayAsync(screen, displayView{Query: "日本", TotalDirs: 0, ScanComplete: true})
+
+	// "  cdf > " is 8 columns and each CJK character takes two more
+	for x, expected := range map[int]rune{8: '日', 10: '本', 12: '_'} {
+		if r, _, _, _ := screen.GetContent(x, 0); r != expected {
+			t.Errorf("Column %d = %q, expected %q", x, r, expected)
+		}
+	}
+
+	updateDisplayAsync(screen, displayView{Query: "cafe\u0301", TotalDirs: 0, ScanComplete: true})
+	r, combining, _, _ := screen.GetContent(11, 0)
+	if r != 'e' || len(combining) != 1 || combining[0] != '\u0301' {
+		t.Errorf("Expected the accent combined onto e, got %q %q", r, combining)
+	}
+	if r, _, _, _ := screen.GetContent(12, 0); r != '_' {
+		t.Errorf("Expected the cursor right after the accented e, got %q", r)
+	}
+}
+
+func TestEmptyScanGuidance(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	resultText := func() string {
+		var rows []string
+		for y := 0; y < 24; y++ {
+			rows = append(rows, screenRow(screen, y))
+		}
+		return strings.Join(rows, "\n")
+	}
+
+	// A finished scan with no directories at all gets remedies
+	updateDisplayAsync(screen, displayView{ScanComplete: true})
+	text := resultText()
+	for _, hint := range []string{"No directories found", "--no-ignore", "--depth"} {
+		if !strings.Contains(text, hint) {
+			t.Errorf("Expected %q in the empty-scan guidance", hint)
+		}
+	}
+
+	// No matches for a query is a different situation
+	updateDisplayAsync(screen, displayView{Query: "zzz", TotalDirs: 50, ScanComplete: true})
+	if strings.Contains(resultText(), "--no-ignore") {
+		t.Error("Guidance should not appear when directories exist but don't match")
+	}
+
+	// Nor while the scan is still running
+	updateDisplayAsync(screen, displayView{})
+	if strings.Contains(resultText(), "--no-ignore") {
+		t.Error("Guidance should wait for the scan to complete")
+	}
+
+	updateDisplayAsync(screen, displayView{ScanComplete: true, Config: TUIConfig{EmptyMessage: "Nothing here\nRun make setup first"}})
+	text = resultText()
+	if !strings.Contains(text, "Nothing here") || !strings.Contains(text, "Run make setup first") || strings.Contains(text, "--no-ignore") {
+		t.Errorf("Expected the custom message instead of the default, got:\n%s", text)
+	}
+}
+
+func TestDeepenKey(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+
+	var requested []int
+	deeper := map[int][]string{2: {"/r/a/b/c"}, 3: {"/r/a/b/c/d"}}
+	state := &uiState{
+		directories:  []string{"/r/a", "/r/a/b"},
+		scanComplete: true,
+		depth:        1,
+		scanCtx:      context.Background(),
+		config: TUIConfig{
+			Depth: 1,
+			Deepen: func(ctx context.Context, depth int) <-chan DirBatch {
+				requested = append(requested, depth)
+				ch := make(chan DirBatch, 1)
+				ch <- DirBatch{Directories: deeper[depth], Done: true}
+				close(ch)
+				return ch
+			},
+		},
+	}
+	state.rematch()
+
+	waitForDirs := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			state.mu.RLock()
+			done := len(state.directories) == n && state.scanComplete
+			state.mu.RUnlock()
+			if done {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for %d directories", n)
+	}
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlD, 0, tcell.ModNone), state, screen)
+	waitForDirs(3)
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlD, 0, tcell.ModNone), state, screen)
+	waitForDirs(4)
+
+	if fmt.Sprint(requested) != "[2 3]" {
+		t.Errorf("Expected passes for depths 2 and 3, got %v", requested)
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.statusMsg = "" // Show the regular status line
+	if len(state.matches) != 4 {
+		t.Errorf("Expected the deeper directories merged into the matches, got %d", len(state.matches))
+	}
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, computeLayout(24, state.config).StatusY); !strings.Contains(row, "depth 3") {
+		t.Errorf("Expected the current depth in the status bar, got %q", row)
+	}
+}
+
+func TestDeepenWithNoDeeperDirectories(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	state := &uiState{
+		directories:  []string{"/r/a"},
+		scanComplete: true,
+		scanCtx:      context.Background(),
+		config: TUIConfig{
+			Deepen: func(ctx context.Context, depth int) <-chan DirBatch {
+				// Nothing new locally, as an older scan would report it
+				ch := make(chan DirBatch, 2)
+				ch <- DirBatch{LocalEmpty: true}
+				ch <- DirBatch{Done: true}
+				close(ch)
+				return ch
+			},
+		},
+	}
+	state.rematch()
+
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlD, 0, tcell.ModNone), state, screen)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state.mu.RLock()
+		done := state.scanComplete
+		state.mu.RUnlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the deepen scan")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	updateDisplayAsync(screen, state.view())
+	for y := 0; y < 24; y++ {
+		if row := screenRow(screen, y); strings.Contains(row, "None local") {
+			t.Errorf("Local results are listed, yet row %d says %q", y, row)
+		}
+	}
+}
+
+func TestEscapeModes(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	escape := tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone)
+
+	t.Run("Cancel", func(t *testing.T) {
+		state := &uiState{query: "api", config: TUIConfig{EscapeMode: escapeCancel}}
+		if result := handleKeyEventState(escape, state, screen); result != -1 {
+			t.Errorf("Escape should cancel immediately, got %d", result)
+		}
+	})
+
+	t.Run("ClearThenCancel", func(t *testing.T) {
+		state := &uiState{
+			directories: []string{"/srv/api", "/srv/web"},
+			config:      TUIConfig{EscapeMode: escapeClearThenCancel},
+		}
+		state.query = "api"
+		state.rematch()
+
+		if result := handleKeyEventState(escape, state, screen); result != 0 {
+			t.Fatalf("First Escape should not cancel, got %d", result)
+		}
+		if state.query != "" || len(state.matches) != 2 {
+			t.Errorf("Expected the query cleared and all directories back, got %q with %d matches", state.query, len(state.matches))
+		}
+		if result := handleKeyEventState(escape, state, screen); result != -1 {
+			t.Errorf("Second Escape on the empty query should cancel, got %d", result)
+		}
+
+		state.query = "web"
+		if result := handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlQ, 0, tcell.ModNone), state, screen); result != -1 {
+			t.Errorf("Ctrl+Q should always cancel, got %d", result)
+		}
+	})
+}
+
+func TestPreviewPaneRendering(t *testing.T) {
+	screen := newTestScreen(t, 100, 20)
+	updateDisplayAsync(screen, displayView{
+		Matches:      testMatches(3),
+		TotalDirs:    3,
+		ScanComplete: true,
+		Preview:      "total 8\ndrwxr-xr-x src",
+		Config:       TUIConfig{PreviewCmd: "ls -la {}"},
+	})
+
+	layout := computeLayout(20, TUIConfig{})
+	first := screenRow(screen, layout.ResultsY)
+	if !strings.Contains(first, "/dir/000") || !strings.Contains(first, "│ total 8") {
+		t.Errorf("Expected the match and the preview side by side, got %q", first)
+	}
+	if second := screenRow(screen, layout.ResultsY+1); !strings.Contains(second, "drwxr-xr-x src") {
+		t.Errorf("Expected the second preview line, got %q", second)
+	}
+}
+
+func TestLocalEmptyMessages(t *testing.T) {
+	screen := newTestScreen(t, 80, 20)
+	updateDisplayAsync(screen, displayView{ScanComplete: true, Config: TUIConfig{LocalOnly: true}})
+
+	layout := computeLayout(20, TUIConfig{})
+	if row := screenRow(screen, layout.ResultsY); !strings.Contains(row, "No directories below the starting path") {
+		t.Errorf("Expected the local-only guidance, got %q", row)
+	}
+
+	// In a two-phase scan the info panel flags global-only results
+	state := &uiState{config: TUIConfig{}}
+	state.consume(DirBatch{LocalEmpty: true})
+	state.consume(DirBatch{Directories: []string{"/srv/app"}, Done: true})
+	updateDisplayAsync(screen, state.view())
+	if row := screenRow(screen, 3); !strings.Contains(row, "None local") {
+		t.Errorf("Expected the info panel to flag the empty local phase, got %q", row)
+	}
+}
+
+func TestInterleaveKeepsLocalMatchesFirst(t *testing.T) {
+	state := &uiState{query: "api", config: TUIConfig{SortMode: sortInterleave}}
+	state.consume(DirBatch{Directories: []string{"/home/me/work/x/my-ap-i", "/home/me/work/api-v1-old"}})
+	state.consume(DirBatch{Directories: []string{"/api", "/srv/api", "/opt/api"}, Global: true, Done: true})
+
+	if len(state.matches) != 5 {
+		t.Fatalf("Expected 5 matches, got %d", len(state.matches))
+	}
+	// Global matches score higher here, but must still come after local ones
+	for i, match := range state.matches {
+		isLocal := strings.HasPrefix(match.Str, "/home/me/work/")
+		if isLocal != (i < 2) {
+			t.Errorf("Match %d %s is out of phase order: %v", i, match.Str, state.matches)
+		}
+	}
+	if state.matches[2].Score <= state.matches[0].Score {
+		t.Errorf("Expected the fixture's best global match to outscore the local ones: %v", state.matches)
+	}
+}
+
+func TestGroupHeadersShowCounts(t *testing.T) {
+	state := &uiState{config: TUIConfig{Group: true, GroupCounts: true, Root: "/work"}}
+	state.consume(DirBatch{Directories: []string{"/work/api/a", "/work/api/b", "/work/web/c", "/srv/x"}, Done: true})
+
+	screen := newTestScreen(t, 80, 20)
+	updateDisplayAsync(screen, state.view())
+
+	var headers []string
+	for y := 0; y < 20; y++ {
+		if row := screenRow(screen, y); strings.Contains(row, "── /") {
+			headers = append(headers, strings.TrimSpace(strings.Split(row, "║")[0]))
+		}
+	}
+	expected := []string{"── /work/api (2) ──", "── /work/web (1) ──", "── /srv (1) ──"}
+	if strings.Join(headers, "|") != strings.Join(expected, "|") {
+		t.Errorf("Headers = %q, expected %q", headers, expected)
+	}
+}
+
+func TestSampledIndicatorInStatusBar(t *testing.T) {
+	screen := newTestScreen(t, 100, 20)
+	layout := computeLayout(20, TUIConfig{})
+	view := displayView{Matches: testMatches(3), TotalDirs: 200000, Sampled: true}
+
+	updateDisplayAsync(screen, view)
+	if status := screenRow(screen, layout.StatusY); !strings.Contains(status, "~approx") {
+		t.Errorf("Expected the approximate indicator while sampled, got %q", status)
+	}
+
+	view.Sampled = false
+	updateDisplayAsync(screen, view)
+	if status := screenRow(screen, layout.StatusY); strings.Contains(status, "~approx") {
+		t.Errorf("Expected the indicator to clear after a full match, got %q", status)
+	}
+}
+
+func TestBrowseOrders(t *testing.T) {
+	directories := []string{"/srv/web/static", "/opt", "/srv/api", "/home/me", "/a/b/c/d"}
+	frecency := map[string]float64{"/srv/api": 1, "/a/b/c/d": 0.5}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{browseWalk, directories},
+		{"", directories},
+		{browseAlpha, []string{"/a/b/c/d", "/home/me", "/opt", "/srv/api", "/srv/web/static"}},
+		{browseDepth, []string{"/opt", "/srv/api", "/home/me", "/srv/web/static", "/a/b/c/d"}},
+		{browseFrecency, []string{"/srv/api", "/a/b/c/d", "/srv/web/static", "/opt", "/home/me"}},
+		{browseShuffle, []string{"/srv/web/static", "/home/me", "/opt", "/a/b/c/d", "/srv/api"}},
+	}
+	for _, test := range tests {
+		state := &uiState{config: TUIConfig{BrowseOrder: test.order, Frecency: frecency, FrecencyWeight: 10, ShuffleSeed: 42}}
+		state.consume(DirBatch{Directories: directories, Done: true})
+
+		var got []string
+		for _, match := range state.matches {
+			got = append(got, match.Str)
+		}
+		if strings.Join(got, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Order %q: got %v, expected %v", test.order, got, test.expected)
+		}
+
+		// Typing switches to fuzzy ranking
+		state.query = "api"
+		state.rematch()
+		if len(state.matches) == 0 || state.matches[0].Str != "/srv/api" {
+			t.Errorf("Order %q: expected /srv/api to lead once a query is typed, got %v", test.order, state.matches)
+		}
+	}
+}
+
+func TestShuffleIsSeededAndSteady(t *testing.T) {
+	directories := make([]string, 40)
+	for i := range directories {
+		directories[i] = fmt.Sprintf("/dir/%02d", i)
+	}
+	shuffled := func(seed int64, batches ...[]string) string {
+		state := &uiState{config: TUIConfig{BrowseOrder: browseShuffle, ShuffleSeed: seed}}
+		for _, batch := range batches {
+			state.consume(DirBatch{Directories: batch})
+		}
+		var got []string
+		for _, match := range state.matches {
+			got = append(got, match.Str)
+		}
+		return strings.Join(got, " ")
+	}
+
+	first := shuffled(7, directories)
+	if first != shuffled(7, directories) {
+		t.Error("The same seed gave a different order")
+	}
+	if first == strings.Join(directories, " ") || first == shuffled(8, directories) {
+		t.Error("Expected the seed to pick a shuffled order of its own")
+	}
+	// Directories arriving later slot in without reshuffling the rest
+	if got := shuffled(7, directories[:25], directories[25:]); got != first {
+		t.Errorf("Order changed as batches arrived:\n%s\nexpected\n%s", got, first)
+	}
+}
+
+func TestReloadPicksUpIgnoreFileChanges(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	for _, dir := range []string{"app/src", "scratch/tmp", "docs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	scan := func(ctx context.Context, useIgnore bool) (<-chan DirBatch, int, error) {
+		patterns, err := loadIgnorePatterns(root, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		return scanWithConfigCtx(ctx, ScanConfig{
+			Root:              root,
+			MaxDepth:          5,
+			UseIgnorePatterns: useIgnore,
+			IgnorePatterns:    patterns,
+			InitialBatchSize:  10,
+			MaxBatchSize:      10,
+		}), len(patterns), nil
+	}
+
+	screen := newTestScreen(t, 80, 20)
+	state := &uiState{scanCtx: context.Background(), config: TUIConfig{Reload: scan}}
+	first, _, _ := scan(context.Background(), true)
+	for batch := range first {
+		state.consume(batch)
+	}
+	if len(state.directories) != 5 {
+		t.Fatalf("Expected all 5 directories before ignoring anything, got %v", state.directories)
+	}
+
+	// Edit the ignore file mid-session, then reload with Ctrl+R
+	if err := os.WriteFile(filepath.Join(root, ignoreFileName), []byte("scratch\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .cdfignore: %v", err)
+	}
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlR, 0, tcell.ModCtrl), state, screen)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state.mu.RLock()
+		complete, dirs, status := state.scanComplete, append([]string(nil), state.directories...), state.statusMsg
+		state.mu.RUnlock()
+		if complete {
+			for _, dir := range dirs {
+				if strings.Contains(dir, "scratch") {
+					t.Errorf("Reloaded scan still lists %s", dir)
+				}
+			}
+			if len(dirs) != 3 {
+				t.Errorf("Expected app, app/src and docs after the reload, got %v", dirs)
+			}
+			if !strings.Contains(status, "Reloaded 1 ignore patterns") {
+				t.Errorf("Expected the reload confirmation with the pattern count, got %q", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Reloaded scan did not complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReposOnlyShowsRepositoryRoots(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"api/.git", "api/internal", "web/.git/refs", "notes/2024", "tools/lint/.git"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	state := &uiState{config: TUIConfig{ReposOnly: true}}
+	for batch := range scanWithConfig(ScanConfig{
+		Root:              root,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  2,
+		MaxBatchSize:      2,
+		DetectRepos:       true,
+	}) {
+		state.consume(batch)
+	}
+
+	got := make(map[string]bool)
+	for _, match := range state.matches {
+		got[match.Str] = true
+	}
+	for _, dir := range []string{"api", "web", "tools/lint"} {
+		if !got[filepath.Join(root, dir)] {
+			t.Errorf("Expected repository root %s in the matches", dir)
+		}
+	}
+	if len(state.matches) != 3 {
+		t.Errorf("Expected only the 3 repository roots, got %v", state.matches)
+	}
+
+	// Typing still narrows the repositories down
+	state.query = "lint"
+	state.rematch()
+	if len(state.matches) != 1 || state.matches[0].Str != filepath.Join(root, "tools/lint") {
+		t.Errorf("Expected tools/lint alone for \"lint\", got %v", state.matches)
+	}
+}
+
+// finiScreen records whether the terminal was restored
+type finiScreen struct {
+	tcell.SimulationScreen
+	finished bool
+}
+
+func (s *finiScreen) Fini() {
+	s.finished = true
+	s.SimulationScreen.Fini()
+}
+
+func TestMaxRuntimeExitsAndRestoresScreen(t *testing.T) {
+	screen := &finiScreen{SimulationScreen: tcell.NewSimulationScreen("")}
+	original := newScreen
+	newScreen = func() (tcell.Screen, error) { return screen, nil }
+	defer func() { newScreen = original }()
+
+	// The scan never finishes and no key is pressed
+	dirChan := make(chan DirBatch, 1)
+	dirChan <- DirBatch{Directories: []string{"/srv/app"}}
+
+	budget := 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := runTUIWithConfigCtx(ctx, dirChan, TUIConfig{})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < budget {
+			t.Errorf("Exited after %v, before the %v budget", elapsed, budget)
+		}
+		if !screen.finished {
+			t.Error("Screen was not restored on the deadline")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Finder kept running past its runtime budget")
+	}
+}
+
+func TestRendererSelectionMatchesFullRedraw(t *testing.T) {
+	matches := testMatches(50)
+	view := displayView{
+		Matches:      matches,
+		TotalDirs:    50,
+		ScanComplete: true,
+		PrevCount:    -1,
+		Pinned:       map[string]bool{"/dir/002": true},
+	}
+
+	// Both screens get the base style the finder sets, which full redraws
+	// clear to
+	base := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+	targeted := newTestScreen(t, 80, 24)
+	targeted.SetStyle(base)
+	var frames renderer
+	frames.render(targeted, view)
+	for _, selected := range []int{1, 2, 5, 4, 0} {
+		view.Selected = selected
+		frames.render(targeted, view)
+
+		full := newTestScreen(t, 80, 24)
+		full.SetStyle(base)
+		updateDisplayAsync(full, view)
+		// Compare what reaches the terminal, where unstyled cells take the
+		// screen's style
+		targeted.Show()
+		full.Show()
+		got, _, _ := targeted.GetContents()
+		want, _, _ := full.GetContents()
+		for y := 0; y < 24; y++ {
+			for x := 0; x < 80; x++ {
+				if !reflect.DeepEqual(got[y*80+x], want[y*80+x]) {
+					t.Fatalf("Selection %d: cell (%d,%d) differs from a full redraw\ngot  %q\nwant %q", selected, x, y, screenRow(targeted, y), screenRow(full, y))
+				}
+			}
+		}
+	}
+}
+
+func TestRendererRedrawsFullyWhenMoreThanSelectionChanges(t *testing.T) {
+	screen := newTestScreen(t, 80, 24)
+	view := displayView{Matches: testMatches(10), TotalDirs: 10, ScanComplete: true, PrevCount: -1}
+	var frames renderer
+	frames.render(screen, view)
+
+	view.Selected = 1
+	view.Query = "d"
+	frames.render(screen, view)
+	if !strings.Contains(screenRow(screen, 0), "cdf > d_") {
+		t.Errorf("Prompt not redrawn after the query changed, got %q", screenRow(screen, 0))
+	}
+}
+
+func TestMatchSymlinkTargets(t *testing.T) {
+	root, elsewhere := t.TempDir(), t.TempDir()
+	target := filepath.Join(elsewhere, "quasar-engine")
+	if err := os.MkdirAll(filepath.Join(root, "work"), 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	link := filepath.Join(root, "work", "nebula")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	find := func(config TUIConfig, query string) []string {
+		state := &uiState{config: config}
+		for batch := range scanWithConfig(ScanConfig{
+			Root:              root,
+			MaxDepth:          5,
+			UseIgnorePatterns: true,
+			InitialBatchSize:  10,
+			MaxBatchSize:      10,
+			SymlinkTargets:    true,
+		}) {
+			state.consume(batch)
+		}
+		state.query = query
+		state.rematch()
+		var found []string
+		for _, match := range state.matches {
+			found = append(found, match.Str)
+		}
+		return found
+	}
+
+	for _, query := range []string{"nebula", "quasar"} {
+		found := find(TUIConfig{MatchTargets: true}, query)
+		if len(found) != 1 || found[0] != link {
+			t.Errorf("Query %q: expected the symlink path %s alone, got %v", query, link, found)
+		}
+	}
+	if found := find(TUIConfig{}, "quasar"); len(found) != 0 {
+		t.Errorf("Target matched without MatchTargets: %v", found)
+	}
+}
+
+func TestShowIgnoredCount(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"app/node_modules/left-pad", "app/src", "lib/.git", "lib/build", "docs"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	state := &uiState{config: TUIConfig{ShowIgnored: true}}
+	for batch := range scanWithConfig(ScanConfig{
+		Root:              root,
+		MaxDepth:          5,
+		UseIgnorePatterns: true,
+		InitialBatchSize:  1,
+		MaxBatchSize:      1,
+	}) {
+		state.consume(batch)
+	}
+	// node_modules, .git and build; left-pad is never reached
+	if state.ignored != 3 {
+		t.Errorf("Ignored count = %d, expected 3", state.ignored)
+	}
+
+	screen := newTestScreen(t, 100, 24)
+	updateDisplayAsync(screen, state.view())
+	layout := computeLayout(24, state.config)
+	if status := screenRow(screen, layout.StatusY); !strings.Contains(status, "(3 ignored)") {
+		t.Errorf("Status bar %q does not show the ignored count", status)
+	}
+
+	state.config.ShowIgnored = false
+	updateDisplayAsync(screen, state.view())
+	if status := screenRow(screen, layout.StatusY); strings.Contains(status, "ignored") {
+		t.Errorf("Ignored count shown without ShowIgnored: %q", status)
+	}
+}
+
+func TestFocusScanInjectsDescendants(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"proj/src/pkg/deep", "other/x/y"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+	screen := newTestScreen(t, 100, 24)
+
+	var scannedRoot string
+	state := &uiState{
+		scanCtx: context.Background(),
+		config: TUIConfig{
+			FocusScan: func(ctx context.Context, dir string) <-chan DirBatch {
+				scannedRoot = dir
+				return scanWithConfigCtx(ctx, ScanConfig{Root: dir, MaxDepth: 10, InitialBatchSize: 10, MaxBatchSize: 10})
+			},
+		},
+	}
+	// The regular scan stopped three levels down
+	for batch := range scanWithConfig(ScanConfig{Root: root, MaxDepth: 2, InitialBatchSize: 10, MaxBatchSize: 10}) {
+		state.consume(batch)
+	}
+	if len(state.directories) != 6 {
+		t.Fatalf("Expected 6 directories from the shallow scan, got %v", state.directories)
+	}
+
+	state.query = "proj/src"
+	state.rematch()
+	handleKeyEventState(tcell.NewEventKey(tcell.KeyCtrlF, 0, tcell.ModNone), state, screen)
+	if scannedRoot != filepath.Join(root, "proj", "src") {
+		t.Fatalf("Expected a scan below the selection, got %q", scannedRoot)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		state.mu.RLock()
+		done := state.scanComplete
+		state.mu.RUnlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the focused scan")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	got := strings.Join(state.directories, " ")
+	for _, dir := range []string{"proj/src/pkg", "proj/src/pkg/deep"} {
+		if strings.Count(got+" ", filepath.Join(root, dir)+" ") != 1 {
+			t.Errorf("Expected %s merged in once, got %v", dir, state.directories)
+		}
+	}
+	if len(state.directories) != 7 {
+		t.Errorf("Expected the one unseen descendant and nothing else, got %v", state.directories)
+	}
+}
+
+func TestCollapseChainsShowsEndpoints(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"chain/b/c/d", "fork/left", "fork/right/only"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir: %v", err)
+		}
+	}
+
+	state := &uiState{config: TUIConfig{CollapseChains: true}}
+	for batch := range scanWithConfig(ScanConfig{
+		Root:             root,
+		MaxDepth:         5,
+		InitialBatchSize: 2,
+		MaxBatchSize:     2,
+	}) {
+		state.consume(batch)
+	}
+
+	// chain, chain/b and chain/b/c each lead to one subdirectory only, as
+	// does fork/right; fork branches
+	var got []string
+	for _, match := range state.matches {
+		got = append(got, strings.TrimPrefix(match.Str, root+"/"))
+	}
+	sort.Strings(got)
+	expected := []string{"chain/b/c/d", "fork", "fork/left", "fork/right/only"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the collapsed list %q, got %q", expected, got)
+	}
+
+	// Searching keeps the links hidden; the endpoint matches by its real path
+	state.query = "chain"
+	state.rematch()
+	found := false
+	for _, match := range state.matches {
+		if state.children[match.Str] == 1 {
+			t.Errorf("Expected chain link %s to stay hidden while searching", match.Str)
+		}
+		found = found || match.Str == filepath.Join(root, "chain/b/c/d")
+	}
+	if !found {
+		t.Errorf("Expected the chain's endpoint among the matches, got %v", state.matches)
+	}
+}
+
+func TestNumberSelectPicksVisibleResult(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	var directories []string
+	for i := 0; i < 30; i++ {
+		directories = append(directories, fmt.Sprintf("/srv/app%02d", i))
+	}
+	state := &uiState{directories: directories, config: TUIConfig{NumberSelect: true}}
+	state.rematch()
+
+	// Numbers follow what is on screen, so they shift with the scroll
+	state.selected, state.scrollOffset = 12, 10
+	updateDisplayAsync(screen, state.view())
+	layout := computeLayout(24, state.config)
+	for n := 1; n <= 9; n++ {
+		row := screenRow(screen, layout.ResultRow(n-1))
+		if !strings.HasPrefix(row, fmt.Sprintf("%d", n)) || !strings.Contains(row, state.matches[9+n].Str) {
+			t.Errorf("Expected row %d to be numbered %d with %s, got %q", n-1, n, state.matches[9+n].Str, row)
+		}
+	}
+	if row := screenRow(screen, layout.ResultRow(9)); !strings.HasPrefix(row, "  ") {
+		t.Errorf("Expected the tenth visible row to be unnumbered, got %q", row)
+	}
+
+	if action := handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, '3', tcell.ModAlt), state, screen); action != 1 {
+		t.Errorf("Expected Alt+3 to select right away, got action %d", action)
+	}
+	if path, _ := state.commitSelection(); path != state.matches[12].Str {
+		t.Errorf("Expected Alt+3 to pick the third visible result %s, got %s", state.matches[12].Str, path)
+	}
+
+	// Plain digits still type, and a number past the results does nothing
+	if action := handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, '2', tcell.ModNone), state, screen); action != 0 || state.query != "2" {
+		t.Errorf("Expected a plain 2 to type into the query, got action %d and query %q", action, state.query)
+	}
+	state.query = "app29"
+	state.rematch()
+	if action := handleKeyEventState(tcell.NewEventKey(tcell.KeyRune, '5', tcell.ModAlt), state, screen); action != 0 {
+		t.Errorf("Expected Alt+5 with fewer results to do nothing, got action %d", action)
+	}
+}
+
+func TestMatchAbbrevFindsShorthand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	webapp := filepath.Join(home, "projects/webapp/src")
+	directories := []string{
+		filepath.Join(home, "projects/webapp"),
+		webapp,
+		filepath.Join(home, "projects/website/assets"),
+		filepath.Join(home, "scratch"),
+	}
+
+	// Full names and shorthand both find it
+	for _, query := range []string{"webapp", "w/s", "~/p/w/s"} {
+		state := &uiState{config: TUIConfig{MatchAbbrev: true}}
+		state.addDirectories(directories)
+		state.query = query
+		state.rematch()
+		found := false
+		for _, match := range state.matches {
+			found = found || match.Str == webapp
+		}
+		if !found {
+			t.Errorf("Query %q: expected %s among the matches, got %v", query, webapp, state.matches)
+		}
+	}
+
+	// Only the abbreviated form has ~/p/w/s in it
+	state := &uiState{}
+	state.addDirectories(directories)
+	state.query = "~/p/w/s"
+	state.rematch()
+	if len(state.matches) != 0 {
+		t.Errorf("Expected no match for ~/p/w/s without MatchAbbrev, got %v", state.matches)
+	}
+}
+
+func TestEnterCommitsSelectionDrawnBeforeFinalBatch(t *testing.T) {
+	screen := newTestScreen(t, 100, 24)
+	var frames renderer
+	state := &uiState{query: "app", prevCount: -1}
+	state.consume(DirBatch{Directories: []string{"/srv/data/zeta-app-files"}})
+	state.drawFrame(screen, &frames)
+
+	// The final batch lands between the frame and Enter, ranking a better
+	// match into the selected slot; another arrives before the commit
+	state.mu.Lock()
+	state.consume(DirBatch{Directories: []string{"/app"}, Done: true})
+	state.mu.Unlock()
+	if state.matches[0].Str != "/app" {
+		t.Fatalf("Expected the final batch to take the top slot, got %v", state.matches)
+	}
+	if action := handleKeyEventState(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), state, screen); action != 1 {
+		t.Fatalf("Expected Enter to select, got action %d", action)
+	}
+	state.mu.Lock()
+	state.consume(DirBatch{Directories: []string{"/apps"}, Done: true})
+	state.mu.Unlock()
+	if path, err := state.commitSelection(); err != nil || path != "/srv/data/zeta-app-files" {
+		t.Errorf("Expected the drawn selection to be committed, got %q, %v", path, err)
+	}
+
+	// Under concurrent batches the commit is always the row last drawn
+	for run := 0; run < 50; run++ {
+		state := &uiState{query: "app", prevCount: -1}
+		state.consume(DirBatch{Directories: []string{"/srv/data/zeta-app-files"}})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				state.mu.Lock()
+				state.consume(DirBatch{Directories: []string{fmt.Sprintf("/app%d", i)}, Done: i == 19})
+				state.mu.Unlock()
+			}
+		}()
+		state.drawFrame(screen, &frames)
+		state.mu.RLock()
+		drawn := state.drawn
+		state.mu.RUnlock()
+		handleKeyEventState(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), state, screen)
+		<-done
+		if path, _ := state.commitSelection(); path != drawn {
+			t.Fatalf("Run %d: expected the drawn %s to be committed, got %s", run, drawn, path)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// writableOf looks up whether a directory is writable; tests replace it
+var writableOf = writableDir
+
+// modeWritable reports whether a user with uid and groups may create entries
+// in a directory with permission bits perm, owned by owner and group. Root
+// always may; anyone else needs both write and search permission in the one
+// class, owner, group or other, that applies to them.
+func modeWritable(perm fs.FileMode, owner, group, uid int, groups []int) bool {
+	if uid == 0 {
+		return true
+	}
+	const writeSearch = 0o3
+	if uid == owner {
+		return perm>>6&writeSearch == writeSearch
+	}
+	for _, gid := range groups {
+		if gid == group {
+			return perm>>3&writeSearch == writeSearch
+		}
+	}
+	return perm&writeSearch == writeSearch
+}
+
+// readOnlyDir reports whether dir is known not to be writable by the current
+// user. When that can't be told, on this platform or for this directory, it
+// reports false, so nothing is hidden or dimmed on a guess.
+func readOnlyDir(dir string) bool {
+	writable, known := writableOf(dir)
+	return known && !writable
+}
+
+// writeCache remembers readOnlyDir results so each directory is only
+// inspected the first time it is drawn
+type writeCache struct {
+	mu       sync.Mutex
+	readOnly map[string]bool
+}
+
+// isReadOnly returns the cached readOnlyDir result for dir, inspecting it on
+// first use
+func (c *writeCache) isReadOnly(dir string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if readOnly, ok := c.readOnly[dir]; ok {
+		return readOnly
+	}
+	if c.readOnly == nil {
+		c.readOnly = make(map[string]bool)
+	}
+	readOnly := readOnlyDir(dir)
+	c.readOnly[dir] = readOnly
+	return readOnly
+}
\ No newline at end of file
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+// writableDir never knows on platforms without Unix ownership, where mode
+// bits say little about access; --writable-only and --dim-readonly then
+// leave every directory alone
+func writableDir(dir string) (writable, known bool) {
+	return false, false
+}
\ No newline at end of file
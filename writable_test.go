@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/sahilm/fuzzy"
+)
+
+func TestModeWritable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		perm     os.FileMode
+		owner    int
+		group    int
+		uid      int
+		groups   []int
+		expected bool
+	}{
+		{"Owner", 0755, 1000, 1000, 1000, []int{1000}, true},
+		{"OwnerReadOnly", 0555, 1000, 1000, 1000, []int{1000}, false},
+		{"OwnerWithoutSearch", 0655, 1000, 1000, 1000, []int{1000}, false},
+		{"OwnerBitsWinOverOther", 0507, 1000, 1000, 1000, nil, false},
+		{"Group", 0775, 1000, 50, 1001, []int{50}, true},
+		{"GroupReadOnly", 0757, 1000, 50, 1001, []int{50}, false},
+		{"Other", 0757, 1000, 50, 1001, []int{100}, true},
+		{"OtherReadOnly", 0775, 1000, 50, 1001, []int{100}, false},
+		{"Root", 0555, 1000, 1000, 0, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := modeWritable(tc.perm, tc.owner, tc.group, tc.uid, tc.groups); got != tc.expected {
+				t.Errorf("modeWritable(%o, ...) = %v, expected %v", tc.perm, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWritableOnlySkipsReadOnlyDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"mine/src", "shared/inbox", "unknown"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create test dir %s: %v", dir, err)
+		}
+	}
+
+	// shared is read-only, and unknown can't be told either way
+	original := writableOf
+	writableOf = func(dir string) (bool, bool) {
+		switch dir {
+		case filepath.Join(tempDir, "shared"):
+			return false, true
+		case filepath.Join(tempDir, "unknown"):
+			return false, false
+		}
+		return true, true
+	}
+	defer func() { writableOf = original }()
+
+	config := ScanConfig{
+		Root:             tempDir,
+		MaxDepth:         5,
+		InitialBatchSize: 10,
+		MaxBatchSize:     10,
+		WritableOnly:     true,
+	}
+	found := make(map[string]bool)
+	for batch := range scanWithConfig(config) {
+		for _, dir := range batch.Directories {
+			rel, _ := filepath.Rel(tempDir, dir)
+			found[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	if found["shared"] {
+		t.Error("Read-only shared should be left out")
+	}
+	for _, dir := range []string{"mine", "mine/src", "shared/inbox", "unknown"} {
+		if !found[dir] {
+			t.Errorf("Expected %s to be kept, got %v", dir, found)
+		}
+	}
+}
+
+func TestDimReadOnlyRows(t *testing.T) {
+	original := writableOf
+	writableOf = func(dir string) (bool, bool) { return dir != "/srv/shared", true }
+	defer func() { writableOf = original }()
+
+	screen := newTestScreen(t, 80, 24)
+	view := displayView{
+		Matches:  []fuzzy.Match{{Str: "/srv/mine"}, {Str: "/srv/shared"}, {Str: "/srv/other"}},
+		Selected: 0,
+		Config:   TUIConfig{DimReadOnly: true},
+	}
+	view.WriteModes = &writeCache{}
+	for i := range view.Matches {
+		drawMatchRow(screen, view, i, 0, i, 80)
+	}
+
+	foreground := func(y int) tcell.Color {
+		_, _, style, _ := screen.GetContent(5, y)
+		fg, _, _ := style.Decompose()
+		return fg
+	}
+	if foreground(1) != tcell.ColorGray {
+		t.Errorf("Expected the read-only row greyed out, got %v", foreground(1))
+	}
+	if foreground(2) != tcell.ColorWhite {
+		t.Errorf("Expected a writable row in the normal colour, got %v", foreground(2))
+	}
+}
+
+func TestWritableDirPermissions(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("Root can write to any directory")
+	}
+	tempDir := t.TempDir()
+	readOnly := filepath.Join(tempDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create test dir: %v", err)
+	}
+	defer os.Chmod(readOnly, 0755)
+
+	if _, known := writableDir(tempDir); !known {
+		t.Skip("Writability can't be told on this platform")
+	}
+	if writable, _ := writableDir(tempDir); !writable {
+		t.Error("Expected the temp dir to be writable")
+	}
+	if writable, _ := writableDir(readOnly); writable {
+		t.Error("Expected a 0555 directory not to be writable")
+	}
+}
\ No newline at end of file
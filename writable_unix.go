@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// writableDir reports whether the current user may create entries in dir,
+// judged from its permission bits and ownership; known is false when dir
+// can't be inspected
+func writableDir(dir string) (writable, known bool) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, false
+	}
+	groups, err := os.Getgroups()
+	if err != nil {
+		return false, false
+	}
+	groups = append(groups, os.Getegid())
+	return modeWritable(info.Mode().Perm(), int(stat.Uid), int(stat.Gid), os.Geteuid(), groups), true
+}
\ No newline at end of file